@@ -0,0 +1,84 @@
+package caching
+
+// AddMany stores every entry of params as Add does, overwriting existing keys.
+// The clock and the cache-wide expiry are read once for the whole batch.
+// Entries that fail to encode, or to be saved by the store, are skipped while
+// the others are stored, and reported in a *BatchError.
+// Returns ErrClosed once the cache has been closed.
+func (cache *Cache) AddMany(params ...*AddCacheParams) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	var (
+		expiry     = cache.config.Load().Expiry
+		now        = cache.clock.Now()
+		added      = make([]any, 0, len(params))
+		batchError BatchError
+	)
+
+	for _, param := range params {
+		if err := cache.add(param, expiry, now); err != nil {
+			batchError.add(param.Key, err)
+
+			continue
+		}
+
+		added = append(added, param.Key)
+	}
+
+	batchError.Errors = append(batchError.Errors, cache.publish(added...)...)
+
+	return batchError.err()
+}
+
+// GetMany returns the live entries for the provided keys, like GetAllCacheInfo
+// does for the whole cache, and the keys that missed, in order. A key misses
+// when it doesn't exist, has expired or fails to decrypt; expired and
+// undecryptable entries are removed as Get does, and missing keys are read
+// through the store as Get does. The clock is read once for the whole batch.
+// Every key misses once the cache has been closed.
+func (cache *Cache) GetMany(keys ...any) (map[any]*GetCacheResponse, []any) {
+	res := make(map[any]*GetCacheResponse, len(keys))
+	if cache.isClosed() {
+		return res, keys
+	}
+
+	var (
+		now    = cache.clock.Now()
+		misses []any
+	)
+
+	for _, key := range keys {
+		value, err := cache.fetch(key, nil, now, nil)
+		if err != nil {
+			misses = append(misses, key)
+
+			continue
+		}
+
+		res[key] = value
+	}
+
+	return res, misses
+}
+
+// RemoveMany removes the provided keys from the cache, and from the store as
+// Remove does. Keys the store fails to delete are reported in a *BatchError.
+// Returns ErrClosed once the cache has been closed.
+func (cache *Cache) RemoveMany(keys ...any) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	var batchError BatchError
+
+	for _, key := range keys {
+		batchError.add(key, cache.delete(key))
+		cache.remove(key)
+	}
+
+	batchError.Errors = append(batchError.Errors, cache.publish(keys...)...)
+
+	return batchError.err()
+}
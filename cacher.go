@@ -0,0 +1,61 @@
+package caching
+
+import (
+	"context"
+	"io"
+	"iter"
+	"sync"
+	"time"
+)
+
+type (
+	// Cacher is the set of public methods of Cache, except the deprecated Clean and Namespace.
+	// Depend on Cacher instead of *Cache to substitute the fakes of the cachetest package.
+	Cacher interface {
+		Reader
+		Writer
+		UpdateTime(params *UpdateCacheTimeParams)
+		Options() Options
+		Reconfigure(options Options) error
+		RLock()
+		RUnlock()
+		sync.Locker
+		io.Closer
+	}
+
+	// Reader is the read-only part of Cacher
+	Reader interface {
+		Get(key any, value any) error
+		GetMany(keys ...any) (map[any]*GetCacheResponse, []any)
+		GetBytes(key any, dst []byte) ([]byte, error)
+		Peek(key any, value any) error
+		TTL(key any) (time.Duration, bool)
+		Info(key any) (*EntryInfo, bool)
+		Len() int
+		Stats() Stats
+		IsObfuscated() bool
+		GetAllCacheInfo() map[any]*GetCacheResponse
+		All() iter.Seq2[any, any]
+		Keys() iter.Seq[any]
+		Scan(filter func(key any) bool) iter.Seq2[any, any]
+	}
+
+	// Writer is the mutating part of Cacher
+	Writer interface {
+		Add(params *AddCacheParams) error
+		AddMany(params ...*AddCacheParams) error
+		Update(params *UpdateCacheParams) error
+		Remove(key any) error
+		RemoveMany(keys ...any) error
+		InvalidateTag(tag string) error
+		InvalidateTags(tags ...string) error
+		Clear() error
+		Flush(ctx context.Context) error
+		Expire(key any, d time.Duration) error
+		ExpireAt(key any, t time.Time) error
+		Persist(key any) error
+		Touch(key any) error
+	}
+)
+
+var _ Cacher = (*Cache)(nil)
@@ -0,0 +1,124 @@
+// Package cachetest provides test doubles and assertions for code that depends
+// on caching.Cacher: a Recorder that logs every call, a FaultInjector that forces
+// misses, decryption errors and latency, and helpers driven by caching.FakeClock.
+package cachetest
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vijsourabh/caching"
+)
+
+// NewCache creates a cache driven by a FakeClock and closes it when the test ends.
+// params may be nil; any Clock set in params is replaced by the returned FakeClock.
+func NewCache(tb testing.TB, params *caching.CreateCacheParams) (*caching.Cache, *caching.FakeClock) {
+	tb.Helper()
+
+	createParams := caching.CreateCacheParams{}
+	if params != nil {
+		createParams = *params
+	}
+
+	clock := caching.NewFakeClock(time.Now())
+	createParams.Clock = clock
+
+	cache := caching.NewCache(&createParams)
+	tb.Cleanup(func() {
+		_ = cache.Close()
+	})
+
+	return cache, clock
+}
+
+// AssertHit asserts that key is cached with a value equal to want.
+// It works for both obfuscated and non-obfuscated caches.
+func AssertHit[T any](tb testing.TB, cache caching.Cacher, key any, want T) {
+	tb.Helper()
+
+	got, err := get[T](cache, key)
+	if err != nil {
+		tb.Errorf("expected a cache hit for key %v, got error: %v", key, err)
+
+		return
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		tb.Errorf("unexpected cached value for key %v:\nwant: %#v\n got: %#v", key, want, got)
+	}
+}
+
+// AssertMiss asserts that key is not in the cache
+func AssertMiss(tb testing.TB, cache caching.Cacher, key any) {
+	tb.Helper()
+
+	assertGetErr(tb, cache, key, caching.ErrNotFound)
+}
+
+// AssertExpired asserts that key was in the cache but its expiry has elapsed.
+// Like Get, it removes the expired entry.
+func AssertExpired(tb testing.TB, cache caching.Cacher, key any) {
+	tb.Helper()
+
+	assertGetErr(tb, cache, key, caching.ErrExpired)
+}
+
+// AssertExpiresAfter asserts that key is still cached once d has elapsed on
+// clock, at its deadline, then advances clock past d and asserts that the key
+// has expired.
+func AssertExpiresAfter(tb testing.TB, cache caching.Cacher, clock *caching.FakeClock, key any, d time.Duration) {
+	tb.Helper()
+
+	clock.Advance(d)
+
+	var value any
+	if err := cache.Get(key, &value); err != nil {
+		tb.Errorf("expected key %v to be cached until %v elapses, got error: %v", key, d, err)
+
+		return
+	}
+
+	clock.Advance(time.Nanosecond)
+	AssertExpired(tb, cache, key)
+}
+
+// assertGetErr asserts that Get for key fails with target
+func assertGetErr(tb testing.TB, cache caching.Cacher, key any, target error) {
+	tb.Helper()
+
+	var value any
+
+	err := cache.Get(key, &value)
+	if !errors.Is(err, target) {
+		tb.Errorf("expected error %q for key %v, got: %v", target, key, err)
+	}
+}
+
+// get reads key into a T. Non-obfuscated caches hand back the stored value as-is;
+// obfuscated caches decode JSON into an any, which is converted into a T.
+func get[T any](cache caching.Cacher, key any) (T, error) {
+	var (
+		got   T
+		value any
+	)
+
+	if err := cache.Get(key, &value); err != nil {
+		return got, err
+	}
+
+	if typed, ok := value.(T); ok {
+		return typed, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return got, err
+	}
+
+	err = json.Unmarshal(data, &got)
+
+	return got, err
+}
@@ -0,0 +1,179 @@
+package cachetest
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vijsourabh/caching"
+)
+
+type (
+	testStruct struct {
+		Value string
+	}
+
+	// failureRecorder is a testing.TB that records failures instead of failing the test
+	failureRecorder struct {
+		testing.TB
+		failed bool
+	}
+)
+
+var (
+	testCacheKey   = "key"
+	testCacheValue = &testStruct{
+		Value: "value",
+	}
+)
+
+func TestService_CacheTest(test *testing.T) {
+	defer flumetest.Start(test)
+
+	for _, obfuscated := range []bool{false, true} {
+		test.Run(fmt.Sprintf("assertions on a cache driven by the fake clock, obfuscated %t", obfuscated), func(test *testing.T) {
+			defer flumetest.Start(test)
+			test.Parallel()
+
+			cache, clock := NewCache(test, &caching.CreateCacheParams{
+				Expiry:            time.Minute,
+				CleanInterval:     time.Minute,
+				IsCacheObfuscated: obfuscated,
+			})
+
+			err := cache.Add(&caching.AddCacheParams{
+				Key:   testCacheKey,
+				Value: testCacheValue,
+			})
+			require.NoError(test, err)
+
+			AssertHit(test, cache, testCacheKey, testCacheValue)
+			AssertMiss(test, cache, "missing")
+			AssertExpiresAfter(test, cache, clock, testCacheKey, time.Minute)
+			AssertMiss(test, cache, testCacheKey)
+		})
+	}
+
+	test.Run("assertions report failures", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, _ := NewCache(test, nil)
+
+		err := cache.Add(&caching.AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		recorder := &failureRecorder{TB: test}
+		AssertHit(recorder, cache, testCacheKey, &testStruct{Value: "other"})
+		require.True(test, recorder.failed)
+
+		recorder = &failureRecorder{TB: test}
+		AssertMiss(recorder, cache, testCacheKey)
+		require.True(test, recorder.failed)
+
+		recorder = &failureRecorder{TB: test}
+		AssertExpired(recorder, cache, testCacheKey)
+		require.True(test, recorder.failed)
+	})
+
+	test.Run("recorder logs every call", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, _ := NewCache(test, nil)
+		recorder := NewRecorder(cache)
+
+		addParams := &caching.AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		}
+		require.NoError(test, recorder.Add(addParams))
+
+		var value any
+		require.NoError(test, recorder.Get(testCacheKey, &value))
+		require.ErrorIs(test, recorder.Get("missing", &value), caching.ErrNotFound)
+
+		recorder.Lock()
+		recorder.Unlock()
+		require.NoError(test, recorder.Remove(testCacheKey))
+
+		calls := recorder.Calls()
+		require.Len(test, calls, 6)
+		require.Equal(test, Call{Method: "Add", Args: []any{addParams}}, calls[0])
+		require.Equal(test, "Get", calls[1].Method)
+		require.Equal(test, testCacheKey, calls[1].Args[0])
+		require.NoError(test, calls[1].Err)
+		require.ErrorIs(test, calls[2].Err, caching.ErrNotFound)
+		require.Equal(test, []string{"Lock", "Unlock", "Remove"}, []string{calls[3].Method, calls[4].Method, calls[5].Method})
+
+		require.Len(test, recorder.CallsTo("Get"), 2)
+
+		recorder.Reset()
+		require.Empty(test, recorder.Calls())
+	})
+
+	test.Run("fault injector forces misses, decryption errors and latency", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, _ := NewCache(test, &caching.CreateCacheParams{
+			IsCacheObfuscated: true,
+		})
+		injector := NewFaultInjector(cache)
+
+		for _, key := range []string{"hit", "miss", "decrypt"} {
+			err := injector.Add(&caching.AddCacheParams{
+				Key:   key,
+				Value: testCacheValue,
+			})
+			require.NoError(test, err)
+		}
+
+		injector.ForceMiss("miss")
+		injector.ForceDecryptError("decrypt")
+
+		AssertHit(test, injector, "hit", testCacheValue)
+		AssertMiss(test, injector, "miss")
+
+		var value testStruct
+		require.ErrorIs(test, injector.Get("decrypt", &value), caching.ErrDecrypt)
+
+		info := injector.GetAllCacheInfo()
+		require.Len(test, info, 1)
+		require.Contains(test, info, "hit")
+		require.Equal(test, []any{"hit"}, slices.Collect(injector.Keys()))
+
+		for key := range injector.All() {
+			require.Equal(test, "hit", key)
+		}
+
+		res, misses := injector.GetMany("miss", "hit", "absent", "decrypt")
+		require.Len(test, res, 1)
+		require.Contains(test, res, "hit")
+		require.Equal(test, []any{"miss", "absent", "decrypt"}, misses)
+
+		latency := time.Millisecond * 20
+		injector.SetLatency(latency)
+
+		start := time.Now()
+		AssertHit(test, injector, "hit", testCacheValue)
+		require.GreaterOrEqual(test, time.Since(start), latency)
+
+		injector.Reset()
+		AssertHit(test, injector, "miss", testCacheValue)
+		AssertHit(test, injector, "decrypt", testCacheValue)
+	})
+}
+
+func (recorder *failureRecorder) Helper() {}
+
+func (recorder *failureRecorder) Errorf(string, ...any) {
+	recorder.failed = true
+}
@@ -0,0 +1,384 @@
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/vijsourabh/caching"
+)
+
+// errInjectedDecrypt is the cause wrapped with caching.ErrDecrypt by a FaultInjector
+var errInjectedDecrypt = errors.New("injected decryption failure")
+
+// FaultInjector is a caching.Cacher that forwards every call to an inner cacher
+// while injecting faults: forced misses, decryption errors and added latency.
+type FaultInjector struct {
+	inner         caching.Cacher
+	lock          sync.RWMutex
+	misses        map[any]struct{}
+	decryptErrors map[any]struct{}
+	latency       time.Duration
+}
+
+var _ caching.Cacher = (*FaultInjector)(nil)
+
+// NewFaultInjector creates a FaultInjector forwarding to inner, with no faults configured
+func NewFaultInjector(inner caching.Cacher) *FaultInjector {
+	return &FaultInjector{
+		inner:         inner,
+		misses:        make(map[any]struct{}),
+		decryptErrors: make(map[any]struct{}),
+	}
+}
+
+// ForceMiss makes Get, GetBytes and Peek report caching.ErrNotFound for the provided keys,
+// GetMany report them as misses, and TTL, Info, GetAllCacheInfo and the
+// iterators omit them, whether or not they are cached
+func (injector *FaultInjector) ForceMiss(keys ...any) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+
+	for _, key := range keys {
+		injector.misses[key] = struct{}{}
+	}
+}
+
+// ForceDecryptError makes Get, GetBytes and Peek report caching.ErrDecrypt for the provided keys,
+// GetMany report them as misses, and GetAllCacheInfo and the iterators omit them,
+// as a tampered obfuscated cache would
+func (injector *FaultInjector) ForceDecryptError(keys ...any) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+
+	for _, key := range keys {
+		injector.decryptErrors[key] = struct{}{}
+	}
+}
+
+// SetLatency delays every call by d before it is forwarded
+func (injector *FaultInjector) SetLatency(d time.Duration) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+
+	injector.latency = d
+}
+
+// Reset removes every configured fault
+func (injector *FaultInjector) Reset() {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+
+	clear(injector.misses)
+	clear(injector.decryptErrors)
+	injector.latency = 0
+}
+
+func (injector *FaultInjector) Add(params *caching.AddCacheParams) error {
+	injector.delay()
+
+	return injector.inner.Add(params)
+}
+
+func (injector *FaultInjector) AddMany(params ...*caching.AddCacheParams) error {
+	injector.delay()
+
+	return injector.inner.AddMany(params...)
+}
+
+func (injector *FaultInjector) Get(key any, value any) error {
+	injector.delay()
+
+	if err := injector.fault(key); err != nil {
+		return err
+	}
+
+	return injector.inner.Get(key, value)
+}
+
+func (injector *FaultInjector) GetMany(keys ...any) (map[any]*caching.GetCacheResponse, []any) {
+	injector.delay()
+
+	var forwarded []any
+
+	for _, key := range keys {
+		if injector.fault(key) == nil {
+			forwarded = append(forwarded, key)
+		}
+	}
+
+	res, _ := injector.inner.GetMany(forwarded...)
+
+	// Report the misses in the order of keys, faulted or not.
+	var misses []any
+
+	for _, key := range keys {
+		if _, found := res[key]; !found {
+			misses = append(misses, key)
+		}
+	}
+
+	return res, misses
+}
+
+func (injector *FaultInjector) GetBytes(key any, dst []byte) ([]byte, error) {
+	injector.delay()
+
+	if err := injector.fault(key); err != nil {
+		return dst, err
+	}
+
+	return injector.inner.GetBytes(key, dst)
+}
+
+func (injector *FaultInjector) Peek(key any, value any) error {
+	injector.delay()
+
+	if err := injector.fault(key); err != nil {
+		return err
+	}
+
+	return injector.inner.Peek(key, value)
+}
+
+func (injector *FaultInjector) TTL(key any) (time.Duration, bool) {
+	injector.delay()
+
+	if injector.isMiss(key) {
+		return 0, false
+	}
+
+	return injector.inner.TTL(key)
+}
+
+func (injector *FaultInjector) Info(key any) (*caching.EntryInfo, bool) {
+	injector.delay()
+
+	if injector.isMiss(key) {
+		return nil, false
+	}
+
+	return injector.inner.Info(key)
+}
+
+func (injector *FaultInjector) Len() int {
+	injector.delay()
+
+	return injector.inner.Len()
+}
+
+func (injector *FaultInjector) Stats() caching.Stats {
+	injector.delay()
+
+	return injector.inner.Stats()
+}
+
+func (injector *FaultInjector) IsObfuscated() bool {
+	injector.delay()
+
+	return injector.inner.IsObfuscated()
+}
+
+func (injector *FaultInjector) Update(params *caching.UpdateCacheParams) error {
+	injector.delay()
+
+	return injector.inner.Update(params)
+}
+
+func (injector *FaultInjector) Remove(key any) error {
+	injector.delay()
+
+	return injector.inner.Remove(key)
+}
+
+func (injector *FaultInjector) RemoveMany(keys ...any) error {
+	injector.delay()
+
+	return injector.inner.RemoveMany(keys...)
+}
+
+func (injector *FaultInjector) InvalidateTag(tag string) error {
+	injector.delay()
+
+	return injector.inner.InvalidateTag(tag)
+}
+
+func (injector *FaultInjector) InvalidateTags(tags ...string) error {
+	injector.delay()
+
+	return injector.inner.InvalidateTags(tags...)
+}
+
+func (injector *FaultInjector) Expire(key any, d time.Duration) error {
+	injector.delay()
+
+	return injector.inner.Expire(key, d)
+}
+
+func (injector *FaultInjector) ExpireAt(key any, t time.Time) error {
+	injector.delay()
+
+	return injector.inner.ExpireAt(key, t)
+}
+
+func (injector *FaultInjector) Persist(key any) error {
+	injector.delay()
+
+	return injector.inner.Persist(key)
+}
+
+func (injector *FaultInjector) Touch(key any) error {
+	injector.delay()
+
+	return injector.inner.Touch(key)
+}
+
+func (injector *FaultInjector) GetAllCacheInfo() map[any]*caching.GetCacheResponse {
+	injector.delay()
+
+	res := injector.inner.GetAllCacheInfo()
+	for key := range res {
+		if injector.fault(key) != nil {
+			delete(res, key)
+		}
+	}
+
+	return res
+}
+
+func (injector *FaultInjector) All() iter.Seq2[any, any] {
+	return injector.Scan(nil)
+}
+
+func (injector *FaultInjector) Keys() iter.Seq[any] {
+	injector.delay()
+
+	keys := injector.inner.Keys()
+
+	return func(yield func(any) bool) {
+		for key := range keys {
+			if injector.fault(key) != nil {
+				continue
+			}
+
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (injector *FaultInjector) Scan(filter func(key any) bool) iter.Seq2[any, any] {
+	injector.delay()
+
+	entries := injector.inner.Scan(filter)
+
+	return func(yield func(any, any) bool) {
+		for key, value := range entries {
+			if injector.fault(key) != nil {
+				continue
+			}
+
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+func (injector *FaultInjector) UpdateTime(params *caching.UpdateCacheTimeParams) {
+	injector.delay()
+	injector.inner.UpdateTime(params)
+}
+
+func (injector *FaultInjector) Options() caching.Options {
+	injector.delay()
+
+	return injector.inner.Options()
+}
+
+func (injector *FaultInjector) Reconfigure(options caching.Options) error {
+	injector.delay()
+
+	return injector.inner.Reconfigure(options)
+}
+
+func (injector *FaultInjector) Clear() error {
+	injector.delay()
+
+	return injector.inner.Clear()
+}
+
+func (injector *FaultInjector) Flush(ctx context.Context) error {
+	injector.delay()
+
+	return injector.inner.Flush(ctx)
+}
+
+func (injector *FaultInjector) Close() error {
+	injector.delay()
+
+	return injector.inner.Close()
+}
+
+func (injector *FaultInjector) RLock() {
+	injector.inner.RLock()
+}
+
+func (injector *FaultInjector) RUnlock() {
+	injector.inner.RUnlock()
+}
+
+func (injector *FaultInjector) Lock() {
+	injector.inner.Lock()
+}
+
+func (injector *FaultInjector) Unlock() {
+	injector.inner.Unlock()
+}
+
+// delay sleeps for the configured latency
+func (injector *FaultInjector) delay() {
+	injector.lock.RLock()
+	latency := injector.latency
+	injector.lock.RUnlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+}
+
+// isMiss reports whether a miss is forced for key
+func (injector *FaultInjector) isMiss(key any) bool {
+	injector.lock.RLock()
+	defer injector.lock.RUnlock()
+
+	_, found := injector.misses[key]
+
+	return found
+}
+
+// fault returns the error injected for key, or nil when no fault is configured
+func (injector *FaultInjector) fault(key any) error {
+	injector.lock.RLock()
+	defer injector.lock.RUnlock()
+
+	if _, found := injector.misses[key]; found {
+		return &caching.KeyError{
+			Key: key,
+			Err: caching.ErrNotFound,
+		}
+	}
+
+	if _, found := injector.decryptErrors[key]; found {
+		return &caching.KeyError{
+			Key: key,
+			Err: fmt.Errorf("%w: %w", caching.ErrDecrypt, errInjectedDecrypt),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,309 @@
+package cachetest
+
+import (
+	"context"
+	"iter"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vijsourabh/caching"
+)
+
+type (
+	// Recorder is a caching.Cacher that forwards every call to an inner cacher
+	// and logs it, so tests can assert on how the code under test used the cache.
+	Recorder struct {
+		inner caching.Cacher
+		lock  sync.Mutex
+		calls []Call
+	}
+
+	// Call is a single call logged by a Recorder
+	Call struct {
+		// Method is the name of the called method, e.g. "Get"
+		Method string
+		// Args are the arguments of the call, in order
+		Args []any
+		// Err is the error returned by the call, if the method returns one
+		Err error
+	}
+)
+
+var _ caching.Cacher = (*Recorder)(nil)
+
+// NewRecorder creates a Recorder forwarding to inner, typically a cache from NewCache
+func NewRecorder(inner caching.Cacher) *Recorder {
+	return &Recorder{
+		inner: inner,
+	}
+}
+
+// Calls returns a copy of every call logged so far, in order
+func (recorder *Recorder) Calls() []Call {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	return slices.Clone(recorder.calls)
+}
+
+// CallsTo returns the logged calls to the named method, in order
+func (recorder *Recorder) CallsTo(method string) []Call {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	var calls []Call
+
+	for _, call := range recorder.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Reset forgets every logged call
+func (recorder *Recorder) Reset() {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	recorder.calls = nil
+}
+
+func (recorder *Recorder) Add(params *caching.AddCacheParams) error {
+	err := recorder.inner.Add(params)
+	recorder.record("Add", err, params)
+
+	return err
+}
+
+func (recorder *Recorder) AddMany(params ...*caching.AddCacheParams) error {
+	err := recorder.inner.AddMany(params...)
+	recorder.record("AddMany", err, params)
+
+	return err
+}
+
+func (recorder *Recorder) Get(key any, value any) error {
+	err := recorder.inner.Get(key, value)
+	recorder.record("Get", err, key, value)
+
+	return err
+}
+
+func (recorder *Recorder) GetMany(keys ...any) (map[any]*caching.GetCacheResponse, []any) {
+	res, misses := recorder.inner.GetMany(keys...)
+	recorder.record("GetMany", nil, keys)
+
+	return res, misses
+}
+
+func (recorder *Recorder) GetBytes(key any, dst []byte) ([]byte, error) {
+	res, err := recorder.inner.GetBytes(key, dst)
+	recorder.record("GetBytes", err, key, dst)
+
+	return res, err
+}
+
+func (recorder *Recorder) Peek(key any, value any) error {
+	err := recorder.inner.Peek(key, value)
+	recorder.record("Peek", err, key, value)
+
+	return err
+}
+
+func (recorder *Recorder) TTL(key any) (time.Duration, bool) {
+	ttl, found := recorder.inner.TTL(key)
+	recorder.record("TTL", nil, key)
+
+	return ttl, found
+}
+
+func (recorder *Recorder) Info(key any) (*caching.EntryInfo, bool) {
+	info, found := recorder.inner.Info(key)
+	recorder.record("Info", nil, key)
+
+	return info, found
+}
+
+func (recorder *Recorder) Len() int {
+	length := recorder.inner.Len()
+	recorder.record("Len", nil)
+
+	return length
+}
+
+func (recorder *Recorder) Stats() caching.Stats {
+	stats := recorder.inner.Stats()
+	recorder.record("Stats", nil)
+
+	return stats
+}
+
+func (recorder *Recorder) IsObfuscated() bool {
+	obfuscated := recorder.inner.IsObfuscated()
+	recorder.record("IsObfuscated", nil)
+
+	return obfuscated
+}
+
+func (recorder *Recorder) Update(params *caching.UpdateCacheParams) error {
+	err := recorder.inner.Update(params)
+	recorder.record("Update", err, params)
+
+	return err
+}
+
+func (recorder *Recorder) Remove(key any) error {
+	err := recorder.inner.Remove(key)
+	recorder.record("Remove", err, key)
+
+	return err
+}
+
+func (recorder *Recorder) RemoveMany(keys ...any) error {
+	err := recorder.inner.RemoveMany(keys...)
+	recorder.record("RemoveMany", err, keys)
+
+	return err
+}
+
+func (recorder *Recorder) InvalidateTag(tag string) error {
+	err := recorder.inner.InvalidateTag(tag)
+	recorder.record("InvalidateTag", err, tag)
+
+	return err
+}
+
+func (recorder *Recorder) InvalidateTags(tags ...string) error {
+	err := recorder.inner.InvalidateTags(tags...)
+	recorder.record("InvalidateTags", err, tags)
+
+	return err
+}
+
+func (recorder *Recorder) Expire(key any, d time.Duration) error {
+	err := recorder.inner.Expire(key, d)
+	recorder.record("Expire", err, key, d)
+
+	return err
+}
+
+func (recorder *Recorder) ExpireAt(key any, t time.Time) error {
+	err := recorder.inner.ExpireAt(key, t)
+	recorder.record("ExpireAt", err, key, t)
+
+	return err
+}
+
+func (recorder *Recorder) Persist(key any) error {
+	err := recorder.inner.Persist(key)
+	recorder.record("Persist", err, key)
+
+	return err
+}
+
+func (recorder *Recorder) Touch(key any) error {
+	err := recorder.inner.Touch(key)
+	recorder.record("Touch", err, key)
+
+	return err
+}
+
+func (recorder *Recorder) GetAllCacheInfo() map[any]*caching.GetCacheResponse {
+	res := recorder.inner.GetAllCacheInfo()
+	recorder.record("GetAllCacheInfo", nil)
+
+	return res
+}
+
+func (recorder *Recorder) All() iter.Seq2[any, any] {
+	recorder.record("All", nil)
+
+	return recorder.inner.All()
+}
+
+func (recorder *Recorder) Keys() iter.Seq[any] {
+	recorder.record("Keys", nil)
+
+	return recorder.inner.Keys()
+}
+
+func (recorder *Recorder) Scan(filter func(key any) bool) iter.Seq2[any, any] {
+	recorder.record("Scan", nil, filter)
+
+	return recorder.inner.Scan(filter)
+}
+
+func (recorder *Recorder) UpdateTime(params *caching.UpdateCacheTimeParams) {
+	recorder.inner.UpdateTime(params)
+	recorder.record("UpdateTime", nil, params)
+}
+
+func (recorder *Recorder) Options() caching.Options {
+	options := recorder.inner.Options()
+	recorder.record("Options", nil)
+
+	return options
+}
+
+func (recorder *Recorder) Reconfigure(options caching.Options) error {
+	err := recorder.inner.Reconfigure(options)
+	recorder.record("Reconfigure", err, options)
+
+	return err
+}
+
+func (recorder *Recorder) Clear() error {
+	err := recorder.inner.Clear()
+	recorder.record("Clear", err)
+
+	return err
+}
+
+func (recorder *Recorder) Flush(ctx context.Context) error {
+	err := recorder.inner.Flush(ctx)
+	recorder.record("Flush", err)
+
+	return err
+}
+
+func (recorder *Recorder) Close() error {
+	err := recorder.inner.Close()
+	recorder.record("Close", err)
+
+	return err
+}
+
+func (recorder *Recorder) RLock() {
+	recorder.inner.RLock()
+	recorder.record("RLock", nil)
+}
+
+func (recorder *Recorder) RUnlock() {
+	recorder.inner.RUnlock()
+	recorder.record("RUnlock", nil)
+}
+
+func (recorder *Recorder) Lock() {
+	recorder.inner.Lock()
+	recorder.record("Lock", nil)
+}
+
+func (recorder *Recorder) Unlock() {
+	recorder.inner.Unlock()
+	recorder.record("Unlock", nil)
+}
+
+// record logs a call to method
+func (recorder *Recorder) record(method string, err error, args ...any) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	recorder.calls = append(recorder.calls, Call{
+		Method: method,
+		Args:   args,
+		Err:    err,
+	})
+}
@@ -4,43 +4,115 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type (
+	// Cache is the root cache created by NewCache, or one of its namespaces
 	Cache struct {
-		cacheMap      sync.Map
-		expiry        time.Duration
-		cleanInterval time.Duration
-		obfuscator    *Obfuscator
-		lock          sync.RWMutex
-		intervalCh    chan time.Duration // signals cleanInterval changes from UpdateTime
+		*store
+		namespace      string                  // empty for the root cache
+		config         atomic.Pointer[Options] // runtime configuration, replaced as a whole by Reconfigure
+		configLock     sync.Mutex              // serialises reconfigurations
+		lock           sync.RWMutex
+		length         atomic.Int64 // number of entries of the cache in cacheMap, maintained on store and delete
+		tags           keyIndex[string]
+		dependents     keyIndex[any] // dependency key → keys of the entries depending on it
+		stats          cacheStats
+		detached       atomic.Bool     // set once a namespace is closed
+		backend        Store           // nil for namespaces and caches without a store
+		writes         *writeBehind    // nil unless the writes to backend are queued
+		invalidator    Invalidator     // nil for namespaces and caches without an invalidator
+		publishTimeout time.Duration   // bounds each publication to invalidator
+		replication    *replicationLog // nil for namespaces and caches without replication
+	}
+
+	// store is the state shared by a cache and its namespaces: the storage, the
+	// background cleaner and the obfuscation key
+	store struct {
+		cacheMap   sync.Map
+		configCh   chan struct{} // signals the cleaner that the configuration changed
+		obfuscator *Obfuscator
+		compressor *Compressor
+		clock      Clock
+		versions   atomic.Uint64 // source of entry versions, bumped on every write
+		root       *Cache
+		namespaces sync.Map // namespace name → *Cache
+		maxDepth   int      // longest chain of dependencies
 		cacheCtx
 	}
 
-	// cacheCtx stores ctx and cancelFunc to stop the routines
+	// cacheCtx stores ctx and cancelFunc to stop the routines, and the
+	// WaitGroup used by Close to wait for them to exit
 	cacheCtx struct {
 		ctx        context.Context
 		cancelFunc context.CancelFunc
+		routines   sync.WaitGroup
+		closed     atomic.Bool
 	}
 
 	cacheEntry struct {
 		value         any
 		insertionTime time.Time
 		expiry        time.Duration
+		expiresAt     time.Time // zero when the entry never expires
+		version       uint64
+		// inheritsExpiry is set for entries using the cache-wide expiry rather
+		// than a per-key one, so UpdateTime can apply a new expiry to them
+		inheritsExpiry bool
+		tags           []string // sorted and without duplicates
+		dependsOn      []any    // without duplicates
+		owner          *Cache   // the cache or namespace the entry belongs to
 	}
 
 	CreateCacheParams struct {
 		Expiry            time.Duration
 		CleanInterval     time.Duration
 		IsCacheObfuscated bool
+		// Compression configures the compression stage applied to obfuscated
+		// values before encryption. It has no effect on non-obfuscated caches.
+		// Settings rejected by NewCompressor disable compression.
+		Compression CompressionParams
+		// Clock is the source of time for expiry and the background cleaner.
+		// Defaults to the system clock when nil.
+		Clock Clock
+		// MaxDependencyDepth is the longest chain of dependencies declared with
+		// AddCacheParams.DependsOn. Defaults to 16 when zero or negative.
+		MaxDependencyDepth int
+		// Store is the backing store the cache reads through on misses and
+		// writes through on Add, Update and Remove. None when nil.
+		Store Store
+		// WriteBehind queues the writes to Store and flushes them in batches
+		// instead of writing them through.
+		WriteBehind WriteBehindParams
+		// Invalidator publishes the keys changed or removed by Add, Update,
+		// Remove, InvalidateTags, Clear, Expire and ExpireAt, and their
+		// dependents, to the caches of other processes, and removes the keys
+		// they publish. Keys must then be strings. None when nil.
+		Invalidator Invalidator
+		// InvalidationTimeout bounds each publication to the Invalidator, so
+		// that writes don't wait on slow or unreachable processes. Defaults to
+		// one second.
+		InvalidationTimeout time.Duration
+		// Replication records the changes of the entries in a log tailed by
+		// followers. Namespaces are not replicated.
+		Replication ReplicationParams
 	}
 
 	AddCacheParams struct {
 		Key    any
 		Value  any
 		Expiry time.Duration
+		// Tags label the entry so it can be removed together with every other
+		// entry sharing a tag, with InvalidateTag or InvalidateTags.
+		Tags []string
+		// DependsOn lists the keys the entry is derived from. The entry is
+		// removed when any of them is removed, updated, overwritten or expires.
+		DependsOn []any
 	}
 
 	UpdateCacheParams struct {
@@ -51,62 +123,165 @@ type (
 	UpdateCacheTimeParams struct {
 		Expiry        time.Duration
 		CleanInterval time.Duration
+		// ApplyToExisting also applies Expiry to the entries already cached
+		// with the cache-wide expiry, counted from the start of their current
+		// TTL. Entries added with a per-key Expiry, or whose expiry was set with
+		// Expire, ExpireAt or Persist, are left untouched.
+		ApplyToExisting bool
 	}
 
 	GetCacheResponse struct {
 		Value any
 	}
+
+	// EntryInfo describes a cache entry without exposing its value
+	EntryInfo struct {
+		Key           any
+		InsertionTime time.Time
+		// Expiry is the TTL of the entry. Zero or negative means the entry never expires.
+		Expiry time.Duration
+		// ExpiresAt is the time the entry expires, zero when it never expires.
+		// It starts at InsertionTime+Expiry and moves with Expire, ExpireAt and Touch.
+		ExpiresAt time.Time
+		// Version changes on every write of the entry. Versions are unique
+		// across the cache and increase monotonically.
+		Version uint64
+		// Size is the size in bytes of the encrypted value. It is zero for
+		// non-obfuscated caches, which store values as-is.
+		Size int
+		// Tags are the tags the entry was added with, sorted
+		Tags []string
+		// DependsOn are the keys the entry was added with as dependencies
+		DependsOn []any
+	}
 )
 
 const (
 	defaultExpiry = -1
+	// defaultMaxDependencyDepth is the default of CreateCacheParams.MaxDependencyDepth
+	defaultMaxDependencyDepth = 16
+	// defaultInvalidationTimeout is the default of CreateCacheParams.InvalidationTimeout
+	defaultInvalidationTimeout = time.Second
+	// scratchSize is the initial capacity of the pooled scratch buffers
+	scratchSize = 512
+	// maxScratchSize is the capacity above which scratch buffers are not pooled
+	maxScratchSize = 64 << 10
+)
+
+var (
+	_ io.Closer = (*Cache)(nil)
+
+	// scratchBuffers pools the buffers holding intermediate payloads of
+	// obfuscated caches: compressed JSON before encryption, and decrypted JSON
+	// that isn't returned to the caller. They are zeroed when released.
+	scratchBuffers = sync.Pool{
+		New: func() any {
+			buf := make([]byte, 0, scratchSize)
+
+			return &buf
+		},
+	}
 )
 
 // NewCache creates a cache Instance and triggers a goroutine to Clean the cache on the basis of provided cleanInterval.
 func NewCache(params *CreateCacheParams) *Cache {
 	cache := &Cache{
-		cacheMap:      sync.Map{},
-		cleanInterval: params.CleanInterval,
-		expiry:        defaultExpiry,
+		store: &store{
+			clock:    params.Clock,
+			maxDepth: params.MaxDependencyDepth,
+		},
+	}
+	cache.root = cache
+	cache.backend = params.Store
+
+	if cache.clock == nil {
+		cache.clock = realClock{}
+	}
+
+	if cache.maxDepth <= 0 {
+		cache.maxDepth = defaultMaxDependencyDepth
 	}
 
-	cache.intervalCh = make(chan time.Duration, 1)
+	cache.configCh = make(chan struct{}, 1)
 
 	cache.cacheCtx.ctx, cache.cacheCtx.cancelFunc = context.WithCancel(context.Background())
 
+	options := &Options{
+		Expiry:        defaultExpiry,
+		CleanInterval: max(params.CleanInterval, 0),
+	}
+
 	// override the expiry provided by the user
 	if params.Expiry > 0 {
-		cache.expiry = params.Expiry
+		options.Expiry = params.Expiry
 	}
 
+	cache.config.Store(options)
+
 	if params.IsCacheObfuscated {
 		cache.obfuscator = NewObfuscator()
+
+		compressor, err := NewCompressor(params.Compression)
+		if err != nil {
+			// NewCache doesn't fail: invalid settings disable compression.
+			compressor, _ = NewCompressor(CompressionParams{})
+		}
+
+		cache.compressor = compressor
+	}
+
+	// Create the ticker before starting the goroutine so that time advanced
+	// right after NewCache is always observed by the cleaner.
+	var ticker Ticker
+	if options.CleanInterval > 0 {
+		ticker = cache.clock.NewTicker(options.CleanInterval)
 	}
 
 	// call goroutine to clean cache
-	go cache.clean()
+	cache.routines.Go(func() {
+		cache.clean(ticker, options.CleanInterval)
+	})
+
+	if params.Invalidator != nil {
+		cache.invalidator = params.Invalidator
+		cache.invalidator.Subscribe(cache.invalidated)
+
+		cache.publishTimeout = params.InvalidationTimeout
+		if cache.publishTimeout <= 0 {
+			cache.publishTimeout = defaultInvalidationTimeout
+		}
+	}
+
+	if params.Replication.Enabled {
+		cache.replication = newReplicationLog(params.Replication.LogSize)
+	}
+
+	if params.Store != nil && params.WriteBehind.Enabled {
+		cache.writes = newWriteBehind(params.WriteBehind)
+
+		flushTicker := cache.clock.NewTicker(cache.writes.params.FlushInterval)
+		cache.routines.Go(func() {
+			cache.flushBehind(flushTicker)
+		})
+	}
 
 	return cache
 }
 
 // UpdateTime updates the global expiry and, when CleanInterval > 0, the
-// cleanInterval of the background cleaner goroutine.
-// Callers performing concurrent Add/Get alongside UpdateTime must hold the
-// write Lock() before calling this method to avoid a data race on expiry.
+// cleanInterval of the background cleaner goroutine. Existing entries keep
+// their expiry unless ApplyToExisting is set.
+// It is safe to call concurrently with any other method; see Reconfigure.
+// Namespaces share the cleaner of the root cache and ignore CleanInterval.
+// UpdateTime is a no-op once the cache has been closed.
 func (cache *Cache) UpdateTime(params *UpdateCacheTimeParams) {
-	cache.expiry = params.Expiry
-
-	if params.CleanInterval > 0 {
-		cache.cleanInterval = params.CleanInterval
-		// Notify the clean() goroutine immediately so it resets the ticker
-		// without waiting for the current tick to expire. Non-blocking send:
-		// if the channel already holds a pending value the goroutine will
-		// read the latest cleanInterval from cache.cleanInterval directly.
-		select {
-		case cache.intervalCh <- params.CleanInterval:
-		default:
+	_ = cache.reconfigure(func(options *Options) {
+		options.Expiry = params.Expiry
+
+		if params.CleanInterval > 0 && cache.isRoot() {
+			options.CleanInterval = params.CleanInterval
 		}
-	}
+	}, params.ApplyToExisting)
 }
 
 // GetAllCacheInfo returns all non-expired cache entries.
@@ -114,8 +289,12 @@ func (cache *Cache) UpdateTime(params *UpdateCacheTimeParams) {
 // so callers can range over the result without a nil-check.
 func (cache *Cache) GetAllCacheInfo() map[any]*GetCacheResponse {
 	res := make(map[any]*GetCacheResponse)
-	cache.cacheMap.Range(func(key, value any) bool {
-		insertedVal, found := cache.get(key, value)
+	if cache.isClosed() {
+		return res
+	}
+
+	cache.rangeEntries(func(key any, _ *cacheEntry) bool {
+		insertedVal, found := cache.get(key, nil)
 		if found {
 			res[key] = insertedVal
 		}
@@ -126,68 +305,216 @@ func (cache *Cache) GetAllCacheInfo() map[any]*GetCacheResponse {
 	return res
 }
 
-// Update updates the value for the cache
+// Update atomically updates the value for the cache, keeping its insertion time and expiry.
+// Entries depending on the key are removed. The value is written through the
+// store of a cache created with one before the cache is updated.
+// Returns a *KeyError wrapping ErrNotFound or ErrExpired if the key doesn't exist,
+// ErrStore if the store fails, and ErrInvalidation if the Invalidator fails.
 func (cache *Cache) Update(params *UpdateCacheParams) error {
-	value, found := cache.cacheMap.Load(params.Key)
-	if !found {
-		return errors.New("value doesn't exist in cache")
+	if cache.isClosed() {
+		return ErrClosed
 	}
 
-	entry, ok := value.(*cacheEntry)
-	if !ok {
-		cache.Remove(params.Key)
+	value, err := cache.encode(params.Key, params.Value)
+	if err != nil {
+		return err
+	}
+
+	if cache.backend != nil {
+		// Only existing keys are written through.
+		if _, err = cache.peek(params.Key); err != nil {
+			return err
+		}
 
-		return errors.New("invalid value found in cache")
+		if err = cache.save(params.Key, params.Value); err != nil {
+			return err
+		}
 	}
 
-	entry.value = params.Value
+	err = cache.modify(params.Key, func(entry cacheEntry, _ time.Time) *cacheEntry {
+		entry.value = value
+		entry.version = cache.versions.Add(1)
+
+		return &entry
+	})
+	if err != nil {
+		return err
+	}
 
-	return cache.addInCache(params.Key, entry)
+	cache.cascade(params.Key)
+
+	if keyErrors := cache.publish(params.Key); len(keyErrors) > 0 {
+		return keyErrors[0]
+	}
+
+	return nil
 }
 
-// Add stores a value in the cache. If the key already exists it is overwritten.
+// Add stores a value in the cache. If the key already exists it is overwritten,
+// and entries depending on it are removed.
 // Per-key Expiry overrides the cache-level expiry when > 0.
-// Callers that concurrently call UpdateTime must hold RLock() before calling
-// Add to avoid a data race on the cache-level expiry field.
+// The value is written through the store of a cache created with one, and is
+// only cached once the store has saved it.
+// Returns a *KeyError wrapping ErrDependencyCycle or ErrDependencyDepth if
+// DependsOn would close a cycle or exceed MaxDependencyDepth, ErrStore if the
+// store fails, and ErrInvalidation if the Invalidator fails.
 func (cache *Cache) Add(params *AddCacheParams) error {
-	value := &cacheEntry{
-		value:         params.Value,
-		expiry:        cache.expiry,
-		insertionTime: time.Now(),
+	if cache.isClosed() {
+		return ErrClosed
 	}
 
-	// override the expiry for the key provided by the user
-	if params.Expiry > 0 {
-		value.expiry = params.Expiry
+	if err := cache.add(params, cache.config.Load().Expiry, cache.clock.Now()); err != nil {
+		return err
 	}
 
-	return cache.addInCache(params.Key, value)
+	if keyErrors := cache.publish(params.Key); len(keyErrors) > 0 {
+		return keyErrors[0]
+	}
+
+	return nil
 }
 
+// Get populates value with the cached data for the provided key.
+// Failures are reported as a *KeyError wrapping ErrNotFound, ErrExpired,
+// ErrDecrypt or ErrDecode; ErrDecode also wraps the json.Unmarshal error.
+// Returns ErrClosed once the cache has been closed.
 func (cache *Cache) Get(key any, value any) error {
-	if _, found := cache.get(key, value); !found {
-		return errors.New("key not found in the cache")
+	if cache.isClosed() {
+		return ErrClosed
 	}
 
-	return nil
+	// The decrypted value isn't returned, so it is decrypted into a pooled buffer.
+	var scratch *[]byte
+	if cache.obfuscator != nil {
+		scratch = getScratch()
+		defer putScratch(scratch)
+	}
+
+	res, err := cache.fetch(key, value, cache.clock.Now(), scratch)
+	cache.wipe(res)
+
+	return err
 }
 
-// Remove the provided key from the cache.
-func (cache *Cache) Remove(key any) {
-	cache.cacheMap.Delete(key)
+// GetBytes appends the JSON encoding of the value cached for the provided key
+// to dst and returns the updated slice, so the caller owns the only plaintext
+// copy and can zero it once done. An obfuscated cache zeroes every intermediate
+// buffer; a non-obfuscated cache JSON-encodes the stored value.
+// Failures are reported as for Get, with dst returned unchanged.
+func (cache *Cache) GetBytes(key any, dst []byte) ([]byte, error) {
+	if cache.isClosed() {
+		return dst, ErrClosed
+	}
+
+	var scratch *[]byte
+	if cache.obfuscator != nil {
+		scratch = getScratch()
+		defer putScratch(scratch)
+	}
+
+	res, err := cache.fetch(key, nil, cache.clock.Now(), scratch)
+	if err != nil {
+		return dst, err
+	}
+
+	if cache.obfuscator != nil {
+		defer cache.wipe(res)
+
+		return append(dst, res.Value.([]byte)...), nil
+	}
+
+	data, err := json.Marshal(res.Value)
+	if err != nil {
+		return dst, newKeyError(key, ErrDecode, err)
+	}
+
+	defer clear(data)
+
+	return append(dst, data...), nil
+}
+
+// Remove the provided key from the cache, and from the store of a cache
+// created with one. The key is removed from the cache even if the store fails.
+// Returns a *KeyError wrapping ErrStore if the store fails, or ErrInvalidation
+// if the Invalidator fails, and ErrClosed once the cache has been closed.
+func (cache *Cache) Remove(key any) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	err := cache.delete(key)
+	cache.remove(key)
+
+	if keyErrors := cache.publish(key); len(keyErrors) > 0 && err == nil {
+		return keyErrors[0]
+	}
+
+	return err
+}
+
+// Clear wipes all cached entries. Unlike Close, the cache stays usable: the
+// background cleaner keeps running and an obfuscated cache keeps its key.
+// The entries of namespaces are left untouched: clear them independently.
+// Returns a *BatchError wrapping ErrInvalidation for the removed keys if
+// publishing their invalidation fails, and ErrClosed once the cache has been closed.
+func (cache *Cache) Clear() error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	batchError := BatchError{Errors: cache.publish(cache.clear()...)}
+
+	return batchError.err()
 }
 
-// Clean cancels the background cleaner goroutine, wipes all cached entries,
-// and removes the obfuscator.
+// Close cancels the background cleaner goroutine, waits for it to exit and
+// wipes all cached entries, including those of namespaces. An obfuscated cache
+// also zeroes its key. See Namespace for closing a namespace.
+// A write-behind cache first flushes its pending writes, and returns an error
+// wrapping ErrStore for the writes the store fails; they are dropped.
 //
-// IMPORTANT: Clean is a terminal operation. The cache MUST NOT be used after
-// calling Clean; the background cleaner goroutine will not restart. Create a
-// fresh instance with NewCache if further caching is required.
-func (cache *Cache) Clean() {
-	cache.cacheCtx.cancelFunc()
+// Close is a terminal operation: every later operation returns ErrClosed,
+// including a second Close. Create a fresh instance with NewCache if further
+// caching is required.
+func (cache *Cache) Close() error {
+	if !cache.isRoot() {
+		return cache.closeNamespace()
+	}
+
+	if !cache.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+
+	cache.cancelFunc()
+	cache.routines.Wait()
+
+	var err error
+	if cache.writes != nil {
+		err = cache.writes.close(cache.backend)
+	}
+
 	cache.cacheMap.Clear()
+	cache.reset()
+
+	cache.namespaces.Range(func(_, namespace any) bool {
+		namespace.(*Cache).reset()
+
+		return true
+	})
+
+	if cache.obfuscator != nil {
+		_ = cache.obfuscator.Close()
+	}
+
+	return err
+}
 
-	cache.obfuscator = nil
+// Clean shuts the cache down.
+//
+// Deprecated: Clean is terminal; use Clear to wipe entries and keep using the
+// cache, or Close to shut it down.
+func (cache *Cache) Clean() {
+	_ = cache.Close()
 }
 
 func (cache *Cache) RLock() {
@@ -206,71 +533,321 @@ func (cache *Cache) Unlock() {
 	cache.lock.Unlock()
 }
 
-// addInCache adds the value in the cache for the provided key
-// It also obfuscates the value if cache is obfuscated
+// isClosed reports whether the cache has been shut down by Close
+func (cache *Cache) isClosed() bool {
+	return cache.closed.Load() || cache.detached.Load()
+}
+
+// isRoot reports whether cache is the root cache rather than a namespace
+func (cache *Cache) isRoot() bool {
+	return cache == cache.root
+}
+
+// load returns the entry of the cache stored for the provided key, expired or not
+func (cache *Cache) load(key any) (*cacheEntry, bool) {
+	value, found := cache.cacheMap.Load(cache.mapKey(key))
+	if !found {
+		return nil, false
+	}
+
+	entry, ok := value.(*cacheEntry)
+	if !ok || entry.owner != cache {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// remove deletes the provided key from the cache map
+func (cache *Cache) remove(key any) {
+	if entry, loaded := cache.loadAndDelete(key); loaded {
+		removed(key, entry)
+	}
+}
+
+// removeEntry deletes the provided key only if it still maps to entry, so an
+// expired entry being evicted never takes a concurrently added one with it.
+// It reports whether entry was removed.
+func (cache *Cache) removeEntry(key any, entry any) bool {
+	if !cache.compareAndDelete(key, entry, EventRemove) {
+		return false
+	}
+
+	removed(key, entry)
+
+	return true
+}
+
+// evict removes the expired entry for the provided key, as removeEntry does,
+// and counts the eviction
+func (cache *Cache) evict(key any, entry *cacheEntry) {
+	if cache.compareAndDelete(key, entry, EventExpire) {
+		removed(key, entry)
+		cache.stats.evictions.Add(1)
+	}
+}
+
+// removed updates the cache owning an entry that has left the cache map, and
+// removes the entries depending on it
+func removed(key any, value any) {
+	if entry, ok := value.(*cacheEntry); ok {
+		entry.owner.forget(key, entry)
+		entry.owner.cascade(key)
+	}
+}
+
+// forget updates the length and the secondary indexes of the cache for an
+// entry that has left the cache map
+func (cache *Cache) forget(key any, entry *cacheEntry) {
+	cache.length.Add(-1)
+	cache.tags.remove(key, entry.tags)
+	cache.dependents.remove(key, entry.dependsOn)
+}
+
+// addInCache adds the value in the cache for the provided key, as a new version.
+// It also compresses and obfuscates the value if cache is obfuscated
 func (cache *Cache) addInCache(key any, value *cacheEntry) error {
-	if cache.obfuscator != nil {
-		insertValue, err := json.Marshal(&value.value)
+	if err := cache.prepare(key, value); err != nil {
+		return err
+	}
+
+	cache.put(key, value)
+
+	return nil
+}
+
+// add stores the entry described by params, as Add does, writing it through
+// the store once it is ready to be stored
+func (cache *Cache) add(params *AddCacheParams, expiry time.Duration, now time.Time) error {
+	value := newEntry(params, expiry, now)
+	if err := cache.prepare(params.Key, value); err != nil {
+		return err
+	}
+
+	if err := cache.save(params.Key, params.Value); err != nil {
+		return err
+	}
+
+	cache.put(params.Key, value)
+
+	return nil
+}
+
+// prepare checks the dependencies of a new entry for key and encodes its value,
+// as a new version
+func (cache *Cache) prepare(key any, value *cacheEntry) error {
+	if err := cache.checkKey(key); err != nil {
+		return err
+	}
+
+	if err := cache.checkDependencies(key, value.dependsOn); err != nil {
+		return err
+	}
+
+	var err error
+	if value.value, err = cache.encode(key, value.value); err != nil {
+		return err
+	}
+
+	value.version = cache.versions.Add(1)
+	value.owner = cache
+
+	return nil
+}
+
+// put stores a prepared entry for key, replacing the previous one
+func (cache *Cache) put(key any, value *cacheEntry) {
+	// Index the entry before it becomes visible, so the indexes cover every live entry.
+	cache.tags.add(key, value.tags)
+	cache.dependents.add(key, value.dependsOn)
+	cache.length.Add(1)
+
+	if previous, loaded := cache.swap(key, value); loaded {
+		removed(key, previous)
+	}
+
+	cache.stats.adds.Add(1)
+}
+
+// clear removes every entry of the cache. Returns the removed keys.
+func (cache *Cache) clear() []any {
+	var removed []any
+
+	cache.rangeEntries(func(key any, entry *cacheEntry) bool {
+		if cache.removeEntry(key, entry) {
+			removed = append(removed, key)
+		}
+
+		return true
+	})
+
+	return removed
+}
+
+// reset forgets the entries of the cache once the cache map has been cleared
+func (cache *Cache) reset() {
+	cache.length.Store(0)
+	cache.tags.reset()
+	cache.dependents.reset()
+}
+
+// rangeEntries calls fn for every entry of the cache, expired or not, until fn
+// returns false. Keys are those of the cache, without namespace.
+func (cache *Cache) rangeEntries(fn func(key any, entry *cacheEntry) bool) {
+	cache.cacheMap.Range(func(key, value any) bool {
+		entry, ok := value.(*cacheEntry)
+		if !ok || entry.owner != cache {
+			return true
+		}
+
+		return fn(cache.userKey(key), entry)
+	})
+}
+
+// encode returns the value to store for the provided value: the value itself,
+// or the compressed and obfuscated JSON if cache is obfuscated
+func (cache *Cache) encode(key any, value any) (any, error) {
+	if cache.obfuscator == nil {
+		return value, nil
+	}
+
+	data, err := json.Marshal(&value)
+	if err != nil {
+		return nil, newKeyError(key, ErrEncode, err)
+	}
+
+	defer clear(data)
+
+	scratch := getScratch()
+	defer putScratch(scratch)
+
+	// Room for an uncompressed frame, so it is never copied to a larger array
+	insertValue, err := cache.compressor.compressTo(slices.Grow((*scratch)[:0], len(data)+1), data)
+	if err != nil {
+		return nil, newKeyError(key, ErrEncode, err)
+	}
+
+	*scratch = insertValue
+
+	obfuscatedValue, err := cache.obfuscator.Obfuscate(insertValue)
+	if err != nil {
+		return nil, newKeyError(key, ErrEncrypt, err)
+	}
+
+	return obfuscatedValue, nil
+}
+
+// modify atomically replaces the live entry for the provided key with the entry
+// returned by fn, which receives a copy of the current entry and the current time.
+// A nil entry removes the key. Stored entries are never mutated, as concurrent
+// readers may hold them, so fn is retried if the entry changes in the meantime.
+func (cache *Cache) modify(key any, fn func(entry cacheEntry, now time.Time) *cacheEntry) error {
+	for {
+		entry, err := cache.peek(key)
 		if err != nil {
+			if errors.Is(err, ErrExpired) {
+				cache.evict(key, entry)
+			}
+
 			return err
 		}
 
-		if value.value, err = cache.obfuscator.Obfuscate(insertValue); err != nil {
-			return err
+		updated := fn(*entry, cache.clock.Now())
+		if updated == nil {
+			cache.removeEntry(key, entry)
+
+			return nil
+		}
+
+		if cache.compareAndSwap(key, entry, updated) {
+			return nil
 		}
 	}
+}
 
-	cache.cacheMap.Store(key, value)
+// applyExpiry recomputes the deadline of every entry that inherited the
+// cache-wide expiry, counting the new expiry from the start of its current TTL.
+// Entries left as-is aren't replaced, so they aren't recorded as changed.
+func (cache *Cache) applyExpiry(expiry time.Duration) {
+	cache.rangeEntries(func(key any, entry *cacheEntry) bool {
+		if !entry.inheritsExpiry || entry.expiry == expiry {
+			return true
+		}
 
-	return nil
+		// Expired and concurrently removed entries are skipped.
+		_ = cache.modify(key, func(entry cacheEntry, _ time.Time) *cacheEntry {
+			if !entry.inheritsExpiry {
+				// Replaced in the meantime by an entry with its own expiry
+				return &entry
+			}
+
+			start := entry.ttlStart()
+			entry.expiry = expiry
+			entry.expiresAt = time.Time{}
+
+			if expiry > 0 {
+				entry.expiresAt = start.Add(expiry)
+			}
+
+			return &entry
+		})
+
+		return true
+	})
 }
 
 // clean removes the expired entries from the cache after a given interval.
 //
-// Uses time.NewTicker instead of time.After to avoid allocating a new timer on
-// every iteration. UpdateTime signals interval changes via intervalCh so the
-// ticker is reset immediately — no waiting for the current tick to expire.
+// Uses a Ticker from the cache clock instead of time.After to avoid allocating
+// a new timer on every iteration. Reconfigure signals configuration changes via
+// configCh so the ticker is reset immediately — no waiting for the current
+// tick to expire.
 //
-// If no cleanInterval is configured at construction, the goroutine blocks on
-// intervalCh until UpdateTime provides one, keeping the goroutine alive without
-// risking a time.NewTicker(0) panic.
-func (cache *Cache) clean() {
-	interval := cache.cleanInterval
-
-	// No interval configured yet — block until UpdateTime provides one or the
-	// cache is shut down.
-	if interval <= 0 {
-		select {
-		case <-cache.ctx.Done():
-			return
-		case interval = <-cache.intervalCh:
+// While no cleanInterval is configured, ticker is nil and the goroutine blocks
+// on configCh until Reconfigure provides one, keeping the goroutine alive
+// without risking a NewTicker(0) panic.
+func (cache *Cache) clean(ticker Ticker, interval time.Duration) {
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
 		}
-	}
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	}()
 
 	for {
+		// A nil channel blocks forever, disabling the sweep case.
+		var tick <-chan time.Time
+		if ticker != nil {
+			tick = ticker.C()
+		}
+
 		select {
 		case <-cache.ctx.Done():
 			return
 
-		// UpdateTime sent a new interval — reset the ticker immediately so
-		// the change takes effect on the very next cycle.
-		case newInterval := <-cache.intervalCh:
-			if newInterval > 0 && newInterval != interval {
-				interval = newInterval
-				ticker.Reset(interval)
+		// Reconfigure changed the configuration — apply the latest interval
+		// immediately so the change takes effect on the very next cycle.
+		case <-cache.configCh:
+			newInterval := cache.config.Load().CleanInterval
+
+			switch {
+			case newInterval == interval:
+			case newInterval <= 0:
+				ticker.Stop()
+				ticker = nil
+			case ticker == nil:
+				ticker = cache.clock.NewTicker(newInterval)
+			default:
+				ticker.Reset(newInterval)
 			}
 
-		case <-ticker.C:
+			interval = newInterval
+
+		case <-tick:
+			now := cache.clock.Now()
 			cache.cacheMap.Range(func(key, value any) bool {
 				entry, ok := value.(*cacheEntry)
-
-				// Use > 0 (not != defaultExpiry) so a zero-duration expiry is
-				// treated as "no expiry" rather than "immediately expired".
-				if ok && entry.expiry > 0 && time.Since(entry.insertionTime) > entry.expiry {
-					cache.Remove(key)
+				if ok && entry.isExpired(now) {
+					entry.owner.evict(entry.owner.userKey(key), entry)
 				}
 
 				// Always return true to continue iterating over all entries.
@@ -282,27 +859,56 @@ func (cache *Cache) clean() {
 }
 
 func (cache *Cache) get(key any, value any) (*GetCacheResponse, bool) {
-	valueFromCache, found := cache.cacheMap.Load(key)
-	if !found {
-		return nil, false
-	}
+	res, err := cache.lookup(key, value, cache.clock.Now(), nil)
 
-	entry, ok := valueFromCache.(*cacheEntry)
-	if !ok {
-		cache.Remove(key)
+	return res, err == nil
+}
 
-		return nil, false
+// lookup returns the entry for the provided key if it is live at now, decoding
+// it into value when the cache is obfuscated. Expired and undecryptable entries
+// are removed. See decode for scratch.
+func (cache *Cache) lookup(key any, value any, now time.Time, scratch *[]byte) (*GetCacheResponse, error) {
+	entry, err := cache.peekAt(key, now)
+	if err != nil {
+		if errors.Is(err, ErrExpired) {
+			cache.evict(key, entry)
+		}
+
+		return nil, err
 	}
 
-	// Use > 0 (not > defaultExpiry) so a zero-duration expiry is treated as
-	// "no expiry" rather than "immediately expired" (defaultExpiry is -1, so
-	// > defaultExpiry would also be true for expiry == 0).
-	if entry.expiry > 0 && time.Since(entry.insertionTime) > entry.expiry {
-		cache.Remove(key)
+	res, err := cache.decode(key, entry, value, scratch)
+	if errors.Is(err, ErrDecrypt) {
+		cache.removeEntry(key, entry)
+	}
 
-		return nil, false
+	return res, err
+}
+
+// peek returns the entry for the provided key without side effects. An expired
+// entry is returned together with ErrExpired so callers can evict it.
+func (cache *Cache) peek(key any) (*cacheEntry, error) {
+	return cache.peekAt(key, cache.clock.Now())
+}
+
+// peekAt is peek with expiry checked at now
+func (cache *Cache) peekAt(key any, now time.Time) (*cacheEntry, error) {
+	entry, found := cache.load(key)
+	if !found {
+		return nil, newKeyError(key, ErrNotFound, nil)
 	}
 
+	if entry.isExpired(now) {
+		return entry, newKeyError(key, ErrExpired, nil)
+	}
+
+	return entry, nil
+}
+
+// decode returns the value of the entry, decoding it into value when the cache
+// is obfuscated. When scratch is not nil the value is decrypted into it, so the
+// returned Value may alias scratch and must not be used once it is reused.
+func (cache *Cache) decode(key any, entry *cacheEntry, value any, scratch *[]byte) (*GetCacheResponse, error) {
 	if cache.obfuscator == nil {
 		// Populate *any dest for non-JSON types (e.g. CGo cipher objects).
 		if ptr, ok := value.(*any); ok && ptr != nil {
@@ -311,25 +917,122 @@ func (cache *Cache) get(key any, value any) (*GetCacheResponse, bool) {
 
 		return &GetCacheResponse{
 			Value: entry.value,
-		}, true
+		}, nil
 	}
 
-	var err error
+	ciphertext := entry.value.([]byte)
 
-	insertedValue := entry.value.([]byte)
-	if insertedValue, err = cache.obfuscator.Deobfuscate(insertedValue); err != nil {
-		cache.Remove(key)
+	var dst []byte
+	if scratch != nil {
+		// Room for the whole plaintext, so it is never copied to a larger array
+		dst = slices.Grow((*scratch)[:0], len(ciphertext))
+	}
 
-		return nil, false
+	plaintext, err := cache.obfuscator.OpenTo(dst, ciphertext)
+	if err != nil {
+		return nil, newKeyError(key, ErrDecrypt, err)
+	}
+
+	if scratch != nil {
+		*scratch = plaintext
+	} else if len(plaintext) > 0 && CompressionAlgorithm(plaintext[0]) != CompressionNone {
+		// A compressed plaintext is only an intermediate buffer
+		defer clear(plaintext)
+	}
+
+	insertedValue, err := cache.compressor.Decompress(plaintext)
+	if err != nil {
+		return nil, newKeyError(key, ErrDecode, err)
 	}
 
 	if value != nil {
 		if err = json.Unmarshal(insertedValue, value); err != nil {
-			return nil, false
+			clear(insertedValue)
+
+			return nil, newKeyError(key, ErrDecode, err)
 		}
 	}
 
 	return &GetCacheResponse{
 		Value: insertedValue,
-	}, true
+	}, nil
+}
+
+// getScratch returns a pooled scratch buffer, to be released with putScratch
+func getScratch() *[]byte {
+	return scratchBuffers.Get().(*[]byte)
+}
+
+// putScratch zeroes scratch and returns it to the pool, unless it grew too large to keep
+func putScratch(scratch *[]byte) {
+	clear(*scratch)
+
+	if cap(*scratch) > maxScratchSize {
+		return
+	}
+
+	*scratch = (*scratch)[:0]
+	scratchBuffers.Put(scratch)
+}
+
+// wipe zeroes the decrypted JSON of res, for an obfuscated cache, once it is no
+// longer needed. Values of non-obfuscated caches belong to the caller.
+func (cache *Cache) wipe(res *GetCacheResponse) {
+	if res == nil || cache.obfuscator == nil {
+		return
+	}
+
+	if data, ok := res.Value.([]byte); ok {
+		clear(data)
+	}
+}
+
+// newEntry returns the entry for params added at now, with the cache-wide expiry
+// unless params carries a per-key one
+func newEntry(params *AddCacheParams, expiry time.Duration, now time.Time) *cacheEntry {
+	entry := &cacheEntry{
+		value:          params.Value,
+		expiry:         expiry,
+		insertionTime:  now,
+		inheritsExpiry: true,
+	}
+
+	if len(params.Tags) > 0 {
+		entry.tags = slices.Compact(slices.Sorted(slices.Values(params.Tags)))
+	}
+
+	for _, dependency := range params.DependsOn {
+		if !slices.Contains(entry.dependsOn, dependency) {
+			entry.dependsOn = append(entry.dependsOn, dependency)
+		}
+	}
+
+	// override the expiry for the key provided by the user
+	if params.Expiry > 0 {
+		entry.expiry = params.Expiry
+		entry.inheritsExpiry = false
+	}
+
+	if entry.expiry > 0 {
+		entry.expiresAt = entry.insertionTime.Add(entry.expiry)
+	}
+
+	return entry
+}
+
+// ttlStart returns the start of the current TTL of the entry: its insertion
+// time, or the last time its expiry was restarted
+func (entry *cacheEntry) ttlStart() time.Time {
+	if entry.expiresAt.IsZero() {
+		return entry.insertionTime
+	}
+
+	return entry.expiresAt.Add(-entry.expiry)
+}
+
+// isExpired reports whether the deadline of the entry has passed at now: an
+// entry is still live at its deadline. Entries whose expiry is zero or
+// negative never get an expiresAt deadline.
+func (entry *cacheEntry) isExpired(now time.Time) bool {
+	return !entry.expiresAt.IsZero() && now.After(entry.expiresAt)
 }
@@ -1,11 +1,22 @@
 package caching
 
 import (
+	"compress/flate"
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -83,7 +94,9 @@ func TestService_Cache(test *testing.T) {
 		test.Parallel()
 
 		cacheExpiry := 5
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(cacheExpiry),
 			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
 		})
@@ -101,7 +114,7 @@ func TestService_Cache(test *testing.T) {
 			})
 			require.NoError(test, err)
 		}
-		time.Sleep(time.Second * time.Duration(cacheExpiry))
+		clock.Advance(time.Second*time.Duration(cacheExpiry) + time.Nanosecond)
 
 		cachedInfo := cache.GetAllCacheInfo()
 		// GetAllCacheInfo returns an empty map (not nil) when no live entries remain.
@@ -113,7 +126,9 @@ func TestService_Cache(test *testing.T) {
 		test.Parallel()
 
 		cacheExpiry := 5
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(cacheExpiry),
 			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
 		})
@@ -132,7 +147,7 @@ func TestService_Cache(test *testing.T) {
 			require.NoError(test, err)
 		}
 
-		time.Sleep(time.Second * time.Duration(cacheExpiry))
+		clock.Advance(time.Second*time.Duration(cacheExpiry) + time.Nanosecond)
 
 		cacheKeyValue2 := make(map[string]string)
 		cacheKeyValue2["key5"] = "val25"
@@ -213,7 +228,9 @@ func TestService_Cache(test *testing.T) {
 		test.Parallel()
 
 		expiryTime := 1
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(expiryTime),
 			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
 		})
@@ -229,7 +246,7 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(expiryTime))
+		clock.Advance(time.Second*time.Duration(expiryTime) + time.Nanosecond)
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.False(test, found)
@@ -289,7 +306,9 @@ func TestService_Cache(test *testing.T) {
 		test.Parallel()
 
 		cleanInterval := 1
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(testCacheExpiry),
 			CleanInterval: time.Second * time.Duration(cleanInterval),
 		})
@@ -305,7 +324,7 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval))
+		clock.Advance(time.Second * time.Duration(cleanInterval))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
@@ -319,7 +338,9 @@ func TestService_Cache(test *testing.T) {
 
 		cleanInterval := 1
 		expiry := 2
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(expiry),
 			CleanInterval: time.Second * time.Duration(cleanInterval),
 		})
@@ -335,14 +356,14 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval))
+		clock.Advance(time.Second * time.Duration(cleanInterval))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval+1))
+		clock.Advance(time.Second * time.Duration(cleanInterval+1))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.False(test, found)
@@ -355,7 +376,9 @@ func TestService_Cache(test *testing.T) {
 
 		cleanInterval := 1
 		expiry := 10
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(expiry),
 			CleanInterval: time.Second * time.Duration(cleanInterval),
 		})
@@ -371,14 +394,14 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval))
+		clock.Advance(time.Second * time.Duration(cleanInterval))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval+1))
+		clock.Advance(time.Second * time.Duration(cleanInterval+1))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
@@ -400,7 +423,9 @@ func TestService_Cache(test *testing.T) {
 
 		cleanInterval := 3
 		expiry := 2
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(expiry),
 			CleanInterval: time.Second * time.Duration(cleanInterval),
 		})
@@ -416,7 +441,7 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(expiry-1))
+		clock.Advance(time.Second * time.Duration(expiry-1))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
@@ -426,7 +451,7 @@ func TestService_Cache(test *testing.T) {
 		cache.UpdateTime(&UpdateCacheTimeParams{
 			Expiry: time.Second * time.Duration(cleanInterval),
 		})
-		time.Sleep(time.Second * time.Duration(1))
+		clock.Advance(time.Second*time.Duration(1) + time.Nanosecond)
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.False(test, found)
@@ -438,7 +463,9 @@ func TestService_Cache(test *testing.T) {
 		test.Parallel()
 
 		cleanInterval := 1
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			CleanInterval: time.Second * time.Duration(cleanInterval),
 		})
 
@@ -453,14 +480,14 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval))
+		clock.Advance(time.Second * time.Duration(cleanInterval))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval))
+		clock.Advance(time.Second * time.Duration(cleanInterval))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
@@ -474,7 +501,9 @@ func TestService_Cache(test *testing.T) {
 
 		cleanInterval := 1
 		expiry := 1
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			CleanInterval: time.Second * time.Duration(cleanInterval),
 		})
 
@@ -489,7 +518,7 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval))
+		clock.Advance(time.Second * time.Duration(cleanInterval))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
@@ -500,7 +529,7 @@ func TestService_Cache(test *testing.T) {
 			Expiry: time.Second * time.Duration(expiry),
 		})
 
-		time.Sleep(time.Second * time.Duration(cleanInterval))
+		clock.Advance(time.Second * time.Duration(cleanInterval))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
@@ -520,7 +549,7 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval+1))
+		clock.Advance(time.Second * time.Duration(cleanInterval+1))
 
 		getCachedValue, found = cache.get(newCacheKey, &testCacheValue)
 		require.False(test, found)
@@ -538,7 +567,9 @@ func TestService_Cache(test *testing.T) {
 
 		cleanInterval := 2
 		expiry := 2
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			CleanInterval: time.Second * time.Duration(cleanInterval),
 		})
 
@@ -554,14 +585,14 @@ func TestService_Cache(test *testing.T) {
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval-1))
+		clock.Advance(time.Second * time.Duration(cleanInterval-1))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
 
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
-		time.Sleep(time.Second * time.Duration(cleanInterval))
+		clock.Advance(time.Second * time.Duration(cleanInterval))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.False(test, found)
@@ -756,7 +787,9 @@ func TestService_Cache(test *testing.T) {
 		test.Parallel()
 
 		shortClean := 1
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        0, // explicitly zero → must use defaultExpiry = -1
 			CleanInterval: time.Second * time.Duration(shortClean),
 		})
@@ -772,7 +805,7 @@ func TestService_Cache(test *testing.T) {
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
 		// Wait for several clean cycles — entry must still be present.
-		time.Sleep(time.Second * time.Duration(shortClean*3))
+		clock.Advance(time.Second * time.Duration(shortClean*3))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.True(test, found)
@@ -788,7 +821,9 @@ func TestService_Cache(test *testing.T) {
 		// Start with a very long clean interval so the cleaner won't fire on its own.
 		longClean := 60
 		shortExpiry := 1
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(shortExpiry),
 			CleanInterval: time.Second * time.Duration(longClean),
 		})
@@ -807,15 +842,13 @@ func TestService_Cache(test *testing.T) {
 		// Switch to a short clean interval while also lowering the expiry so
 		// the next fresh entry we add will expire quickly.
 		newClean := 1
-		cache.Lock()
 		cache.UpdateTime(&UpdateCacheTimeParams{
 			Expiry:        time.Second * time.Duration(shortExpiry),
 			CleanInterval: time.Second * time.Duration(newClean),
 		})
-		cache.Unlock()
 
-		// Verify the cache field was updated.
-		require.Equal(test, time.Second*time.Duration(newClean), cache.cleanInterval)
+		// Verify the configuration was updated.
+		require.Equal(test, time.Second*time.Duration(newClean), cache.Options().CleanInterval)
 
 		// Add a fresh entry that will expire after shortExpiry.
 		freshKey := "freshKey"
@@ -826,7 +859,7 @@ func TestService_Cache(test *testing.T) {
 		require.NoError(test, err)
 
 		// Wait for the new (short) clean interval to fire and remove the expired entry.
-		time.Sleep(time.Second * time.Duration(shortExpiry+newClean+1))
+		clock.Advance(time.Second * time.Duration(shortExpiry+newClean+1))
 
 		// Background cleaner should have evicted the fresh entry.
 		getCachedValue, found = cache.get(freshKey, &testCacheValue)
@@ -835,14 +868,16 @@ func TestService_Cache(test *testing.T) {
 	})
 
 	// 3. When no CleanInterval is set at construction, the clean() goroutine blocks
-	//    on intervalCh.  Supplying one via UpdateTime should start the ticker.
+	//    on configCh.  Supplying one via UpdateTime should start the ticker.
 	test.Run("cache with no initial CleanInterval starts cleaning after UpdateTime provides one", func(test *testing.T) {
 		defer flumetest.Start(test)
 		test.Parallel()
 
 		expiry := 1
-		// No CleanInterval → clean() goroutine blocks on intervalCh.
+		// No CleanInterval → clean() goroutine blocks on configCh.
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:  clock,
 			Expiry: time.Second * time.Duration(expiry),
 		})
 
@@ -858,7 +893,7 @@ func TestService_Cache(test *testing.T) {
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 
 		// Wait past expiry — get() itself detects and removes the expired entry.
-		time.Sleep(time.Second * time.Duration(expiry+1))
+		clock.Advance(time.Second * time.Duration(expiry+1))
 
 		getCachedValue, found = cache.get(testCacheKey, &testCacheValue)
 		require.False(test, found)
@@ -874,15 +909,13 @@ func TestService_Cache(test *testing.T) {
 		require.NoError(test, err)
 
 		newClean := 1
-		cache.Lock()
 		cache.UpdateTime(&UpdateCacheTimeParams{
 			Expiry:        time.Second * time.Duration(expiry),
 			CleanInterval: time.Second * time.Duration(newClean),
 		})
-		cache.Unlock()
 
 		// Wait for the goroutine to run one tick and evict the expired entry.
-		time.Sleep(time.Second * time.Duration(expiry+newClean+1))
+		clock.Advance(time.Second * time.Duration(expiry+newClean+1))
 
 		getCachedValue, found = cache.get(newKey, &testCacheValue)
 		require.False(test, found)
@@ -890,12 +923,12 @@ func TestService_Cache(test *testing.T) {
 	})
 
 	// 4. Clean() must properly shut down the goroutine even when it is still
-	//    blocking on intervalCh (i.e. no CleanInterval was ever configured).
+	//    blocking on configCh (i.e. no CleanInterval was ever configured).
 	test.Run("Clean terminates goroutine when no CleanInterval was set", func(test *testing.T) {
 		defer flumetest.Start(test)
 		test.Parallel()
 
-		// Goroutine will block on intervalCh; Clean() must cancel the context.
+		// Goroutine will block on configCh; Clean() must cancel the context.
 		cache := NewCache(&CreateCacheParams{
 			Expiry: time.Second * time.Duration(testCacheExpiry),
 			// No CleanInterval.
@@ -962,7 +995,8 @@ func TestService_Cache(test *testing.T) {
 		var dest any
 		err := cache.Get("nonExistentKey", &dest)
 		require.Error(test, err)
-		require.EqualError(test, err, "key not found in the cache")
+		require.ErrorIs(test, err, ErrNotFound)
+		require.EqualError(test, err, "key nonExistentKey: key not found in the cache")
 		require.Nil(test, dest)
 	})
 
@@ -974,7 +1008,9 @@ func TestService_Cache(test *testing.T) {
 
 		cacheExpiry := 10
 		perKeyExpiry := 1
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(cacheExpiry),
 			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
 		})
@@ -1004,7 +1040,7 @@ func TestService_Cache(test *testing.T) {
 		require.True(test, found)
 
 		// After the short per-key expiry, shortKey must be gone but longKey survives.
-		time.Sleep(time.Second * time.Duration(perKeyExpiry+1))
+		clock.Advance(time.Second * time.Duration(perKeyExpiry+1))
 
 		getCachedValue, found := cache.get(shortKey, &testCacheValue)
 		require.False(test, found)
@@ -1023,7 +1059,9 @@ func TestService_Cache(test *testing.T) {
 
 		cacheExpiry := 1
 		perKeyExpiry := 5
+		clock := NewFakeClock(time.Now())
 		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
 			Expiry:        time.Second * time.Duration(cacheExpiry),
 			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
 		})
@@ -1053,7 +1091,7 @@ func TestService_Cache(test *testing.T) {
 		require.True(test, found)
 
 		// After the cache-level expiry, shortKey is gone but longKey (per-key) still lives.
-		time.Sleep(time.Second * time.Duration(cacheExpiry+1))
+		clock.Advance(time.Second * time.Duration(cacheExpiry+1))
 
 		getCachedValue, found := cache.get(shortKey, &testCacheValue)
 		require.False(test, found)
@@ -1092,3 +1130,3036 @@ func TestService_Cache(test *testing.T) {
 		require.Equal(test, testCacheValue.Value, getCachedValue.Value.(*testStruct).Value)
 	})
 }
+
+func TestService_Compression(test *testing.T) {
+	defer flumetest.Start(test)
+
+	largeValue := &testStruct{
+		Value: strings.Repeat("compressible value ", 1024),
+	}
+
+	for _, algorithm := range []CompressionAlgorithm{CompressionFlate, CompressionGzip, CompressionZlib} {
+		test.Run(fmt.Sprintf("round trip large value with algorithm %d", algorithm), func(test *testing.T) {
+			defer flumetest.Start(test)
+			test.Parallel()
+
+			cache := NewCache(&CreateCacheParams{
+				Expiry:            time.Second * time.Duration(testCacheExpiry),
+				CleanInterval:     time.Second * time.Duration(testCacheCleanInterval),
+				IsCacheObfuscated: true,
+				Compression: CompressionParams{
+					Algorithm: algorithm,
+					Level:     flate.BestCompression,
+				},
+			})
+
+			err := cache.Add(&AddCacheParams{
+				Key:   testCacheKey,
+				Value: largeValue,
+			})
+			require.NoError(test, err)
+
+			rawJSON, err := json.Marshal(largeValue)
+			require.NoError(test, err)
+
+			// The encrypted entry must be much smaller than the raw JSON document.
+			stored, found := cache.cacheMap.Load(testCacheKey)
+			require.True(test, found)
+			require.Less(test, len(stored.(*cacheEntry).value.([]byte)), len(rawJSON)/10)
+
+			var getValue testStruct
+			err = cache.Get(testCacheKey, &getValue)
+			require.NoError(test, err)
+			require.Equal(test, largeValue.Value, getValue.Value)
+		})
+	}
+
+	test.Run("values below the minimum size are stored uncompressed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Second * time.Duration(testCacheExpiry),
+			CleanInterval:     time.Second * time.Duration(testCacheCleanInterval),
+			IsCacheObfuscated: true,
+			Compression: CompressionParams{
+				Algorithm: CompressionGzip,
+				MinSize:   1024,
+			},
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		stored, found := cache.cacheMap.Load(testCacheKey)
+		require.True(test, found)
+
+		payload, err := cache.obfuscator.Deobfuscate(stored.(*cacheEntry).value.([]byte))
+		require.NoError(test, err)
+		require.Equal(test, byte(CompressionNone), payload[0])
+
+		getCachedValue, found := cache.get(testCacheKey, nil)
+		require.True(test, found)
+
+		var expectedValue testStruct
+		err = json.Unmarshal(getCachedValue.Value.([]byte), &expectedValue)
+		require.NoError(test, err)
+		require.Equal(test, testCacheValue.Value, expectedValue.Value)
+	})
+
+	test.Run("compressed and uncompressed entries coexist", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		compressor, err := NewCompressor(CompressionParams{
+			Algorithm: CompressionZlib,
+			MinSize:   64,
+		})
+		require.NoError(test, err)
+
+		small := []byte(`"small"`)
+		large := []byte(strings.Repeat("a", 4096))
+
+		smallPayload, err := compressor.Compress(small)
+		require.NoError(test, err)
+		require.Equal(test, byte(CompressionNone), smallPayload[0])
+
+		largePayload, err := compressor.Compress(large)
+		require.NoError(test, err)
+		require.Equal(test, byte(CompressionZlib), largePayload[0])
+
+		// A compressor with different settings must still read both payloads.
+		reader, err := NewCompressor(CompressionParams{})
+		require.NoError(test, err)
+
+		decompressed, err := reader.Decompress(smallPayload)
+		require.NoError(test, err)
+		require.Equal(test, small, decompressed)
+
+		decompressed, err = reader.Decompress(largePayload)
+		require.NoError(test, err)
+		require.Equal(test, large, decompressed)
+
+		_, err = reader.Decompress([]byte{0xff})
+		require.Error(test, err)
+	})
+
+	test.Run("invalid settings are rejected, and disable compression in NewCache", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		for _, params := range []CompressionParams{
+			{Algorithm: CompressionGzip, Level: flate.BestCompression + 1},
+			{Algorithm: CompressionZlib, Level: flate.HuffmanOnly - 1},
+			{Algorithm: CompressionZlib + 1},
+		} {
+			_, err := NewCompressor(params)
+			require.ErrorIs(test, err, ErrInvalidOptions)
+
+			cache := NewCache(&CreateCacheParams{IsCacheObfuscated: true, Compression: params})
+			require.NoError(test, cache.Add(&AddCacheParams{Key: testCacheKey, Value: strings.Repeat("a", 4096)}))
+
+			var value string
+			require.NoError(test, cache.Get(testCacheKey, &value))
+			require.Equal(test, strings.Repeat("a", 4096), value)
+			require.NoError(test, cache.Close())
+		}
+
+		_, err := NewCompressor(CompressionParams{Algorithm: CompressionFlate, Level: flate.HuffmanOnly})
+		require.NoError(test, err)
+	})
+
+	test.Run("outgrown buffers are zeroed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		initial := make([]byte, 0, 8)
+		buffer := &wipingBuffer{data: initial}
+
+		_, err := buffer.Write([]byte("secret"))
+		require.NoError(test, err)
+		_, err = buffer.ReadFrom(strings.NewReader(" plaintext"))
+		require.NoError(test, err)
+
+		require.Equal(test, "secret plaintext", string(buffer.data))
+		require.Equal(test, make([]byte, 8), initial[:8])
+
+		// Incompressible data outgrows its buffer, then is stored as is in it.
+		compressor, err := NewCompressor(CompressionParams{Algorithm: CompressionFlate})
+		require.NoError(test, err)
+
+		data := make([]byte, 1024)
+		_, _ = rand.Read(data)
+
+		buf := make([]byte, 0, len(data)+1)
+		payload, err := compressor.compressTo(buf, data)
+		require.NoError(test, err)
+		require.Equal(test, append([]byte{byte(CompressionNone)}, data...), payload)
+		require.Same(test, &buf[:1][0], &payload[0])
+	})
+}
+
+func TestService_Errors(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("missing key returns a KeyError wrapping ErrNotFound", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Second * time.Duration(testCacheExpiry),
+			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
+		})
+
+		var dest any
+		err := cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrNotFound)
+
+		var keyErr *KeyError
+		require.ErrorAs(test, err, &keyErr)
+		require.Equal(test, testCacheKey, keyErr.Key)
+
+		err = cache.Update(&UpdateCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.ErrorIs(test, err, ErrNotFound)
+		require.ErrorAs(test, err, &keyErr)
+		require.Equal(test, testCacheKey, keyErr.Key)
+	})
+
+	test.Run("expired key returns ErrExpired once and ErrNotFound afterwards", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
+			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:    testCacheKey,
+			Value:  testCacheValue,
+			Expiry: time.Millisecond,
+		})
+		require.NoError(test, err)
+
+		clock.Advance(time.Millisecond * 5)
+
+		var dest any
+		err = cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrExpired)
+
+		err = cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrNotFound)
+	})
+
+	test.Run("tampered value returns ErrDecrypt", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Second * time.Duration(testCacheExpiry),
+			CleanInterval:     time.Second * time.Duration(testCacheCleanInterval),
+			IsCacheObfuscated: true,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		stored, found := cache.cacheMap.Load(testCacheKey)
+		require.True(test, found)
+
+		ciphertext := stored.(*cacheEntry).value.([]byte)
+		ciphertext[len(ciphertext)-1] ^= 0xff
+
+		var dest testStruct
+		err = cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrDecrypt)
+	})
+
+	test.Run("mismatched destination returns ErrDecode with the unmarshal error", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Second * time.Duration(testCacheExpiry),
+			CleanInterval:     time.Second * time.Duration(testCacheCleanInterval),
+			IsCacheObfuscated: true,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: "not a number",
+		})
+		require.NoError(test, err)
+
+		var dest int
+		err = cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrDecode)
+
+		var unmarshalErr *json.UnmarshalTypeError
+		require.ErrorAs(test, err, &unmarshalErr)
+	})
+
+	test.Run("unencodable value returns ErrEncode", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Second * time.Duration(testCacheExpiry),
+			CleanInterval:     time.Second * time.Duration(testCacheCleanInterval),
+			IsCacheObfuscated: true,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: make(chan int),
+		})
+		require.ErrorIs(test, err, ErrEncode)
+
+		var unsupportedErr *json.UnsupportedTypeError
+		require.ErrorAs(test, err, &unsupportedErr)
+	})
+
+	test.Run("operations after Clean return ErrClosed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Second * time.Duration(testCacheExpiry),
+			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
+		})
+
+		cache.Clean()
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.ErrorIs(test, err, ErrClosed)
+
+		var dest any
+		err = cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrClosed)
+
+		err = cache.Update(&UpdateCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.ErrorIs(test, err, ErrClosed)
+	})
+}
+
+func TestService_Lifecycle(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("Clear wipes entries but keeps the cache usable", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Second * time.Duration(testCacheExpiry),
+			CleanInterval:     time.Second * time.Duration(testCacheCleanInterval),
+			IsCacheObfuscated: true,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		err = cache.Clear()
+		require.NoError(test, err)
+
+		var dest testStruct
+		err = cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrNotFound)
+
+		// The obfuscator survives Clear, so new values are still encrypted.
+		err = cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		stored, found := cache.cacheMap.Load(testCacheKey)
+		require.True(test, found)
+		require.IsType(test, []byte{}, stored.(*cacheEntry).value)
+
+		err = cache.Get(testCacheKey, &dest)
+		require.NoError(test, err)
+		require.Equal(test, testCacheValue.Value, dest.Value)
+
+		require.NoError(test, cache.ctx.Err())
+	})
+
+	test.Run("Close stops the cleaner and rejects later operations", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Second * time.Duration(testCacheExpiry),
+			CleanInterval:     time.Second * time.Duration(testCacheCleanInterval),
+			IsCacheObfuscated: true,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		var closer io.Closer = cache
+
+		require.NoError(test, closer.Close())
+		require.Error(test, cache.ctx.Err())
+		require.ErrorIs(test, closer.Close(), ErrClosed)
+
+		err = cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.ErrorIs(test, err, ErrClosed)
+
+		_, found := cache.cacheMap.Load(testCacheKey)
+		require.False(test, found)
+
+		require.ErrorIs(test, cache.Remove(testCacheKey), ErrClosed)
+		require.ErrorIs(test, cache.Clear(), ErrClosed)
+		require.Empty(test, cache.GetAllCacheInfo())
+	})
+}
+
+func TestService_Clock(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("fake clock drives lazy expiry", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry: time.Minute,
+			Clock:  clock,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		// Entries are still live at their deadline, and expire right after it.
+		clock.Advance(time.Minute)
+
+		_, found := cache.get(testCacheKey, nil)
+		require.True(test, found)
+
+		clock.Advance(time.Nanosecond)
+
+		_, found = cache.get(testCacheKey, nil)
+		require.False(test, found)
+	})
+
+	test.Run("fake clock drives the background sweep", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Minute,
+			CleanInterval: time.Minute,
+			Clock:         clock,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		clock.Advance(time.Minute + time.Nanosecond)
+
+		// Only the sweep removes the entry: the map is inspected directly so
+		// that lazy expiry in get() can't hide a missed tick.
+		require.Eventually(test, func() bool {
+			_, found := cache.cacheMap.Load(testCacheKey)
+
+			return !found
+		}, time.Second, time.Millisecond)
+	})
+
+	test.Run("fake ticker fires once per Advance and honours Stop and Reset", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		ticker := clock.NewTicker(time.Second)
+
+		clock.Advance(time.Second * 3)
+		require.Len(test, ticker.C(), 1)
+		<-ticker.C()
+
+		// Stopped tickers are forgotten by the clock until reset.
+		ticker.Stop()
+		ticker.Stop()
+		require.Empty(test, clock.tickers)
+		clock.Advance(time.Second)
+		require.Empty(test, ticker.C())
+
+		ticker.Reset(time.Second * 2)
+		ticker.Reset(time.Second * 2)
+		require.Len(test, clock.tickers, 1)
+		clock.Advance(time.Second)
+		require.Empty(test, ticker.C())
+
+		clock.Advance(time.Second)
+		require.Len(test, ticker.C(), 1)
+
+		require.Panics(test, func() {
+			clock.NewTicker(0)
+		})
+	})
+}
+
+func TestService_Iterators(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("All and Keys skip expired entries", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry: time.Minute,
+			Clock:  clock,
+		})
+
+		for key, expiry := range map[string]time.Duration{"short": time.Second, "long": time.Hour} {
+			err := cache.Add(&AddCacheParams{
+				Key:    key,
+				Value:  key + "-value",
+				Expiry: expiry,
+			})
+			require.NoError(test, err)
+		}
+
+		clock.Advance(time.Second + time.Nanosecond)
+
+		entries := make(map[any]any)
+		for key, value := range cache.All() {
+			entries[key] = value
+		}
+
+		require.Equal(test, map[any]any{"long": "long-value"}, entries)
+		require.Equal(test, []any{"long"}, slices.Collect(cache.Keys()))
+	})
+
+	test.Run("Scan only decrypts entries accepted by the filter", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Second * time.Duration(testCacheExpiry),
+			CleanInterval:     time.Second * time.Duration(testCacheCleanInterval),
+			IsCacheObfuscated: true,
+		})
+
+		for _, key := range []string{"tenant-a:1", "tenant-a:2", "tenant-b:1"} {
+			err := cache.Add(&AddCacheParams{
+				Key:   key,
+				Value: key,
+			})
+			require.NoError(test, err)
+		}
+
+		// Tamper with the rejected entry: decrypting it would remove it.
+		stored, found := cache.cacheMap.Load("tenant-b:1")
+		require.True(test, found)
+
+		ciphertext := stored.(*cacheEntry).value.([]byte)
+		ciphertext[len(ciphertext)-1] ^= 0xff
+
+		entries := make(map[any]string)
+		for key, value := range cache.Scan(func(key any) bool {
+			return strings.HasPrefix(key.(string), "tenant-a:")
+		}) {
+			entries[key] = string(value.([]byte))
+		}
+
+		require.Equal(test, map[any]string{
+			"tenant-a:1": `"tenant-a:1"`,
+			"tenant-a:2": `"tenant-a:2"`,
+		}, entries)
+
+		_, found = cache.cacheMap.Load("tenant-b:1")
+		require.True(test, found)
+	})
+
+	test.Run("iteration stops when the consumer breaks", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Second * time.Duration(testCacheExpiry),
+			CleanInterval: time.Second * time.Duration(testCacheCleanInterval),
+		})
+
+		for i := range 10 {
+			err := cache.Add(&AddCacheParams{
+				Key:   i,
+				Value: i,
+			})
+			require.NoError(test, err)
+		}
+
+		visited := 0
+		for range cache.Scan(func(any) bool {
+			visited++
+
+			return true
+		}) {
+			break
+		}
+
+		require.Equal(test, 1, visited)
+
+		keys := 0
+		for range cache.Keys() {
+			keys++
+			if keys == 3 {
+				break
+			}
+		}
+
+		require.Equal(test, 3, keys)
+
+		require.NoError(test, cache.Close())
+		require.Empty(test, slices.Collect(cache.Keys()))
+	})
+}
+
+func TestService_Introspection(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("TTL reports the time left before expiry", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry: time.Minute,
+			Clock:  clock,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		cache.UpdateTime(&UpdateCacheTimeParams{})
+
+		err = cache.Add(&AddCacheParams{
+			Key:   "persistent",
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		clock.Advance(time.Second * 20)
+
+		ttl, found := cache.TTL(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, time.Second*40, ttl)
+
+		ttl, found = cache.TTL("persistent")
+		require.True(test, found)
+		require.Negative(test, ttl)
+
+		_, found = cache.TTL("missing")
+		require.False(test, found)
+
+		clock.Advance(time.Second*40 + time.Nanosecond)
+
+		_, found = cache.TTL(testCacheKey)
+		require.False(test, found)
+	})
+	test.Run("Peek reads without evicting expired or undecryptable entries", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Minute,
+			IsCacheObfuscated: true,
+			Clock:             clock,
+		})
+
+		for _, key := range []string{testCacheKey, "tampered"} {
+			err := cache.Add(&AddCacheParams{
+				Key:   key,
+				Value: testCacheValue,
+			})
+			require.NoError(test, err)
+		}
+
+		var dest testStruct
+		err := cache.Peek(testCacheKey, &dest)
+		require.NoError(test, err)
+		require.Equal(test, testCacheValue.Value, dest.Value)
+
+		stored, found := cache.cacheMap.Load("tampered")
+		require.True(test, found)
+
+		ciphertext := stored.(*cacheEntry).value.([]byte)
+		ciphertext[len(ciphertext)-1] ^= 0xff
+
+		err = cache.Peek("tampered", &dest)
+		require.ErrorIs(test, err, ErrDecrypt)
+
+		_, found = cache.cacheMap.Load("tampered")
+		require.True(test, found)
+
+		clock.Advance(time.Minute + time.Nanosecond)
+
+		err = cache.Peek(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrExpired)
+
+		_, found = cache.cacheMap.Load(testCacheKey)
+		require.True(test, found)
+
+		// Unlike Peek, Get evicts the expired entry.
+		err = cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrExpired)
+
+		err = cache.Peek(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrNotFound)
+	})
+
+	test.Run("Len is maintained on every write and removal", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Minute,
+			CleanInterval: time.Minute,
+			Clock:         clock,
+		})
+		require.Zero(test, cache.Len())
+
+		for i := range 5 {
+			err := cache.Add(&AddCacheParams{
+				Key:   i,
+				Value: i,
+			})
+			require.NoError(test, err)
+		}
+
+		require.Equal(test, 5, cache.Len())
+
+		// Overwriting and updating don't add entries.
+		err := cache.Add(&AddCacheParams{
+			Key:   0,
+			Value: "overwritten",
+		})
+		require.NoError(test, err)
+
+		err = cache.Update(&UpdateCacheParams{
+			Key:   1,
+			Value: "updated",
+		})
+		require.NoError(test, err)
+		require.Equal(test, 5, cache.Len())
+
+		require.NoError(test, cache.Remove(0))
+		require.NoError(test, cache.Remove(0))
+		require.Equal(test, 4, cache.Len())
+
+		clock.Advance(time.Minute + time.Nanosecond)
+		require.Eventually(test, func() bool {
+			return cache.Len() == 0
+		}, time.Second, time.Millisecond)
+
+		err = cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+		require.Equal(test, 1, cache.Len())
+
+		require.NoError(test, cache.Clear())
+		require.Zero(test, cache.Len())
+	})
+
+	test.Run("Info exposes entry metadata", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Minute,
+			IsCacheObfuscated: true,
+			Clock:             clock,
+		})
+
+		insertionTime := clock.Now()
+		err := cache.Add(&AddCacheParams{
+			Key:    testCacheKey,
+			Value:  testCacheValue,
+			Expiry: time.Hour,
+		})
+		require.NoError(test, err)
+
+		info, found := cache.Info(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, testCacheKey, info.Key)
+		require.Equal(test, insertionTime, info.InsertionTime)
+		require.Equal(test, time.Hour, info.Expiry)
+		require.Positive(test, info.Size)
+
+		stored, found := cache.cacheMap.Load(testCacheKey)
+		require.True(test, found)
+		require.Len(test, stored.(*cacheEntry).value.([]byte), info.Size)
+
+		clock.Advance(time.Second)
+
+		err = cache.Update(&UpdateCacheParams{
+			Key:   testCacheKey,
+			Value: &testStruct{Value: "updated"},
+		})
+		require.NoError(test, err)
+
+		updatedInfo, found := cache.Info(testCacheKey)
+		require.True(test, found)
+		require.Greater(test, updatedInfo.Version, info.Version)
+		require.Equal(test, insertionTime, updatedInfo.InsertionTime)
+		require.Equal(test, time.Hour, updatedInfo.Expiry)
+
+		_, found = cache.Info("missing")
+		require.False(test, found)
+	})
+
+	test.Run("IsObfuscated reports the obfuscation of the cache and its namespaces", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		plain := NewCache(&CreateCacheParams{})
+		defer plain.Close()
+
+		obfuscated := NewCache(&CreateCacheParams{IsCacheObfuscated: true})
+		defer obfuscated.Close()
+
+		require.False(test, plain.IsObfuscated())
+		require.True(test, obfuscated.IsObfuscated())
+		require.True(test, obfuscated.Namespace("tenant").IsObfuscated())
+	})
+}
+
+func TestService_Expiration(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("Expire and ExpireAt move the deadline without touching the value", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:            time.Minute,
+			IsCacheObfuscated: true,
+			Clock:             clock,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		stored, found := cache.cacheMap.Load(testCacheKey)
+		require.True(test, found)
+
+		ciphertext := stored.(*cacheEntry).value.([]byte)
+		info, found := cache.Info(testCacheKey)
+		require.True(test, found)
+
+		clock.Advance(time.Second * 30)
+
+		err = cache.Expire(testCacheKey, time.Hour)
+		require.NoError(test, err)
+
+		ttl, found := cache.TTL(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, time.Hour, ttl)
+
+		// The value is not re-encrypted and the version doesn't change.
+		stored, found = cache.cacheMap.Load(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, ciphertext, stored.(*cacheEntry).value.([]byte))
+
+		expiredInfo, found := cache.Info(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, info.Version, expiredInfo.Version)
+		require.Equal(test, info.InsertionTime, expiredInfo.InsertionTime)
+
+		deadline := clock.Now().Add(time.Minute * 5)
+		err = cache.ExpireAt(testCacheKey, deadline)
+		require.NoError(test, err)
+
+		info, found = cache.Info(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, deadline, info.ExpiresAt)
+
+		clock.Advance(time.Minute*5 + time.Nanosecond)
+
+		var dest testStruct
+		err = cache.Get(testCacheKey, &dest)
+		require.ErrorIs(test, err, ErrExpired)
+	})
+
+	test.Run("non-positive Expire and past ExpireAt remove the entry", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry: time.Minute,
+			Clock:  clock,
+		})
+
+		for _, key := range []string{"expire", "expireAt"} {
+			err := cache.Add(&AddCacheParams{
+				Key:   key,
+				Value: testCacheValue,
+			})
+			require.NoError(test, err)
+		}
+
+		require.NoError(test, cache.Expire("expire", 0))
+		require.NoError(test, cache.ExpireAt("expireAt", clock.Now()))
+		require.Zero(test, cache.Len())
+
+		require.ErrorIs(test, cache.Expire("missing", time.Minute), ErrNotFound)
+		require.ErrorIs(test, cache.ExpireAt("missing", clock.Now().Add(time.Minute)), ErrNotFound)
+		require.ErrorIs(test, cache.Persist("missing"), ErrNotFound)
+		require.ErrorIs(test, cache.Touch("missing"), ErrNotFound)
+	})
+
+	test.Run("Persist removes the expiry and Touch restarts it", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry: time.Minute,
+			Clock:  clock,
+		})
+
+		for _, key := range []string{"persist", "touch"} {
+			err := cache.Add(&AddCacheParams{
+				Key:   key,
+				Value: testCacheValue,
+			})
+			require.NoError(test, err)
+		}
+
+		clock.Advance(time.Second * 50)
+
+		require.NoError(test, cache.Persist("persist"))
+		require.NoError(test, cache.Touch("touch"))
+
+		ttl, found := cache.TTL("touch")
+		require.True(test, found)
+		require.Equal(test, time.Minute, ttl)
+
+		clock.Advance(time.Minute)
+
+		_, found = cache.get("touch", nil)
+		require.True(test, found)
+
+		clock.Advance(time.Nanosecond)
+
+		_, found = cache.get("touch", nil)
+		require.False(test, found)
+
+		clock.Advance(time.Hour)
+
+		ttl, found = cache.TTL("persist")
+		require.True(test, found)
+		require.Negative(test, ttl)
+
+		// Touching an entry that never expires leaves it as-is.
+		require.NoError(test, cache.Touch("persist"))
+
+		ttl, found = cache.TTL("persist")
+		require.True(test, found)
+		require.Negative(test, ttl)
+	})
+
+	test.Run("expiry changes don't lose concurrent updates", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry: time.Hour,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: 0,
+		})
+		require.NoError(test, err)
+
+		updates := 1000
+
+		var wg sync.WaitGroup
+
+		for range 4 {
+			wg.Go(func() {
+				for range updates {
+					assert.NoError(test, cache.Touch(testCacheKey))
+					assert.NoError(test, cache.Expire(testCacheKey, time.Hour))
+				}
+			})
+		}
+
+		for i := range updates {
+			err = cache.Update(&UpdateCacheParams{
+				Key:   testCacheKey,
+				Value: i + 1,
+			})
+			require.NoError(test, err)
+		}
+
+		wg.Wait()
+
+		var dest any
+		require.NoError(test, cache.Get(testCacheKey, &dest))
+		require.Equal(test, updates, dest)
+	})
+}
+
+func TestService_ApplyToExisting(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("UpdateTime shortens the expiry of entries using the cache-wide expiry", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry: time.Hour,
+			Clock:  clock,
+		})
+
+		for key, expiry := range map[string]time.Duration{"inherited": 0, "explicit": time.Hour} {
+			err := cache.Add(&AddCacheParams{
+				Key:    key,
+				Value:  testCacheValue,
+				Expiry: expiry,
+			})
+			require.NoError(test, err)
+		}
+
+		// An expiry set with Expire overrides the cache-wide one.
+		err := cache.Add(&AddCacheParams{
+			Key:   "overridden",
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+		require.NoError(test, cache.Expire("overridden", time.Hour))
+
+		clock.Advance(time.Minute * 10)
+
+		cache.UpdateTime(&UpdateCacheTimeParams{
+			Expiry:          time.Minute * 15,
+			ApplyToExisting: true,
+		})
+
+		// The new expiry counts from insertion, 10 minutes ago.
+		ttl, found := cache.TTL("inherited")
+		require.True(test, found)
+		require.Equal(test, time.Minute*5, ttl)
+
+		ttl, found = cache.TTL("explicit")
+		require.True(test, found)
+		require.Equal(test, time.Minute*50, ttl)
+
+		ttl, found = cache.TTL("overridden")
+		require.True(test, found)
+		require.Equal(test, time.Minute*50, ttl)
+
+		clock.Advance(time.Minute*5 + time.Nanosecond)
+
+		_, found = cache.get("inherited", nil)
+		require.False(test, found)
+
+		_, found = cache.get("explicit", nil)
+		require.True(test, found)
+	})
+
+	test.Run("UpdateTime adds or removes the expiry of existing entries", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Clock: clock,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		clock.Advance(time.Minute)
+
+		cache.UpdateTime(&UpdateCacheTimeParams{
+			Expiry:          time.Minute * 2,
+			ApplyToExisting: true,
+		})
+
+		ttl, found := cache.TTL(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, time.Minute, ttl)
+
+		cache.UpdateTime(&UpdateCacheTimeParams{
+			ApplyToExisting: true,
+		})
+
+		ttl, found = cache.TTL(testCacheKey)
+		require.True(test, found)
+		require.Negative(test, ttl)
+	})
+
+	test.Run("UpdateTime keeps existing expiries by default", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry: time.Hour,
+			Clock:  clock,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		cache.UpdateTime(&UpdateCacheTimeParams{
+			Expiry: time.Minute,
+		})
+
+		ttl, found := cache.TTL(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, time.Hour, ttl)
+	})
+}
+
+func TestService_Reconfigure(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("Reconfigure replaces the configuration returned by Options", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Hour,
+			CleanInterval: time.Minute,
+			Clock:         clock,
+		})
+
+		require.Equal(test, Options{Expiry: time.Hour, CleanInterval: time.Minute}, cache.Options())
+
+		options := Options{
+			Expiry:        time.Minute * 5,
+			CleanInterval: time.Second * 30,
+		}
+		require.NoError(test, cache.Reconfigure(options))
+		require.Equal(test, options, cache.Options())
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		ttl, found := cache.TTL(testCacheKey)
+		require.True(test, found)
+		require.Equal(test, time.Minute*5, ttl)
+	})
+
+	test.Run("Reconfigure rejects invalid options", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Hour,
+			CleanInterval: time.Minute,
+			Clock:         NewFakeClock(time.Now()),
+		})
+
+		err := cache.Reconfigure(Options{
+			Expiry:        time.Minute,
+			CleanInterval: -time.Second,
+		})
+		require.ErrorIs(test, err, ErrInvalidOptions)
+		require.Equal(test, Options{Expiry: time.Hour, CleanInterval: time.Minute}, cache.Options())
+	})
+
+	test.Run("Reconfigure returns ErrClosed once the cache is closed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+		})
+		require.NoError(test, cache.Close())
+
+		require.ErrorIs(test, cache.Reconfigure(Options{Expiry: time.Minute}), ErrClosed)
+	})
+
+	test.Run("Reconfigure stops and restarts the background cleaner", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Second,
+			CleanInterval: time.Second,
+			Clock:         clock,
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		require.NoError(test, cache.Reconfigure(Options{Expiry: time.Second}))
+
+		// Wait for the cleaner to stop its ticker.
+		require.Eventually(test, func() bool {
+			clock.lock.Lock()
+			defer clock.lock.Unlock()
+
+			return len(clock.tickers) == 0
+		}, time.Second, time.Millisecond)
+
+		clock.Advance(time.Second * 5)
+		require.Equal(test, 1, cache.Len())
+
+		require.NoError(test, cache.Reconfigure(Options{Expiry: time.Second, CleanInterval: time.Second}))
+
+		require.Eventually(test, func() bool {
+			clock.Advance(time.Second)
+
+			return cache.Len() == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	test.Run("concurrent reconfiguration is race-free without external locking", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Second * 2,
+			CleanInterval: time.Second,
+			Clock:         clock,
+		})
+
+		const (
+			workers    = 8
+			iterations = 200
+		)
+
+		var wg sync.WaitGroup
+
+		for worker := range workers {
+			// Every configuration written keeps Expiry at twice the CleanInterval.
+			wg.Go(func() {
+				for i := range iterations {
+					interval := time.Millisecond * time.Duration(1+(worker*iterations+i)%50)
+
+					if i%2 == 0 {
+						assert.NoError(test, cache.Reconfigure(Options{
+							Expiry:        interval * 2,
+							CleanInterval: interval,
+						}))
+					} else {
+						cache.UpdateTime(&UpdateCacheTimeParams{
+							Expiry:          interval * 2,
+							CleanInterval:   interval,
+							ApplyToExisting: i%3 == 0,
+						})
+					}
+				}
+			})
+
+			wg.Go(func() {
+				for i := range iterations {
+					key := fmt.Sprintf("%d-%d", worker, i%10)
+
+					assert.NoError(test, cache.Add(&AddCacheParams{
+						Key:   key,
+						Value: testCacheValue,
+					}))
+
+					var dest any
+					_ = cache.Get(key, &dest)
+					_, _ = cache.TTL(key)
+
+					// A snapshot is never a mix of two configurations.
+					options := cache.Options()
+					assert.Equal(test, options.Expiry, options.CleanInterval*2)
+				}
+			})
+		}
+
+		wg.Go(func() {
+			for range iterations {
+				clock.Advance(time.Millisecond * 10)
+			}
+		})
+
+		wg.Wait()
+
+		options := cache.Options()
+		require.Equal(test, options.Expiry, options.CleanInterval*2)
+		require.NoError(test, cache.Close())
+	})
+
+	test.Run("Reconfigure racing with Close is safe", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		for range 50 {
+			cache := NewCache(&CreateCacheParams{
+				CleanInterval: time.Millisecond,
+			})
+
+			var wg sync.WaitGroup
+
+			wg.Go(func() {
+				err := cache.Reconfigure(Options{CleanInterval: time.Microsecond})
+				if err != nil {
+					assert.ErrorIs(test, err, ErrClosed)
+				}
+			})
+			wg.Go(func() {
+				assert.NoError(test, cache.Close())
+			})
+
+			wg.Wait()
+
+			require.ErrorIs(test, cache.Reconfigure(Options{}), ErrClosed)
+		}
+	})
+}
+
+func TestService_Batch(test *testing.T) {
+	defer flumetest.Start(test)
+
+	for _, obfuscated := range []bool{false, true} {
+		test.Run(fmt.Sprintf("AddMany, GetMany and RemoveMany round-trip, obfuscated %t", obfuscated), func(test *testing.T) {
+			defer flumetest.Start(test)
+			test.Parallel()
+
+			clock := NewFakeClock(time.Now())
+			cache := NewCache(&CreateCacheParams{
+				Expiry:            time.Minute,
+				IsCacheObfuscated: obfuscated,
+				Clock:             clock,
+			})
+
+			err := cache.AddMany(
+				&AddCacheParams{Key: "a", Value: "1"},
+				&AddCacheParams{Key: "b", Value: "2", Expiry: time.Hour},
+				&AddCacheParams{Key: "c", Value: "3"},
+			)
+			require.NoError(test, err)
+			require.Equal(test, 3, cache.Len())
+
+			infoA, found := cache.Info("a")
+			require.True(test, found)
+			infoB, found := cache.Info("b")
+			require.True(test, found)
+			require.Equal(test, infoA.InsertionTime, infoB.InsertionTime)
+			require.Equal(test, time.Hour, infoB.Expiry)
+			require.Less(test, infoA.Version, infoB.Version)
+
+			res, misses := cache.GetMany("c", "absent", "a")
+			require.Len(test, res, 2)
+			require.Equal(test, []any{"absent"}, misses)
+
+			var value string
+			if obfuscated {
+				require.NoError(test, json.Unmarshal(res["a"].Value.([]byte), &value))
+			} else {
+				value = res["a"].Value.(string)
+			}
+
+			require.Equal(test, "1", value)
+
+			// Expired entries miss and are removed.
+			clock.Advance(time.Minute + time.Nanosecond)
+
+			res, misses = cache.GetMany("a", "b", "c")
+			require.Len(test, res, 1)
+			require.Contains(test, res, "b")
+			require.Equal(test, []any{"a", "c"}, misses)
+			require.Equal(test, 1, cache.Len())
+
+			require.NoError(test, cache.RemoveMany("b", "absent"))
+			require.Zero(test, cache.Len())
+		})
+	}
+
+	test.Run("AddMany stores the valid entries and reports the failed keys", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			IsCacheObfuscated: true,
+			Clock:             NewFakeClock(time.Now()),
+		})
+
+		err := cache.AddMany(
+			&AddCacheParams{Key: "valid", Value: testCacheValue},
+			&AddCacheParams{Key: "channel", Value: make(chan int)},
+			&AddCacheParams{Key: "func", Value: func() {}},
+		)
+		require.ErrorIs(test, err, ErrEncode)
+
+		var batchError *BatchError
+		require.ErrorAs(test, err, &batchError)
+		require.Len(test, batchError.Errors, 2)
+		require.Equal(test, "channel", batchError.Errors[0].Key)
+		require.Equal(test, "func", batchError.Errors[1].Key)
+		require.True(test, strings.HasPrefix(err.Error(), "2 keys failed: key channel: "))
+
+		cachedValue := &testStruct{}
+		require.NoError(test, cache.Get("valid", cachedValue))
+		require.Equal(test, testCacheValue, cachedValue)
+		require.Equal(test, 1, cache.Len())
+	})
+
+	test.Run("GetMany misses entries that fail to decrypt and removes them", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			IsCacheObfuscated: true,
+			Clock:             NewFakeClock(time.Now()),
+		})
+
+		err := cache.AddMany(
+			&AddCacheParams{Key: "valid", Value: testCacheValue},
+			&AddCacheParams{Key: "tampered", Value: testCacheValue},
+		)
+		require.NoError(test, err)
+
+		stored, found := cache.cacheMap.Load("tampered")
+		require.True(test, found)
+
+		ciphertext := stored.(*cacheEntry).value.([]byte)
+		ciphertext[len(ciphertext)-1] ^= 0xff
+
+		res, misses := cache.GetMany("valid", "tampered")
+		require.Len(test, res, 1)
+		require.Equal(test, []any{"tampered"}, misses)
+		require.Equal(test, 1, cache.Len())
+	})
+
+	test.Run("batch operations on a closed cache", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+		})
+		require.NoError(test, cache.AddMany(&AddCacheParams{Key: testCacheKey, Value: testCacheValue}))
+		require.NoError(test, cache.Close())
+
+		require.ErrorIs(test, cache.AddMany(&AddCacheParams{Key: testCacheKey, Value: testCacheValue}), ErrClosed)
+		require.ErrorIs(test, cache.RemoveMany(testCacheKey), ErrClosed)
+
+		res, misses := cache.GetMany(testCacheKey)
+		require.Empty(test, res)
+		require.Equal(test, []any{testCacheKey}, misses)
+	})
+}
+
+func TestService_Zeroisation(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("Close zeroes the obfuscation key", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			IsCacheObfuscated: true,
+			Clock:             NewFakeClock(time.Now()),
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+		require.NoError(test, err)
+
+		key := cache.obfuscator.key
+		require.NotEqual(test, make([]byte, keyBytes), key)
+
+		require.NoError(test, cache.Close())
+		require.Equal(test, make([]byte, keyBytes), key)
+
+		_, err = cache.obfuscator.Obfuscate([]byte("value"))
+		require.ErrorIs(test, err, ErrClosed)
+	})
+
+	for _, params := range []CreateCacheParams{
+		{},
+		{IsCacheObfuscated: true},
+		{IsCacheObfuscated: true, Compression: CompressionParams{Algorithm: CompressionFlate}},
+	} {
+		test.Run(fmt.Sprintf("GetBytes appends the value to a caller-owned buffer, obfuscated %t, compression %d",
+			params.IsCacheObfuscated, params.Compression.Algorithm), func(test *testing.T) {
+			defer flumetest.Start(test)
+			test.Parallel()
+
+			params.Clock = NewFakeClock(time.Now())
+			cache := NewCache(&params)
+
+			value := &testStruct{
+				Value: strings.Repeat("secret", 100),
+			}
+			err := cache.Add(&AddCacheParams{
+				Key:   testCacheKey,
+				Value: value,
+			})
+			require.NoError(test, err)
+
+			want, err := json.Marshal(value)
+			require.NoError(test, err)
+
+			buf := make([]byte, 0, 1024)
+
+			got, err := cache.GetBytes(testCacheKey, append(buf, "prefix:"...))
+			require.NoError(test, err)
+			require.Equal(test, append([]byte("prefix:"), want...), got)
+			require.Same(test, &buf[:1][0], &got[0])
+
+			clear(got)
+
+			// Wiping the caller's copy leaves the cached value intact.
+			got, err = cache.GetBytes(testCacheKey, nil)
+			require.NoError(test, err)
+			require.Equal(test, want, got)
+		})
+	}
+
+	test.Run("GetBytes reports failures and leaves dst unchanged", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			IsCacheObfuscated: true,
+			Clock:             NewFakeClock(time.Now()),
+		})
+
+		dst := []byte("prefix")
+
+		got, err := cache.GetBytes("nonExistentKey", dst)
+		require.ErrorIs(test, err, ErrNotFound)
+		require.Equal(test, dst, got)
+
+		require.NoError(test, cache.Close())
+
+		got, err = cache.GetBytes(testCacheKey, dst)
+		require.ErrorIs(test, err, ErrClosed)
+		require.Equal(test, dst, got)
+	})
+
+	test.Run("scratch buffers are zeroed when released", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		scratch := getScratch()
+		*scratch = append((*scratch)[:0], "plaintext"...)
+		used := *scratch
+
+		putScratch(scratch)
+		require.Equal(test, make([]byte, len(used)), used)
+	})
+
+	test.Run("decrypted values are zeroed once Get and Peek are done with them", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			IsCacheObfuscated: true,
+			Compression: CompressionParams{
+				Algorithm: CompressionGzip,
+			},
+			Clock: NewFakeClock(time.Now()),
+		})
+
+		err := cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: strings.Repeat("secret", 100),
+		})
+		require.NoError(test, err)
+
+		entry, found := cache.load(testCacheKey)
+		require.True(test, found)
+
+		res, err := cache.decode(testCacheKey, entry, nil, nil)
+		require.NoError(test, err)
+
+		plaintext := res.Value.([]byte)
+		require.Contains(test, string(plaintext), "secret")
+
+		cache.wipe(res)
+		require.Equal(test, make([]byte, len(plaintext)), plaintext)
+	})
+}
+
+func TestService_Tags(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("InvalidateTag removes every entry with the tag", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+		})
+
+		err := cache.AddMany(
+			&AddCacheParams{Key: "a", Value: 1, Tags: []string{"tenant:1", "user:1", "tenant:1"}},
+			&AddCacheParams{Key: "b", Value: 2, Tags: []string{"tenant:1"}},
+			&AddCacheParams{Key: "c", Value: 3, Tags: []string{"tenant:2"}},
+			&AddCacheParams{Key: "d", Value: 4},
+		)
+		require.NoError(test, err)
+
+		info, found := cache.Info("a")
+		require.True(test, found)
+		require.Equal(test, []string{"tenant:1", "user:1"}, info.Tags)
+
+		require.NoError(test, cache.InvalidateTag("tenant:1"))
+		require.ElementsMatch(test, []any{"c", "d"}, slices.Collect(cache.Keys()))
+
+		require.NoError(test, cache.InvalidateTags("tenant:2", "unknown"))
+		require.Equal(test, 1, cache.Len())
+		require.Empty(test, cache.tags.terms)
+	})
+
+	test.Run("the tag index follows removal, overwrite, update and expiry", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Clock:         clock,
+			CleanInterval: time.Minute,
+		})
+
+		add := func(key string, expiry time.Duration, tags ...string) {
+			err := cache.Add(&AddCacheParams{
+				Key:    key,
+				Value:  testCacheValue,
+				Expiry: expiry,
+				Tags:   tags,
+			})
+			require.NoError(test, err)
+		}
+
+		add("removed", 0, "tag")
+		require.NoError(test, cache.Remove("removed"))
+		require.Empty(test, cache.tags.keys("tag"))
+
+		// Overwriting an entry replaces its tags.
+		add("overwritten", 0, "tag")
+		add("overwritten", 0, "other")
+		require.Empty(test, cache.tags.keys("tag"))
+		require.NoError(test, cache.InvalidateTag("tag"))
+		require.Equal(test, 1, cache.Len())
+
+		// Update keeps the tags of the entry.
+		require.NoError(test, cache.Update(&UpdateCacheParams{Key: "overwritten", Value: "updated"}))
+		require.Equal(test, []any{"overwritten"}, cache.tags.keys("other"))
+
+		require.NoError(test, cache.Clear())
+		require.Empty(test, cache.tags.terms)
+
+		// Expired entries leave the index when evicted by a lookup or the cleaner.
+		add("looked up", time.Second, "tag")
+		add("cleaned", time.Second, "tag")
+		clock.Advance(time.Second + time.Nanosecond)
+
+		_, found := cache.get("looked up", nil)
+		require.False(test, found)
+		require.Equal(test, []any{"cleaned"}, cache.tags.keys("tag"))
+
+		require.Eventually(test, func() bool {
+			clock.Advance(time.Minute)
+
+			return cache.Len() == 0
+		}, time.Second, time.Millisecond)
+		require.Empty(test, cache.tags.keys("tag"))
+	})
+
+	test.Run("InvalidateTag returns ErrClosed once the cache is closed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+		})
+		require.NoError(test, cache.Add(&AddCacheParams{Key: testCacheKey, Value: testCacheValue, Tags: []string{"tag"}}))
+		require.NoError(test, cache.Close())
+
+		require.ErrorIs(test, cache.InvalidateTag("tag"), ErrClosed)
+		require.ErrorIs(test, cache.InvalidateTags("tag"), ErrClosed)
+		require.Empty(test, cache.tags.terms)
+	})
+
+	test.Run("the tag index stays exact under concurrent writes", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+		})
+
+		const (
+			workers    = 8
+			iterations = 500
+			keys       = 16
+		)
+
+		tags := []string{"red", "green", "blue"}
+
+		var wg sync.WaitGroup
+
+		for worker := range workers {
+			wg.Go(func() {
+				for i := range iterations {
+					key := (worker + i) % keys
+
+					switch i % 5 {
+					case 3:
+						assert.NoError(test, cache.Remove(key))
+					case 4:
+						assert.NoError(test, cache.InvalidateTag(tags[i%len(tags)]))
+					default:
+						assert.NoError(test, cache.Add(&AddCacheParams{
+							Key:   key,
+							Value: i,
+							Tags:  []string{tags[(worker+i)%len(tags)]},
+						}))
+					}
+				}
+			})
+		}
+
+		wg.Wait()
+
+		// Every live entry is indexed under its tags, and nothing else is.
+		indexed := 0
+		for key := range cache.Keys() {
+			info, found := cache.Info(key)
+			require.True(test, found)
+
+			for _, tag := range info.Tags {
+				require.Contains(test, cache.tags.keys(tag), key)
+			}
+
+			indexed += len(info.Tags)
+		}
+
+		total := 0
+		for _, tag := range tags {
+			total += len(cache.tags.keys(tag))
+		}
+
+		require.Equal(test, indexed, total)
+
+		require.NoError(test, cache.InvalidateTags(tags...))
+		require.Zero(test, cache.Len())
+		require.Empty(test, cache.tags.terms)
+	})
+}
+
+func TestService_Namespaces(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("namespaces partition keys and share the storage", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			IsCacheObfuscated: true,
+			Clock:             NewFakeClock(time.Now()),
+		})
+		sessions := cache.Namespace("sessions")
+		users := cache.Namespace("users")
+
+		require.Same(test, sessions, cache.Namespace("sessions"))
+		require.Same(test, cache, cache.Namespace(""))
+		require.Same(test, sessions.obfuscator, cache.obfuscator)
+
+		for i, view := range []*Cache{cache, sessions, users} {
+			err := view.Add(&AddCacheParams{Key: testCacheKey, Value: i, Tags: []string{"tag"}})
+			require.NoError(test, err)
+		}
+
+		for i, view := range []*Cache{cache, sessions, users} {
+			var value int
+			require.NoError(test, view.Get(testCacheKey, &value))
+			require.Equal(test, i, value)
+			require.Equal(test, 1, view.Len())
+			require.Equal(test, []any{testCacheKey}, slices.Collect(view.Keys()))
+			require.Contains(test, view.GetAllCacheInfo(), testCacheKey)
+		}
+
+		// All three entries live in the one cache map.
+		stored := 0
+		cache.cacheMap.Range(func(_, _ any) bool {
+			stored++
+
+			return true
+		})
+		require.Equal(test, 3, stored)
+
+		require.NoError(test, sessions.InvalidateTag("tag"))
+		require.NoError(test, users.Remove(testCacheKey))
+		require.ErrorIs(test, sessions.Get(testCacheKey, new(int)), ErrNotFound)
+		require.ErrorIs(test, users.Get(testCacheKey, new(int)), ErrNotFound)
+		require.NoError(test, cache.Get(testCacheKey, new(int)))
+
+		// KeyError reports the key of the namespace.
+		var keyErr *KeyError
+		require.ErrorAs(test, sessions.Touch(testCacheKey), &keyErr)
+		require.Equal(test, testCacheKey, keyErr.Key)
+	})
+
+	test.Run("namespaces are cleared and closed independently", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+		})
+		sessions := cache.Namespace("sessions")
+		nested := sessions.Namespace("admin")
+
+		require.Same(test, nested, cache.Namespace("sessions/admin"))
+
+		for _, view := range []*Cache{cache, sessions, nested} {
+			require.NoError(test, view.AddMany(
+				&AddCacheParams{Key: "a", Value: testCacheValue},
+				&AddCacheParams{Key: "b", Value: testCacheValue},
+			))
+		}
+
+		require.NoError(test, sessions.Clear())
+		require.Zero(test, sessions.Len())
+		require.Equal(test, 2, cache.Len())
+		require.Equal(test, 2, nested.Len())
+
+		require.NoError(test, nested.Close())
+		require.ErrorIs(test, nested.Close(), ErrClosed)
+		require.ErrorIs(test, nested.Add(&AddCacheParams{Key: "a", Value: testCacheValue}), ErrClosed)
+		require.Equal(test, 2, cache.Len())
+
+		// A closed namespace is replaced by a new, empty one.
+		reopened := cache.Namespace("sessions/admin")
+		require.NotSame(test, nested, reopened)
+		require.Zero(test, reopened.Len())
+		require.ErrorIs(test, reopened.Get("a", new(testStruct)), ErrNotFound)
+
+		require.NoError(test, reopened.Add(&AddCacheParams{Key: "a", Value: testCacheValue}))
+		require.NoError(test, cache.Close())
+		require.Zero(test, reopened.Len())
+		require.ErrorIs(test, sessions.Get("a", new(testStruct)), ErrClosed)
+		require.ErrorIs(test, reopened.Close(), ErrClosed)
+	})
+
+	test.Run("namespaces have their own expiry and share the cleaner", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Expiry:        time.Hour,
+			CleanInterval: time.Minute,
+			Clock:         clock,
+		})
+		sessions := cache.Namespace("sessions")
+
+		require.Equal(test, Options{Expiry: time.Hour, CleanInterval: time.Minute}, sessions.Options())
+
+		// The clean interval of the root cache applies, whatever namespaces ask for.
+		require.NoError(test, sessions.Reconfigure(Options{Expiry: time.Second, CleanInterval: time.Second}))
+		require.NoError(test, sessions.Reconfigure(Options{Expiry: time.Second, CleanInterval: -time.Second}))
+		require.NoError(test, sessions.Reconfigure(Options{Expiry: time.Second}))
+		sessions.UpdateTime(&UpdateCacheTimeParams{Expiry: time.Second, CleanInterval: time.Hour})
+		require.Equal(test, Options{Expiry: time.Hour, CleanInterval: time.Minute}, cache.Options())
+		require.Equal(test, Options{Expiry: time.Second, CleanInterval: time.Minute}, sessions.Options())
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: testCacheKey, Value: testCacheValue}))
+		require.NoError(test, sessions.Add(&AddCacheParams{Key: testCacheKey, Value: testCacheValue}))
+
+		// The cleaner of the root cache evicts expired entries of namespaces.
+		require.Eventually(test, func() bool {
+			clock.Advance(time.Minute)
+
+			return sessions.Len() == 0
+		}, time.Second, time.Millisecond)
+		require.Equal(test, 1, cache.Len())
+
+		require.NoError(test, cache.Close())
+	})
+
+	test.Run("Stats counts hits, misses, adds and evictions per namespace", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			IsCacheObfuscated: true,
+			Clock:             clock,
+		})
+		sessions := cache.Namespace("sessions")
+
+		require.NoError(test, sessions.AddMany(
+			&AddCacheParams{Key: "live", Value: testCacheValue},
+			&AddCacheParams{Key: "expiring", Value: testCacheValue, Expiry: time.Second},
+		))
+		clock.Advance(time.Second + time.Nanosecond)
+
+		require.NoError(test, sessions.Get("live", new(testStruct)))
+		require.ErrorIs(test, sessions.Get("live", new(int)), ErrDecode)
+		require.ErrorIs(test, sessions.Get("expiring", new(testStruct)), ErrExpired)
+		_, misses := sessions.GetMany("live", "absent")
+		require.Equal(test, []any{"absent"}, misses)
+
+		require.Equal(test, Stats{Hits: 3, Misses: 2, Adds: 2, Evictions: 1, Len: 1}, sessions.Stats())
+		require.Equal(test, Stats{}, cache.Stats())
+	})
+}
+
+func TestService_Dependencies(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("removing, updating, overwriting or expiring a key cascades to dependents", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Clock: clock,
+		})
+
+		addDerived := func() {
+			err := cache.AddMany(
+				&AddCacheParams{Key: "user", Value: 1, Expiry: time.Hour},
+				&AddCacheParams{Key: "permissions", Value: 2},
+				&AddCacheParams{Key: "page", Value: 3, DependsOn: []any{"user", "permissions", "user"}},
+				&AddCacheParams{Key: "summary", Value: 4, DependsOn: []any{"page"}},
+				&AddCacheParams{Key: "unrelated", Value: 5},
+			)
+			require.NoError(test, err)
+		}
+
+		addDerived()
+
+		info, found := cache.Info("page")
+		require.True(test, found)
+		require.Equal(test, []any{"user", "permissions"}, info.DependsOn)
+
+		require.NoError(test, cache.Remove("user"))
+		require.ElementsMatch(test, []any{"permissions", "unrelated"}, slices.Collect(cache.Keys()))
+
+		addDerived()
+		require.NoError(test, cache.Update(&UpdateCacheParams{Key: "permissions", Value: 3}))
+		require.ElementsMatch(test, []any{"user", "permissions", "unrelated"}, slices.Collect(cache.Keys()))
+
+		addDerived()
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "page", Value: 6}))
+		require.ElementsMatch(test, []any{"user", "permissions", "page", "unrelated"}, slices.Collect(cache.Keys()))
+
+		// Changing the expiry of a parent keeps its dependents.
+		addDerived()
+		require.NoError(test, cache.Touch("user"))
+		require.Equal(test, 5, cache.Len())
+
+		clock.Advance(time.Hour + time.Nanosecond)
+		require.ErrorIs(test, cache.Get("user", new(any)), ErrExpired)
+		require.ElementsMatch(test, []any{"permissions", "unrelated"}, slices.Collect(cache.Keys()))
+		require.Empty(test, cache.dependents.terms)
+	})
+
+	test.Run("a dependent re-added without the dependency is kept", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+		})
+		sessions := cache.Namespace("sessions")
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "page", Value: 1, DependsOn: []any{"user"}}))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "page", Value: 2}))
+		require.NoError(test, sessions.Add(&AddCacheParams{Key: "user", Value: 3}))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "user", Value: 4}))
+
+		// Dependencies stay within the cache or namespace of the entry.
+		require.NoError(test, sessions.Remove("user"))
+		require.NoError(test, cache.Remove("user"))
+		require.Equal(test, []any{"page"}, slices.Collect(cache.Keys()))
+	})
+
+	test.Run("cycles and chains deeper than MaxDependencyDepth are rejected", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock:              NewFakeClock(time.Now()),
+			MaxDependencyDepth: 2,
+		})
+
+		var keyErr *KeyError
+
+		err := cache.Add(&AddCacheParams{Key: "a", Value: 1, DependsOn: []any{"a"}})
+		require.ErrorIs(test, err, ErrDependencyCycle)
+		require.ErrorAs(test, err, &keyErr)
+		require.Equal(test, "a", keyErr.Key)
+
+		require.NoError(test, cache.AddMany(
+			&AddCacheParams{Key: "a", Value: 1, DependsOn: []any{"c"}},
+			&AddCacheParams{Key: "b", Value: 2, DependsOn: []any{"a"}},
+		))
+
+		err = cache.AddMany(
+			&AddCacheParams{Key: "c", Value: 3, DependsOn: []any{"b"}},
+			&AddCacheParams{Key: "d", Value: 4, DependsOn: []any{"b"}},
+			&AddCacheParams{Key: "e", Value: 5},
+		)
+		require.ErrorIs(test, err, ErrDependencyCycle)
+		require.ErrorIs(test, err, ErrDependencyDepth)
+		require.ElementsMatch(test, []any{"a", "b", "e"}, slices.Collect(cache.Keys()))
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "c", Value: 3}))
+		require.NoError(test, cache.Remove("c"))
+		require.Equal(test, []any{"e"}, slices.Collect(cache.Keys()))
+	})
+}
+
+// failingStore is a Store failing every operation with err
+type failingStore struct {
+	err error
+}
+
+func (store failingStore) Load(context.Context, any) (any, error) { return nil, store.err }
+
+func (store failingStore) Save(context.Context, any, any) error { return store.err }
+
+func (store failingStore) Delete(context.Context, any) error { return store.err }
+
+func TestService_Store(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("misses are read through the store", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		store := NewMemoryStore()
+		cache := NewCache(&CreateCacheParams{
+			IsCacheObfuscated: true,
+			Expiry:            time.Minute,
+			Clock:             clock,
+			Store:             store,
+		})
+
+		require.NoError(test, store.Save(context.Background(), testCacheKey, &testStruct{Value: "value"}))
+
+		var value testStruct
+		require.NoError(test, cache.Get(testCacheKey, &value))
+		require.Equal(test, testStruct{Value: "value"}, value)
+		require.Equal(test, 1, cache.Len())
+
+		// The loaded value is cached with the cache-wide expiry.
+		require.NoError(test, store.Delete(context.Background(), testCacheKey))
+		require.NoError(test, cache.Get(testCacheKey, &value))
+
+		clock.Advance(time.Minute + time.Nanosecond)
+		require.ErrorIs(test, cache.Get(testCacheKey, &value), ErrExpired)
+
+		require.NoError(test, store.Save(context.Background(), "other", &testStruct{Value: "value"}))
+		res, misses := cache.GetMany("other", "absent")
+		require.Contains(test, res, "other")
+		require.Equal(test, []any{"absent"}, misses)
+
+		data, err := cache.GetBytes("other", nil)
+		require.NoError(test, err)
+		require.JSONEq(test, `{"Value":"value"}`, string(data))
+
+		require.Equal(test, Stats{Hits: 2, Misses: 4, Adds: 2, Evictions: 1, Len: 1}, cache.Stats())
+	})
+
+	test.Run("Add, Update and Remove write through the store", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		store := NewMemoryStore()
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+			Store: store,
+		})
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: 1}))
+		require.NoError(test, cache.AddMany(
+			&AddCacheParams{Key: "b", Value: 2},
+			&AddCacheParams{Key: "c", Value: 3},
+		))
+		require.NoError(test, cache.Update(&UpdateCacheParams{Key: "a", Value: 4}))
+		require.ErrorIs(test, cache.Update(&UpdateCacheParams{Key: "d", Value: 5}), ErrNotFound)
+
+		value, err := store.Load(context.Background(), "a")
+		require.NoError(test, err)
+		require.Equal(test, 4, value)
+		require.Equal(test, 3, store.Len())
+
+		require.NoError(test, cache.Remove("a"))
+		require.NoError(test, cache.RemoveMany("b", "absent"))
+		require.Equal(test, 1, store.Len())
+		require.Equal(test, []any{"c"}, slices.Collect(cache.Keys()))
+
+		// Namespaces don't use the store.
+		require.NoError(test, cache.Namespace("sessions").Add(&AddCacheParams{Key: "d", Value: 5}))
+		require.Equal(test, 1, store.Len())
+	})
+
+	test.Run("store failures are reported as ErrStore", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cause := errors.New("connection refused")
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+			Store: failingStore{err: cause},
+		})
+
+		var keyErr *KeyError
+
+		err := cache.Add(&AddCacheParams{Key: testCacheKey, Value: testCacheValue})
+		require.ErrorIs(test, err, ErrStore)
+		require.ErrorIs(test, err, cause)
+		require.ErrorAs(test, err, &keyErr)
+		require.Equal(test, testCacheKey, keyErr.Key)
+		require.Zero(test, cache.Len())
+
+		require.ErrorIs(test, cache.Get(testCacheKey, new(any)), ErrStore)
+
+		err = cache.AddMany(&AddCacheParams{Key: "a", Value: 1}, &AddCacheParams{Key: "b", Value: 2})
+		var batchErr *BatchError
+		require.ErrorAs(test, err, &batchErr)
+		require.Len(test, batchErr.Errors, 2)
+
+		// Keys are removed from the cache even when the store fails.
+		err = cache.addInCache(testCacheKey, newEntry(&AddCacheParams{Key: testCacheKey, Value: testCacheValue}, 0, time.Now()))
+		require.NoError(test, err)
+		require.ErrorIs(test, cache.Update(&UpdateCacheParams{Key: testCacheKey, Value: "updated"}), ErrStore)
+		require.ErrorIs(test, cache.Remove(testCacheKey), ErrStore)
+		require.Zero(test, cache.Len())
+		require.ErrorIs(test, cache.RemoveMany("a", "b"), ErrStore)
+	})
+}
+
+// testStore is a MemoryStore recording the size of the batches it writes, and
+// failing them on demand
+type testStore struct {
+	*MemoryStore
+	failing atomic.Bool
+	lock    sync.Mutex
+	batches []int
+}
+
+func (store *testStore) Write(ctx context.Context, writes []Write) error {
+	if store.failing.Load() {
+		return errors.New("store unavailable")
+	}
+
+	store.lock.Lock()
+	store.batches = append(store.batches, len(writes))
+	store.lock.Unlock()
+
+	return store.MemoryStore.Write(ctx, writes)
+}
+
+func TestService_WriteBehind(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("writes are coalesced, read through while pending and flushed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		store := &testStore{MemoryStore: NewMemoryStore()}
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+			Store: store,
+			WriteBehind: WriteBehindParams{
+				Enabled: true,
+			},
+		})
+
+		require.NoError(test, store.Save(context.Background(), "removed", 0))
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: 1}))
+		require.NoError(test, cache.Update(&UpdateCacheParams{Key: "a", Value: 2}))
+		require.NoError(test, cache.Remove("removed"))
+		require.Equal(test, 1, store.Len())
+
+		// Pending writes take precedence over the store.
+		require.NoError(test, cache.Clear())
+
+		var value any
+		require.NoError(test, cache.Get("a", &value))
+		require.Equal(test, 2, value)
+		require.ErrorIs(test, cache.Get("removed", &value), ErrNotFound)
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "c", Value: 3}))
+		require.NoError(test, cache.Flush(context.Background()))
+		require.Equal(test, []int{3}, store.batches)
+
+		value, err := store.Load(context.Background(), "a")
+		require.NoError(test, err)
+		require.Equal(test, 2, value)
+		require.Equal(test, 2, store.Len())
+
+		// Failed writes stay pending until a flush succeeds.
+		store.failing.Store(true)
+		require.NoError(test, cache.Remove("c"))
+		require.ErrorIs(test, cache.Flush(context.Background()), ErrStore)
+
+		store.failing.Store(false)
+		require.NoError(test, cache.Flush(context.Background()))
+		require.Equal(test, 1, store.Len())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.NoError(test, cache.Remove("a"))
+		require.ErrorIs(test, cache.Flush(ctx), context.Canceled)
+
+		require.NoError(test, cache.Close())
+		require.Zero(test, store.Len())
+	})
+
+	test.Run("flushes write in batches of BatchSize", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		store := &testStore{MemoryStore: NewMemoryStore()}
+		queue := newWriteBehind(WriteBehindParams{BatchSize: 2})
+
+		for _, key := range []string{"a", "b", "c", "a"} {
+			require.NoError(test, queue.enqueue(Write{Key: key, Value: key}))
+		}
+
+		require.Len(test, queue.pending, 3)
+
+		require.NoError(test, queue.flush(context.Background(), store))
+		require.Equal(test, []int{2, 1}, store.batches)
+		require.Empty(test, queue.pending)
+		require.Equal(test, 3, store.Len())
+	})
+
+	test.Run("writes are flushed on a timer, a size threshold and Close", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		store := NewMemoryStore()
+		cache := NewCache(&CreateCacheParams{
+			Clock: clock,
+			Store: store,
+			WriteBehind: WriteBehindParams{
+				Enabled:       true,
+				FlushInterval: time.Minute,
+				BatchSize:     3,
+			},
+		})
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: 1}))
+		require.Eventually(test, func() bool {
+			clock.Advance(time.Minute)
+
+			return store.Len() == 1
+		}, time.Second, time.Millisecond)
+
+		require.NoError(test, cache.AddMany(
+			&AddCacheParams{Key: "b", Value: 2},
+			&AddCacheParams{Key: "c", Value: 3},
+			&AddCacheParams{Key: "d", Value: 4},
+		))
+		require.Eventually(test, func() bool {
+			return store.Len() == 4
+		}, time.Second, time.Millisecond)
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "e", Value: 5}))
+		require.NoError(test, cache.Close())
+		require.Equal(test, 5, store.Len())
+
+		require.ErrorIs(test, cache.Flush(context.Background()), ErrClosed)
+		require.ErrorIs(test, cache.Add(&AddCacheParams{Key: "f", Value: 6}), ErrClosed)
+	})
+
+	test.Run("writes block while the queue is full", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		store := NewMemoryStore()
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+			Store: store,
+			WriteBehind: WriteBehindParams{
+				Enabled:    true,
+				MaxPending: 1,
+			},
+		})
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: 1}))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: 2}))
+
+		added := make(chan error)
+		go func() {
+			added <- cache.Add(&AddCacheParams{Key: "b", Value: 3})
+		}()
+
+		select {
+		case <-added:
+			require.Fail(test, "Add didn't block on a full queue")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		require.NoError(test, cache.Flush(context.Background()))
+		require.NoError(test, <-added)
+		require.NoError(test, cache.Close())
+		require.Equal(test, 2, store.Len())
+	})
+
+	test.Run("writes fail once the queue stays full for MaxWait", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		store := NewMemoryStore()
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+			Store: store,
+			WriteBehind: WriteBehindParams{
+				Enabled:    true,
+				MaxPending: 1,
+				MaxWait:    10 * time.Millisecond,
+			},
+		})
+		defer func() {
+			_ = cache.Close()
+		}()
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: 1}))
+
+		err := cache.Add(&AddCacheParams{Key: "b", Value: 2})
+		require.ErrorIs(test, err, ErrStore)
+
+		var keyErr *KeyError
+		require.ErrorAs(test, err, &keyErr)
+		require.Equal(test, "b", keyErr.Key)
+
+		// The value is only cached once its write is queued.
+		_, found := cache.Info("b")
+		require.False(test, found)
+
+		require.NoError(test, cache.Flush(context.Background()))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "b", Value: 2}))
+	})
+
+	test.Run("batches waiting for room fail once the cache is closed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+			Store: NewMemoryStore(),
+			WriteBehind: WriteBehindParams{
+				Enabled:    true,
+				MaxPending: 1,
+				MaxWait:    time.Hour,
+			},
+		})
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: 1}))
+
+		errs := make(chan error, 2)
+
+		go func() {
+			errs <- cache.AddMany(&AddCacheParams{Key: "b", Value: 2})
+		}()
+
+		go func() {
+			errs <- cache.RemoveMany("c")
+		}()
+
+		// Let both batches wait for room in the queue.
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(test, cache.Close())
+
+		for range 2 {
+			err := <-errs
+			require.ErrorIs(test, err, ErrClosed)
+
+			var batchErr *BatchError
+			if errors.As(err, &batchErr) {
+				require.Len(test, batchErr.Errors, 1)
+			}
+		}
+	})
+
+	test.Run("Close reports the writes the store fails", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+			Store: failingStore{err: errors.New("store unavailable")},
+			WriteBehind: WriteBehindParams{
+				Enabled: true,
+			},
+		})
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: testCacheKey, Value: 1}))
+
+		var keyErr *KeyError
+		err := cache.Close()
+		require.ErrorIs(test, err, ErrStore)
+		require.ErrorAs(test, err, &keyErr)
+		require.Equal(test, testCacheKey, keyErr.Key)
+	})
+}
+
+// failingRemote is a RemoteCache failing every operation with err
+type failingRemote struct {
+	err error
+}
+
+func (remote failingRemote) Get(context.Context, string) ([]byte, error) { return nil, remote.err }
+
+func (remote failingRemote) Set(context.Context, string, []byte, time.Duration) error {
+	return remote.err
+}
+
+func (remote failingRemote) Delete(context.Context, string) error { return remote.err }
+
+func TestService_TieredCache(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("replicas share values through the remote cache", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		ctx := context.Background()
+		clock := NewFakeClock(time.Now())
+		remote := NewMemoryRemote(clock)
+
+		newReplica := func(obfuscated bool) *TieredCache {
+			local := NewCache(&CreateCacheParams{
+				IsCacheObfuscated: obfuscated,
+				Clock:             clock,
+			})
+			test.Cleanup(func() {
+				_ = local.Close()
+			})
+
+			return NewTieredCache(&CreateTieredCacheParams{
+				Local:       local,
+				Remote:      remote,
+				Expiry:      time.Hour,
+				LocalExpiry: time.Minute,
+			})
+		}
+
+		first, second := newReplica(true), newReplica(false)
+
+		require.NoError(test, first.Add(ctx, &AddCacheParams{Key: 1, Value: &testStruct{Value: "v1"}}))
+		require.Equal(test, 1, remote.Len())
+
+		ttl, found := first.local.TTL(1)
+		require.True(test, found)
+		require.Equal(test, time.Minute, ttl)
+
+		// A miss in the local cache of the second replica is promoted from the remote cache.
+		var value testStruct
+		require.NoError(test, second.Get(ctx, 1, &value))
+		require.Equal(test, "v1", value.Value)
+
+		ttl, found = second.local.TTL(1)
+		require.True(test, found)
+		require.Equal(test, time.Minute, ttl)
+
+		// Local copies expire first, picking up the changes of other replicas.
+		require.NoError(test, first.Add(ctx, &AddCacheParams{Key: 1, Value: &testStruct{Value: "v2"}}))
+		require.NoError(test, second.Get(ctx, 1, &value))
+		require.Equal(test, "v1", value.Value)
+
+		clock.Advance(time.Minute + time.Nanosecond)
+		require.NoError(test, second.Get(ctx, 1, &value))
+		require.Equal(test, "v2", value.Value)
+
+		// A per-key expiry shorter than LocalExpiry caps the local TTL.
+		require.NoError(test, first.Add(ctx, &AddCacheParams{Key: 2, Value: "short", Expiry: time.Second}))
+
+		ttl, found = first.local.TTL(2)
+		require.True(test, found)
+		require.Equal(test, time.Second, ttl)
+
+		clock.Advance(time.Second + time.Nanosecond)
+		require.ErrorIs(test, second.Get(ctx, 2, new(string)), ErrNotFound)
+
+		// Removing a key leaves the local copies of other replicas until they expire.
+		require.NoError(test, first.Add(ctx, &AddCacheParams{Key: 1, Value: &testStruct{Value: "v3"}}))
+		require.NoError(test, second.Remove(ctx, 1))
+		require.Zero(test, remote.Len())
+		require.NoError(test, first.Get(ctx, 1, &value))
+		require.Equal(test, "v3", value.Value)
+
+		clock.Advance(time.Minute + time.Nanosecond)
+		require.ErrorIs(test, first.Get(ctx, 1, &value), ErrExpired)
+		require.ErrorIs(test, first.Get(ctx, 1, &value), ErrNotFound)
+	})
+
+	test.Run("promotions are neither written through nor published", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		ctx := context.Background()
+		clock := NewFakeClock(time.Now())
+		remote := NewMemoryRemote(clock)
+		store := NewMemoryStore()
+		invalidator := &testInvalidator{}
+
+		local := NewCache(&CreateCacheParams{
+			Clock:       clock,
+			Store:       store,
+			Invalidator: invalidator,
+		})
+		defer func() {
+			_ = local.Close()
+		}()
+
+		tiered := NewTieredCache(&CreateTieredCacheParams{Local: local, Remote: remote})
+		require.NoError(test, remote.Set(ctx, "key", []byte(`"value"`), 0))
+
+		var value string
+		require.NoError(test, tiered.Get(ctx, "key", &value))
+		require.Equal(test, "value", value)
+
+		_, found := local.TTL("key")
+		require.True(test, found)
+		require.Zero(test, store.Len())
+		require.Empty(test, invalidator.published)
+
+		require.NoError(test, local.Close())
+		require.ErrorIs(test, tiered.Get(ctx, "key", &value), ErrClosed)
+	})
+
+	test.Run("remote failures are reported as ErrRemote", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		ctx := context.Background()
+		cause := errors.New("connection refused")
+		local := NewCache(&CreateCacheParams{
+			Clock: NewFakeClock(time.Now()),
+		})
+		tiered := NewTieredCache(&CreateTieredCacheParams{
+			Local:  local,
+			Remote: failingRemote{err: cause},
+		})
+
+		var keyErr *KeyError
+
+		err := tiered.Add(ctx, &AddCacheParams{Key: testCacheKey, Value: testCacheValue})
+		require.ErrorIs(test, err, ErrRemote)
+		require.ErrorIs(test, err, cause)
+		require.ErrorAs(test, err, &keyErr)
+		require.Equal(test, testCacheKey, keyErr.Key)
+		require.Zero(test, local.Len())
+
+		require.ErrorIs(test, tiered.Get(ctx, testCacheKey, new(testStruct)), ErrRemote)
+
+		// Local hits don't reach the remote cache, and Remove removes them anyway.
+		require.NoError(test, local.Add(&AddCacheParams{Key: testCacheKey, Value: "value"}))
+		require.ErrorIs(test, tiered.Get(ctx, testCacheKey, new(int)), ErrDecode)
+		require.ErrorIs(test, tiered.Remove(ctx, testCacheKey), ErrRemote)
+		require.Zero(test, local.Len())
+
+		require.ErrorIs(test, tiered.Add(ctx, &AddCacheParams{Key: testCacheKey, Value: func() {}}), ErrEncode)
+	})
+}
+
+// testInvalidator is an Invalidator recording the published keys, failing
+// with err when set, or once ctx is done when blocked
+type testInvalidator struct {
+	lock      sync.Mutex
+	published []string
+	handlers  []func(keys []string)
+	err       error
+	blocked   bool
+}
+
+func (invalidator *testInvalidator) Publish(ctx context.Context, keys ...string) error {
+	if invalidator.blocked {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}
+
+	invalidator.lock.Lock()
+	defer invalidator.lock.Unlock()
+
+	if invalidator.err != nil {
+		return invalidator.err
+	}
+
+	invalidator.published = append(invalidator.published, keys...)
+
+	return nil
+}
+
+func (invalidator *testInvalidator) Subscribe(fn func(keys []string)) {
+	invalidator.handlers = append(invalidator.handlers, fn)
+}
+
+func TestService_Invalidator(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("local changes are published and remote ones removed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		invalidator := &testInvalidator{}
+		cache := NewCache(&CreateCacheParams{
+			Clock:       NewFakeClock(time.Now()),
+			Invalidator: invalidator,
+		})
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "1", Value: 1}))
+		// Keys failing to be added are not published.
+		err := cache.AddMany(
+			&AddCacheParams{Key: "a", Value: 2, Tags: []string{"tag"}},
+			&AddCacheParams{Key: "b", Value: 3},
+			&AddCacheParams{Key: "c", Value: 4, DependsOn: []any{"c"}},
+		)
+		require.ErrorIs(test, err, ErrDependencyCycle)
+		require.NoError(test, cache.Update(&UpdateCacheParams{Key: "b", Value: 5}))
+		require.NoError(test, cache.InvalidateTag("tag"))
+		require.NoError(test, cache.Remove("1"))
+		require.NoError(test, cache.RemoveMany("x"))
+
+		// Other processes would remove the string "2": keys must be strings.
+		var keyErr *KeyError
+		require.ErrorIs(test, cache.Add(&AddCacheParams{Key: 2, Value: 2}), ErrInvalidation)
+		require.ErrorAs(test, cache.AddMany(&AddCacheParams{Key: 2.5, Value: 2}), &keyErr)
+		require.Equal(test, 2.5, keyErr.Key)
+		require.NoError(test, cache.Remove(2))
+
+		// Expiry changes and namespaces are local, Clear publishes the removed keys.
+		require.NoError(test, cache.Touch("b"))
+		require.NoError(test, cache.Namespace("sessions").Add(&AddCacheParams{Key: "d", Value: 6}))
+		require.NoError(test, cache.Clear())
+
+		require.Equal(test, []string{"1", "a", "b", "b", "a", "1", "x", "b"}, invalidator.published)
+
+		require.NoError(test, cache.AddMany(
+			&AddCacheParams{Key: "e", Value: 7},
+			&AddCacheParams{Key: "f", Value: 8},
+		))
+		require.Len(test, invalidator.handlers, 1)
+
+		invalidator.handlers[0]([]string{"e", "unknown"})
+		require.Equal(test, []any{"f"}, slices.Collect(cache.Keys()))
+		require.Len(test, invalidator.published, 10)
+
+		require.NoError(test, cache.Close())
+		invalidator.handlers[0]([]string{"f"})
+	})
+
+	test.Run("removals by expiry changes and dependencies are published", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		invalidator := &testInvalidator{}
+		cache := NewCache(&CreateCacheParams{
+			Clock:       clock,
+			Invalidator: invalidator,
+		})
+
+		require.NoError(test, cache.AddMany(
+			&AddCacheParams{Key: "a", Value: 1},
+			&AddCacheParams{Key: "b", Value: 2, DependsOn: []any{"a"}},
+			&AddCacheParams{Key: "c", Value: 3, DependsOn: []any{"b"}},
+			&AddCacheParams{Key: "d", Value: 4},
+			&AddCacheParams{Key: "e", Value: 5},
+		))
+		invalidator.published = nil
+
+		// Only the removals are published, with the dependents they cascade to.
+		require.NoError(test, cache.Expire("d", time.Minute))
+		require.NoError(test, cache.ExpireAt("e", clock.Now().Add(time.Minute)))
+		require.NoError(test, cache.Expire("a", 0))
+		require.NoError(test, cache.ExpireAt("d", clock.Now()))
+		require.NoError(test, cache.ExpireAt("e", clock.Now().Add(-time.Minute)))
+
+		require.Zero(test, cache.Len())
+		require.Equal(test, []string{"b", "c", "a", "d", "e"}, invalidator.published)
+
+		require.ErrorIs(test, cache.Expire("a", 0), ErrNotFound)
+		require.Len(test, invalidator.published, 5)
+	})
+
+	test.Run("publishing gives up after InvalidationTimeout", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock:               NewFakeClock(time.Now()),
+			Invalidator:         &testInvalidator{blocked: true},
+			InvalidationTimeout: 10 * time.Millisecond,
+		})
+
+		start := time.Now()
+		err := cache.Add(&AddCacheParams{Key: testCacheKey, Value: testCacheValue})
+		require.ErrorIs(test, err, ErrInvalidation)
+		require.ErrorIs(test, err, context.DeadlineExceeded)
+		require.Less(test, time.Since(start), defaultInvalidationTimeout)
+		require.Equal(test, 1, cache.Len())
+	})
+
+	test.Run("publishing failures are reported as ErrInvalidation", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cause := errors.New("network unreachable")
+		cache := NewCache(&CreateCacheParams{
+			Clock:       NewFakeClock(time.Now()),
+			Invalidator: &testInvalidator{err: cause},
+		})
+
+		var keyErr *KeyError
+
+		err := cache.Add(&AddCacheParams{Key: testCacheKey, Value: testCacheValue})
+		require.ErrorIs(test, err, ErrInvalidation)
+		require.ErrorIs(test, err, cause)
+		require.ErrorAs(test, err, &keyErr)
+		require.Equal(test, testCacheKey, keyErr.Key)
+
+		// The change is applied anyway.
+		require.Equal(test, 1, cache.Len())
+		require.ErrorIs(test, cache.Update(&UpdateCacheParams{Key: testCacheKey, Value: "updated"}), ErrInvalidation)
+
+		var batchErr *BatchError
+		require.ErrorAs(test, cache.AddMany(&AddCacheParams{Key: "a", Value: 1}, &AddCacheParams{Key: "b", Value: 2}), &batchErr)
+		require.Len(test, batchErr.Errors, 2)
+
+		require.ErrorIs(test, cache.Remove(testCacheKey), ErrInvalidation)
+		require.ErrorIs(test, cache.RemoveMany("a", "b"), ErrInvalidation)
+		require.Zero(test, cache.Len())
+
+		_ = cache.Add(&AddCacheParams{Key: "c", Value: 3})
+		_ = cache.Add(&AddCacheParams{Key: "d", Value: 4})
+		require.ErrorIs(test, cache.Expire("c", 0), ErrInvalidation)
+		require.ErrorIs(test, cache.ExpireAt("d", time.Time{}), ErrInvalidation)
+
+		_ = cache.Add(&AddCacheParams{Key: "e", Value: 5})
+		require.ErrorAs(test, cache.Clear(), &batchErr)
+		require.Len(test, batchErr.Errors, 1)
+		require.ErrorIs(test, batchErr, ErrInvalidation)
+	})
+}
+
+func TestService_Replication(test *testing.T) {
+	defer flumetest.Start(test)
+
+	// summary describes events as type, key and value, in order
+	summary := func(events []Event) []string {
+		lines := make([]string, len(events))
+		for i, event := range events {
+			lines[i] = fmt.Sprintf("%d %d %s %s", event.Sequence, event.Type, event.Key, string(event.Value))
+		}
+
+		return lines
+	}
+
+	test.Run("changes are recorded in order", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		cache := NewCache(&CreateCacheParams{
+			Clock:       clock,
+			Replication: ReplicationParams{Enabled: true},
+		})
+		defer func() {
+			_ = cache.Close()
+		}()
+
+		start := cache.LogPosition()
+		require.NotZero(test, start.LogID)
+		require.Zero(test, start.Sequence)
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: 1, Tags: []string{"tag"}}))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "b", Value: "x", DependsOn: []any{"a"}}))
+		require.NoError(test, cache.Update(&UpdateCacheParams{Key: "a", Value: 2}))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: 3, Value: true, Expiry: time.Minute}))
+		require.NoError(test, cache.Persist(3))
+		require.NoError(test, cache.Remove("a"))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "c", Value: 4, Expiry: time.Second}))
+		clock.Advance(time.Second + time.Nanosecond)
+		require.ErrorIs(test, cache.Get("c", new(any)), ErrExpired)
+		require.NoError(test, cache.Namespace("local").Add(&AddCacheParams{Key: "d", Value: 5}))
+		require.NoError(test, cache.Clear())
+
+		events, err := cache.Events(context.Background(), start, 100)
+		require.NoError(test, err)
+		require.Equal(test, []string{
+			"1 1 a 1",
+			"2 1 b \"x\"",
+			// The update of a removes its dependent b.
+			"3 2 a 2",
+			"4 4 b ",
+			"5 1 3 true",
+			"6 3 3 true",
+			"7 4 a ",
+			"8 1 c 4",
+			"9 5 c ",
+			"10 4 3 ",
+		}, summary(events))
+		require.Equal(test, []string{"tag"}, events[0].Tags)
+		require.Equal(test, clock.Now().Add(time.Minute-time.Second-time.Nanosecond), events[4].ExpiresAt)
+		require.True(test, events[5].ExpiresAt.IsZero())
+		require.Equal(test, LogPosition{LogID: start.LogID, Sequence: 10}, cache.LogPosition())
+
+		events, err = cache.Events(context.Background(), LogPosition{LogID: start.LogID, Sequence: 7}, 2)
+		require.NoError(test, err)
+		require.Equal(test, []string{"8 1 c 4", "9 5 c "}, summary(events))
+	})
+
+	test.Run("a new expiry records only the entries it changes", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{
+			Clock:       NewFakeClock(time.Now()),
+			Expiry:      time.Minute,
+			Replication: ReplicationParams{Enabled: true},
+		})
+		defer func() {
+			_ = cache.Close()
+		}()
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "inherited", Value: 1}))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "own", Value: 2, Expiry: time.Hour}))
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "persisted", Value: 3}))
+		require.NoError(test, cache.Persist("persisted"))
+		position := cache.LogPosition()
+
+		cache.UpdateTime(&UpdateCacheTimeParams{Expiry: time.Minute, ApplyToExisting: true})
+		require.Equal(test, position, cache.LogPosition())
+
+		cache.UpdateTime(&UpdateCacheTimeParams{Expiry: 2 * time.Minute, ApplyToExisting: true})
+
+		events, err := cache.Events(context.Background(), position, 100)
+		require.NoError(test, err)
+		require.Equal(test, []string{"5 3 inherited 1"}, summary(events))
+	})
+
+	test.Run("Events waits for the next change", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{Replication: ReplicationParams{Enabled: true}})
+		position := cache.LogPosition()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := cache.Events(ctx, position, 10)
+		require.ErrorIs(test, err, context.DeadlineExceeded)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = cache.Add(&AddCacheParams{Key: "key", Value: 1})
+		}()
+
+		events, err := cache.Events(context.Background(), position, 10)
+		require.NoError(test, err)
+		require.Equal(test, []string{"1 1 key 1"}, summary(events))
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = cache.Close()
+		}()
+
+		_, err = cache.Events(context.Background(), cache.LogPosition(), 10)
+		require.ErrorIs(test, err, ErrClosed)
+	})
+
+	test.Run("positions outside of the log are rejected", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := NewCache(&CreateCacheParams{Replication: ReplicationParams{Enabled: true, LogSize: 4}})
+		defer func() {
+			_ = cache.Close()
+		}()
+
+		start := cache.LogPosition()
+
+		for i := range 6 {
+			require.NoError(test, cache.Add(&AddCacheParams{Key: i, Value: i}))
+		}
+
+		// Only the last 4 events are held.
+		_, err := cache.Events(context.Background(), start, 10)
+		require.ErrorIs(test, err, ErrLogPosition)
+
+		events, err := cache.Events(context.Background(), LogPosition{LogID: start.LogID, Sequence: 2}, 10)
+		require.NoError(test, err)
+		require.Equal(test, []string{"3 1 2 2", "4 1 3 3", "5 1 4 4", "6 1 5 5"}, summary(events))
+
+		for _, position := range []LogPosition{
+			{LogID: start.LogID, Sequence: 7},
+			{LogID: start.LogID + 1, Sequence: 6},
+			{},
+		} {
+			_, err = cache.Events(context.Background(), position, 10)
+			require.ErrorIs(test, err, ErrLogPosition)
+		}
+
+		_, err = NewCache(&CreateCacheParams{}).Events(context.Background(), start, 10)
+		require.ErrorIs(test, err, ErrNotReplicated)
+	})
+
+	test.Run("snapshots hold the live entries at a position", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		for _, obfuscated := range []bool{false, true} {
+			clock := NewFakeClock(time.Now())
+			cache := NewCache(&CreateCacheParams{
+				Clock:             clock,
+				IsCacheObfuscated: obfuscated,
+				Replication:       ReplicationParams{Enabled: true},
+			})
+
+			require.NoError(test, cache.Add(&AddCacheParams{Key: "a", Value: &testStruct{Value: "value"}, Expiry: time.Hour}))
+			require.NoError(test, cache.Add(&AddCacheParams{Key: "b", Value: []byte{0, 1}}))
+			require.NoError(test, cache.Add(&AddCacheParams{Key: "c", Value: 1, Expiry: time.Second}))
+			require.NoError(test, cache.Namespace("local").Add(&AddCacheParams{Key: "d", Value: 2}))
+			clock.Advance(time.Second + time.Nanosecond)
+
+			snapshot, err := cache.Snapshot()
+			require.NoError(test, err)
+			require.Equal(test, cache.LogPosition(), snapshot.Position)
+
+			slices.SortFunc(snapshot.Entries, func(a, b Event) int {
+				return strings.Compare(a.Key, b.Key)
+			})
+			require.Equal(test, []string{`3 1 a {"Value":"value"}`, `3 1 b "AAE="`}, summary(snapshot.Entries))
+			require.Equal(test, clock.Now().Add(time.Hour-time.Second-time.Nanosecond), snapshot.Entries[0].ExpiresAt)
+
+			require.NoError(test, cache.Close())
+
+			_, err = cache.Snapshot()
+			require.ErrorIs(test, err, ErrClosed)
+		}
+
+		_, err := NewCache(&CreateCacheParams{}).Snapshot()
+		require.ErrorIs(test, err, ErrNotReplicated)
+	})
+
+	test.Run("applied events are neither written through nor published", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := NewFakeClock(time.Now())
+		store := NewMemoryStore()
+		require.NoError(test, store.Save(context.Background(), "stored", 0))
+
+		invalidator := &testInvalidator{}
+		cache := NewCache(&CreateCacheParams{
+			Clock:       clock,
+			Store:       store,
+			Invalidator: invalidator,
+		})
+
+		expiresAt := clock.Now().Add(time.Hour)
+		require.NoError(test, cache.Apply(&Event{Type: EventAdd, Key: "a", Value: json.RawMessage(`1`), ExpiresAt: expiresAt, Tags: []string{"tag"}}))
+		require.NoError(test, cache.Apply(&Event{Type: EventAdd, Key: "b", Value: json.RawMessage(`"x"`)}))
+		require.NoError(test, cache.Apply(&Event{Type: EventUpdate, Key: "c", Value: json.RawMessage(`2`), ExpiresAt: clock.Now()}))
+		require.NoError(test, cache.Apply(&Event{Type: EventRemove, Key: "stored"}))
+
+		info, found := cache.Info("a")
+		require.True(test, found)
+		require.Equal(test, expiresAt, info.ExpiresAt)
+		require.Equal(test, []string{"tag"}, info.Tags)
+
+		info, found = cache.Info("b")
+		require.True(test, found)
+		require.Zero(test, info.ExpiresAt)
+
+		// An expiry in the past removes the entry.
+		_, found = cache.Info("c")
+		require.False(test, found)
+
+		require.NoError(test, cache.Apply(&Event{Type: EventExpire, Key: "a"}))
+		_, found = cache.Info("a")
+		require.False(test, found)
+
+		require.NoError(test, cache.Add(&AddCacheParams{Key: "local", Value: 3}))
+		require.NoError(test, cache.LoadSnapshot(&Snapshot{Entries: []Event{
+			{Type: EventAdd, Key: "b", Value: json.RawMessage(`"y"`)},
+		}}))
+		require.Equal(test, 1, cache.Len())
+
+		data, err := cache.GetBytes("b", nil)
+		require.NoError(test, err)
+		require.Equal(test, `"y"`, string(data))
+
+		// Only the local add went through the store and the invalidator.
+		require.Equal(test, 2, store.Len())
+		require.Equal(test, []string{"local"}, invalidator.published)
+
+		require.NoError(test, cache.Close())
+		require.ErrorIs(test, cache.Apply(&Event{Type: EventRemove, Key: "b"}), ErrClosed)
+	})
+}
@@ -0,0 +1,51 @@
+package caching
+
+import (
+	"time"
+)
+
+type (
+	// Clock is the source of time used for expiry checks and the background cleaner.
+	// Tests can inject a FakeClock to drive expiry deterministically.
+	Clock interface {
+		Now() time.Time
+		NewTicker(d time.Duration) Ticker
+	}
+
+	// Ticker mirrors the parts of time.Ticker used by the cache
+	Ticker interface {
+		C() <-chan time.Time
+		Reset(d time.Duration)
+		Stop()
+	}
+
+	// realClock implements Clock using the time package
+	realClock struct{}
+
+	// realTicker implements Ticker using a time.Ticker
+	realTicker struct {
+		ticker *time.Ticker
+	}
+)
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{
+		ticker: time.NewTicker(d),
+	}
+}
+
+func (ticker *realTicker) C() <-chan time.Time {
+	return ticker.ticker.C
+}
+
+func (ticker *realTicker) Reset(d time.Duration) {
+	ticker.ticker.Reset(d)
+}
+
+func (ticker *realTicker) Stop() {
+	ticker.ticker.Stop()
+}
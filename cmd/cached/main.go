@@ -0,0 +1,183 @@
+// Command cached serves a cache over the Redis protocol, the text protocol of
+// memcached and an HTTP/JSON API, in any combination.
+//
+//	cached -resp :6379 -memcached :11211 -http :8080 -expiry 10m -clean-interval 30s
+//
+// An empty address disables a protocol. Expired entries are removed every
+// minute unless -clean-interval says otherwise. The HTTP API requires a bearer token
+// when -http-token is set. It runs until interrupted, then
+// closes the servers and the cache.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/vijsourabh/caching"
+	"github.com/vijsourabh/caching/httpapi"
+	"github.com/vijsourabh/caching/memcache"
+	"github.com/vijsourabh/caching/resp"
+)
+
+const (
+	// readHeaderTimeout bounds the time an HTTP client takes to send the
+	// headers of a request, so slow clients can't hold connections open
+	readHeaderTimeout = 10 * time.Second
+	// idleTimeout bounds the time an idle keep-alive HTTP connection is kept
+	idleTimeout = 2 * time.Minute
+)
+
+// server is implemented by the servers of every protocol
+type server interface {
+	ListenAndServe(addr string) error
+	Close() error
+}
+
+// listener is a server to start on addr, named after its protocol
+type listener struct {
+	protocol string
+	addr     string
+	// newServer creates the server of the protocol for cache
+	newServer func(cache caching.Cacher) (server, error)
+	// closed is the error returned by ListenAndServe once the server is closed
+	closed error
+}
+
+func main() {
+	var (
+		respAddr      = flag.String("resp", "127.0.0.1:6379", "address to serve the Redis protocol on; empty to disable")
+		memcachedAddr = flag.String("memcached", "", "address to serve the memcached text protocol on; empty to disable")
+		httpAddr      = flag.String("http", "", "address to serve the HTTP API on; empty to disable")
+		httpToken     = flag.String("http-token", "", "bearer token required by the HTTP API; empty for none")
+		expiry        = flag.Duration("expiry", 0, "expiry of the entries added without one; 0 for none")
+		cleanInterval = flag.Duration("clean-interval", time.Minute, "interval of the removal of expired entries; 0 to remove them only when read")
+		obfuscated    = flag.Bool("obfuscate", false, "encrypt the values held in memory")
+	)
+
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listeners := []listener{
+		{
+			protocol: "the Redis protocol",
+			addr:     *respAddr,
+			newServer: func(cache caching.Cacher) (server, error) {
+				return resp.New(&resp.Params{Cache: cache})
+			},
+			closed: resp.ErrClosed,
+		},
+		{
+			protocol: "the memcached text protocol",
+			addr:     *memcachedAddr,
+			newServer: func(cache caching.Cacher) (server, error) {
+				return memcache.New(&memcache.Params{Cache: cache})
+			},
+			closed: memcache.ErrClosed,
+		},
+		{
+			protocol: "the HTTP API",
+			addr:     *httpAddr,
+			newServer: func(cache caching.Cacher) (server, error) {
+				params := &httpapi.Params{Cache: cache}
+				if *httpToken != "" {
+					params.Middleware = httpapi.BearerToken(*httpToken)
+				}
+
+				handler, err := httpapi.New(params)
+				if err != nil {
+					return nil, err
+				}
+
+				return &httpServer{server: http.Server{
+					Handler:           handler,
+					ReadHeaderTimeout: readHeaderTimeout,
+					IdleTimeout:       idleTimeout,
+				}}, nil
+			},
+			closed: http.ErrServerClosed,
+		},
+	}
+
+	if err := run(ctx, listeners, &caching.CreateCacheParams{
+		Expiry:            *expiry,
+		CleanInterval:     *cleanInterval,
+		IsCacheObfuscated: *obfuscated,
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves a cache created with params on the listeners with an address,
+// until ctx is done or a server fails
+func run(ctx context.Context, listeners []listener, params *caching.CreateCacheParams) error {
+	cache := caching.NewCache(params)
+	defer func() {
+		_ = cache.Close()
+	}()
+
+	var servers []server
+
+	defer func() {
+		for _, server := range servers {
+			_ = server.Close()
+		}
+	}()
+
+	served := make(chan error, len(listeners))
+
+	for _, listener := range listeners {
+		if listener.addr == "" {
+			continue
+		}
+
+		server, err := listener.newServer(cache)
+		if err != nil {
+			return err
+		}
+
+		servers = append(servers, server)
+
+		go func() {
+			if err := server.ListenAndServe(listener.addr); !errors.Is(err, listener.closed) {
+				served <- err
+			}
+		}()
+
+		log.Printf("serving %s on %s", listener.protocol, listener.addr)
+	}
+
+	if len(servers) == 0 {
+		return errors.New("no protocol to serve")
+	}
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// httpServer adapts an http.Server to server
+type httpServer struct {
+	server http.Server
+}
+
+func (server *httpServer) ListenAndServe(addr string) error {
+	server.server.Addr = addr
+
+	return server.server.ListenAndServe()
+}
+
+func (server *httpServer) Close() error {
+	return server.server.Close()
+}
@@ -0,0 +1,268 @@
+package caching
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// CompressionAlgorithm selects the stdlib codec used to compress obfuscated values.
+// Its value doubles as the marker byte prefixed to every stored payload.
+type CompressionAlgorithm byte
+
+const (
+	CompressionNone CompressionAlgorithm = iota
+	CompressionFlate
+	CompressionGzip
+	CompressionZlib
+)
+
+// windowSize is the size of the window of the flate writers, holding the
+// latest data written
+const windowSize = 64 << 10
+
+// zeros overwrite the window of the writers before they are pooled
+var zeros [windowSize]byte
+
+type (
+	// Compressor compresses payloads before they are obfuscated. Every output is
+	// prefixed with a marker byte naming the codec that produced it, so entries
+	// written with different settings (or left uncompressed) can coexist.
+	Compressor struct {
+		algorithm CompressionAlgorithm
+		level     int
+		minSize   int
+		writers   sync.Pool
+	}
+
+	// CompressionParams configures the compression stage of an obfuscated cache.
+	CompressionParams struct {
+		// Algorithm is the codec to use. CompressionNone (the zero value) disables compression.
+		Algorithm CompressionAlgorithm
+		// Level is a compress/flate level, from flate.HuffmanOnly to
+		// flate.BestCompression. Zero selects flate.DefaultCompression.
+		Level int
+		// MinSize is the payload size in bytes below which values are stored uncompressed.
+		MinSize int
+	}
+
+	// compressWriter is implemented by the flate, gzip and zlib writers.
+	compressWriter interface {
+		io.WriteCloser
+		Reset(w io.Writer)
+	}
+
+	// wipingBuffer accumulates data in a slice, zeroing every array it
+	// outgrows so that no copy of the data is left behind
+	wipingBuffer struct {
+		data []byte
+	}
+)
+
+// NewCompressor creates a Compressor from the provided params.
+// Returns an error wrapping ErrInvalidOptions for an unknown algorithm or a
+// level out of range.
+func NewCompressor(params CompressionParams) (*Compressor, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	compressor := &Compressor{
+		algorithm: params.Algorithm,
+		level:     params.Level,
+		minSize:   params.MinSize,
+	}
+
+	if compressor.level == flate.NoCompression {
+		compressor.level = flate.DefaultCompression
+	}
+
+	return compressor, nil
+}
+
+// validate reports the first invalid parameter
+func (params *CompressionParams) validate() error {
+	if params.Algorithm > CompressionZlib {
+		return fmt.Errorf("%w: unknown compression algorithm %d", ErrInvalidOptions, params.Algorithm)
+	}
+
+	if params.Level < flate.HuffmanOnly || params.Level > flate.BestCompression {
+		return fmt.Errorf("%w: compression level %d out of [%d, %d]", ErrInvalidOptions,
+			params.Level, flate.HuffmanOnly, flate.BestCompression)
+	}
+
+	return nil
+}
+
+// Compress returns the marker byte followed by the compressed data. Data shorter
+// than the configured minimum size, or data that doesn't shrink, is stored as-is
+// behind the CompressionNone marker.
+func (compressor *Compressor) Compress(data []byte) ([]byte, error) {
+	return compressor.compressTo(make([]byte, 0, len(data)+1), data)
+}
+
+// compressTo is Compress writing the output over buf, whose array is reused,
+// or zeroed if the output outgrows it
+func (compressor *Compressor) compressTo(buf []byte, data []byte) ([]byte, error) {
+	if compressor.algorithm == CompressionNone || len(data) < compressor.minSize {
+		return frame(buf[:0], CompressionNone, data), nil
+	}
+
+	buffer := &wipingBuffer{data: append(buf[:0], byte(compressor.algorithm))}
+
+	writer, err := compressor.writer(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = writer.Write(data); err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		clear(buffer.data)
+
+		return nil, err
+	}
+
+	compressor.release(writer, len(data))
+
+	if len(buffer.data)-1 > len(data) {
+		clear(buffer.data)
+
+		return frame(buf[:0], CompressionNone, data), nil
+	}
+
+	return buffer.data, nil
+}
+
+// Decompress reverses Compress using the codec named by the marker byte.
+// It does not depend on the compressor settings, so payloads written before a
+// settings change are still readable.
+func (compressor *Compressor) Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("missing compression marker")
+	}
+
+	var (
+		reader io.ReadCloser
+		err    error
+	)
+
+	payload := bytes.NewReader(data[1:])
+
+	switch CompressionAlgorithm(data[0]) {
+	case CompressionNone:
+		return data[1:], nil
+	case CompressionFlate:
+		reader = flate.NewReader(payload)
+	case CompressionGzip:
+		reader, err = gzip.NewReader(payload)
+	case CompressionZlib:
+		reader, err = zlib.NewReader(payload)
+	default:
+		return nil, errors.New("unknown compression marker")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	// Room for a payload compressed down to a quarter, grown as needed
+	buffer := &wipingBuffer{data: make([]byte, 0, 4*len(data))}
+	if _, err = buffer.ReadFrom(reader); err != nil {
+		clear(buffer.data)
+
+		return nil, err
+	}
+
+	return buffer.data, nil
+}
+
+// writer returns a pooled writer for the configured algorithm, reset to write into dst
+func (compressor *Compressor) writer(dst io.Writer) (compressWriter, error) {
+	if writer, ok := compressor.writers.Get().(compressWriter); ok {
+		writer.Reset(dst)
+
+		return writer, nil
+	}
+
+	switch compressor.algorithm {
+	case CompressionFlate:
+		return flate.NewWriter(dst, compressor.level)
+	case CompressionGzip:
+		return gzip.NewWriterLevel(dst, compressor.level)
+	case CompressionZlib:
+		return zlib.NewWriterLevel(dst, compressor.level)
+	default:
+		return nil, errors.New("unknown compression algorithm")
+	}
+}
+
+// release returns writer to the pool, once its window no longer holds the
+// written bytes of data: the next writes overwrite the window from its start
+func (compressor *Compressor) release(writer compressWriter, written int) {
+	writer.Reset(io.Discard)
+
+	if _, err := writer.Write(zeros[:min(written, len(zeros))]); err != nil {
+		return
+	}
+
+	writer.Reset(io.Discard)
+	compressor.writers.Put(writer)
+}
+
+// grow makes room for n more bytes, zeroing the array outgrown
+func (buffer *wipingBuffer) grow(n int) {
+	if cap(buffer.data)-len(buffer.data) >= n {
+		return
+	}
+
+	previous := buffer.data
+	buffer.data = slices.Grow(previous, n)
+	clear(previous)
+}
+
+func (buffer *wipingBuffer) Write(data []byte) (int, error) {
+	buffer.grow(len(data))
+	buffer.data = append(buffer.data, data...)
+
+	return len(data), nil
+}
+
+// ReadFrom reads reader until EOF straight into the buffer, without the
+// intermediate buffer of io.Copy
+func (buffer *wipingBuffer) ReadFrom(reader io.Reader) (int64, error) {
+	var total int64
+
+	for {
+		buffer.grow(bytes.MinRead)
+
+		n, err := reader.Read(buffer.data[len(buffer.data):cap(buffer.data)])
+		buffer.data = buffer.data[:len(buffer.data)+n]
+		total += int64(n)
+
+		if errors.Is(err, io.EOF) {
+			return total, nil
+		}
+
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// frame appends to dst the marker byte of the provided algorithm followed by data
+func frame(dst []byte, algorithm CompressionAlgorithm, data []byte) []byte {
+	dst = append(dst, byte(algorithm))
+
+	return append(dst, data...)
+}
@@ -0,0 +1,90 @@
+package caching
+
+import (
+	"fmt"
+	"time"
+)
+
+// Options is the runtime configuration of a cache. Read it with Cache.Options
+// and change it with Cache.Reconfigure.
+type Options struct {
+	// Expiry is the cache-wide TTL of entries added without a per-key Expiry.
+	// Zero or negative means they never expire. Existing entries keep their expiry.
+	Expiry time.Duration
+	// CleanInterval is the interval of the background cleaner. Zero stops it.
+	// Namespaces share the cleaner of the root cache and ignore it.
+	CleanInterval time.Duration
+}
+
+// Options returns a snapshot of the current runtime configuration. The
+// CleanInterval of a namespace is that of the root cache, whose cleaner it shares.
+func (cache *Cache) Options() Options {
+	options := *cache.config.Load()
+	options.CleanInterval = cache.root.config.Load().CleanInterval
+
+	return options
+}
+
+// Reconfigure validates options and replaces the whole runtime configuration
+// with them. The cleaner picks up a new CleanInterval immediately.
+// It is safe to call concurrently with any other method, without holding Lock:
+// every operation sees either the old or the new configuration, never a mix.
+// Namespaces share the cleaner of the root cache and ignore CleanInterval.
+// Returns an error wrapping ErrInvalidOptions, leaving the configuration
+// unchanged, if options are rejected, and ErrClosed once the cache has been closed.
+func (cache *Cache) Reconfigure(options Options) error {
+	return cache.reconfigure(func(current *Options) {
+		*current = options
+	}, false)
+}
+
+// reconfigure applies fn to a copy of the current configuration and, if the
+// result is valid, publishes it and notifies the cleaner. Reconfigurations are
+// serialised so concurrent callers never lose each other's changes.
+// applyToExisting also applies the new expiry to existing entries.
+func (cache *Cache) reconfigure(fn func(options *Options), applyToExisting bool) error {
+	cache.configLock.Lock()
+	defer cache.configLock.Unlock()
+
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	options := cache.Options()
+	fn(&options)
+
+	if !cache.isRoot() {
+		// Namespaces share the cleaner of the root cache.
+		options.CleanInterval = cache.root.Options().CleanInterval
+	}
+
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	cache.config.Store(&options)
+
+	if applyToExisting {
+		cache.applyExpiry(options.Expiry)
+	}
+
+	// Only the root cache runs a cleaner. Non-blocking send: a pending signal
+	// already makes the cleaner load the latest configuration.
+	if cache.isRoot() {
+		select {
+		case cache.configCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// validate reports the first invalid option
+func (options *Options) validate() error {
+	if options.CleanInterval < 0 {
+		return fmt.Errorf("%w: negative clean interval %v", ErrInvalidOptions, options.CleanInterval)
+	}
+
+	return nil
+}
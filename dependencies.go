@@ -0,0 +1,102 @@
+package caching
+
+import (
+	"fmt"
+	"slices"
+)
+
+// checkDependencies reports whether an entry for key may depend on the keys of
+// dependencies: they must not lead back to key, through the dependencies of
+// the stored entries, nor form a chain longer than MaxDependencyDepth.
+//
+// Dependencies added concurrently may still close a cycle; cascade removes
+// every entry at most once, so it terminates anyway.
+func (cache *Cache) checkDependencies(key any, dependencies []any) error {
+	if len(dependencies) == 0 {
+		return nil
+	}
+
+	// depths memoises the length of the longest dependency chain above a key.
+	depths := make(map[any]int)
+
+	var depthOf func(dependency any, level int) (int, error)
+	depthOf = func(dependency any, level int) (int, error) {
+		if dependency == key {
+			return 0, newKeyError(key, ErrDependencyCycle, fmt.Errorf("through key %v", dependency))
+		}
+
+		if level > cache.maxDepth {
+			return 0, newKeyError(key, ErrDependencyDepth, fmt.Errorf("longer than %d", cache.maxDepth))
+		}
+
+		if depth, found := depths[dependency]; found {
+			return depth, nil
+		}
+
+		entry, found := cache.load(dependency)
+		if !found {
+			return 0, nil
+		}
+
+		depth := 0
+		for _, parent := range entry.dependsOn {
+			parentDepth, err := depthOf(parent, level+1)
+			if err != nil {
+				return 0, err
+			}
+
+			depth = max(depth, parentDepth+1)
+		}
+
+		depths[dependency] = depth
+
+		return depth, nil
+	}
+
+	for _, dependency := range dependencies {
+		depth, err := depthOf(dependency, 1)
+		if err != nil {
+			return err
+		}
+
+		if depth+1 > cache.maxDepth {
+			return newKeyError(key, ErrDependencyDepth, fmt.Errorf("longer than %d", cache.maxDepth))
+		}
+	}
+
+	return nil
+}
+
+// cascade removes the entries depending on key, which has been removed or
+// changed, then their own dependents, and publishes their removal. Failures
+// to publish are not reported: the caller publishes key, whose removal the
+// other processes cascade in turn.
+func (cache *Cache) cascade(key any) {
+	_ = cache.publish(cache.removeDependents(key, 1)...)
+}
+
+// removeDependents removes the entries depending on key, then their own
+// dependents, depth being the level of the dependents being removed. Levels
+// beyond MaxDependencyDepth are left in place. Returns the removed keys.
+func (cache *Cache) removeDependents(key any, depth int) []any {
+	if depth > cache.maxDepth {
+		return nil
+	}
+
+	var removed []any
+
+	for _, dependent := range cache.dependents.keys(key) {
+		entry, found := cache.load(dependent)
+		if !found || !slices.Contains(entry.dependsOn, key) {
+			continue
+		}
+
+		if cache.compareAndDelete(dependent, entry, EventRemove) {
+			cache.forget(dependent, entry)
+			removed = append(removed, dependent)
+			removed = append(removed, cache.removeDependents(dependent, depth+1)...)
+		}
+	}
+
+	return removed
+}
@@ -0,0 +1,121 @@
+package caching
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when the key doesn't exist in the cache
+	ErrNotFound = errors.New("key not found in the cache")
+	// ErrExpired is returned when the key existed but its expiry has elapsed.
+	// The entry is removed, so subsequent lookups report ErrNotFound.
+	ErrExpired = errors.New("key expired in the cache")
+	// ErrEncode is returned when a value can't be JSON-encoded or compressed for an obfuscated cache
+	ErrEncode = errors.New("unable to encode the value")
+	// ErrEncrypt is returned when a value can't be obfuscated
+	ErrEncrypt = errors.New("unable to encrypt the value")
+	// ErrDecrypt is returned when a cached value fails to deobfuscate
+	ErrDecrypt = errors.New("unable to decrypt the cached value")
+	// ErrDecode is returned when a cached value can't be decompressed or JSON-decoded into the destination
+	ErrDecode = errors.New("unable to decode the cached value")
+	// ErrClosed is returned by operations on a cache, or an Obfuscator, that has been shut down
+	ErrClosed = errors.New("cache is closed")
+	// ErrInvalidOptions is returned by Reconfigure when the provided Options are rejected
+	ErrInvalidOptions = errors.New("invalid cache options")
+	// ErrDependencyCycle is returned when the dependencies of an added entry lead back to its key
+	ErrDependencyCycle = errors.New("dependency cycle")
+	// ErrDependencyDepth is returned when the dependencies of an added entry exceed MaxDependencyDepth
+	ErrDependencyDepth = errors.New("dependency chain too deep")
+	// ErrStore is returned when the backing store of a cache fails to load, save or delete a key
+	ErrStore = errors.New("backing store failed")
+	// ErrRemote is returned when the remote cache of a TieredCache fails to get, set or delete a key
+	ErrRemote = errors.New("remote cache failed")
+	// ErrInvalidation is returned when a cache fails to publish the invalidation of a key it changed.
+	// The change itself is applied.
+	ErrInvalidation = errors.New("unable to publish the invalidation")
+	// ErrNotReplicated is returned by Snapshot and Events on a cache created without replication
+	ErrNotReplicated = errors.New("cache is not replicated")
+	// ErrLogPosition is returned by Events when the replication log doesn't
+	// hold the events following the position: it is a position of another
+	// log, or they have been overwritten. Followers then need a new Snapshot.
+	ErrLogPosition = errors.New("position not held by the replication log")
+)
+
+// KeyError records a failed cache operation together with the key it was performed on.
+// Err wraps one of the sentinel errors above and, where available, the underlying cause,
+// so callers can branch with errors.Is and errors.As.
+type KeyError struct {
+	Key any
+	Err error
+}
+
+func (keyError *KeyError) Error() string {
+	return fmt.Sprintf("key %v: %v", keyError.Key, keyError.Err)
+}
+
+func (keyError *KeyError) Unwrap() error {
+	return keyError.Err
+}
+
+// BatchError records the keys that failed in a batch operation, in batch order.
+// The other keys of the batch were applied. errors.Is and errors.As match any of
+// the failures.
+type BatchError struct {
+	Errors []*KeyError
+}
+
+func (batchError *BatchError) Error() string {
+	messages := make([]string, len(batchError.Errors))
+	for i, keyError := range batchError.Errors {
+		messages[i] = keyError.Error()
+	}
+
+	return fmt.Sprintf("%d keys failed: %s", len(batchError.Errors), strings.Join(messages, "; "))
+}
+
+func (batchError *BatchError) Unwrap() []error {
+	errs := make([]error, len(batchError.Errors))
+	for i, keyError := range batchError.Errors {
+		errs[i] = keyError
+	}
+
+	return errs
+}
+
+// add records err, if not nil, as a failure of the batch for key. Errors
+// other than a *KeyError, such as ErrClosed, are wrapped in one for key.
+func (batchError *BatchError) add(key any, err error) {
+	if err == nil {
+		return
+	}
+
+	var keyError *KeyError
+	if !errors.As(err, &keyError) {
+		keyError = newKeyError(key, err, nil)
+	}
+
+	batchError.Errors = append(batchError.Errors, keyError)
+}
+
+// err returns the batch error, or nil when no key failed
+func (batchError *BatchError) err() error {
+	if len(batchError.Errors) == 0 {
+		return nil
+	}
+
+	return batchError
+}
+
+// newKeyError wraps the sentinel err, and the underlying cause when not nil, for the provided key
+func newKeyError(key any, err error, cause error) *KeyError {
+	if cause != nil {
+		err = fmt.Errorf("%w: %w", err, cause)
+	}
+
+	return &KeyError{
+		Key: key,
+		Err: err,
+	}
+}
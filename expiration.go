@@ -0,0 +1,103 @@
+package caching
+
+import (
+	"time"
+)
+
+// Expire sets the entry for the provided key to expire after d, without
+// touching its value. A non-positive d removes the entry immediately.
+// Returns a *KeyError wrapping ErrNotFound or ErrExpired if the key doesn't
+// exist, and ErrInvalidation if publishing a removal fails.
+func (cache *Cache) Expire(key any, d time.Duration) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	err := cache.modify(key, func(entry cacheEntry, now time.Time) *cacheEntry {
+		if d <= 0 {
+			return nil
+		}
+
+		entry.expiry = d
+		entry.expiresAt = now.Add(d)
+		entry.inheritsExpiry = false
+
+		return &entry
+	})
+	if err != nil || d > 0 {
+		return err
+	}
+
+	if keyErrors := cache.publish(key); len(keyErrors) > 0 {
+		return keyErrors[0]
+	}
+
+	return nil
+}
+
+// ExpireAt sets the entry for the provided key to expire at t, without
+// touching its value. A t that is not in the future removes the entry immediately.
+// Returns a *KeyError wrapping ErrNotFound or ErrExpired if the key doesn't
+// exist, and ErrInvalidation if publishing a removal fails.
+func (cache *Cache) ExpireAt(key any, t time.Time) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	removed := false
+
+	err := cache.modify(key, func(entry cacheEntry, now time.Time) *cacheEntry {
+		if removed = !t.After(now); removed {
+			return nil
+		}
+
+		entry.expiry = t.Sub(now)
+		entry.expiresAt = t
+		entry.inheritsExpiry = false
+
+		return &entry
+	})
+	if err != nil || !removed {
+		return err
+	}
+
+	if keyErrors := cache.publish(key); len(keyErrors) > 0 {
+		return keyErrors[0]
+	}
+
+	return nil
+}
+
+// Persist removes the expiry of the entry for the provided key, so that it
+// never expires. Returns a *KeyError wrapping ErrNotFound or ErrExpired if the
+// key doesn't exist.
+func (cache *Cache) Persist(key any) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	return cache.modify(key, func(entry cacheEntry, _ time.Time) *cacheEntry {
+		entry.expiry = defaultExpiry
+		entry.expiresAt = time.Time{}
+		entry.inheritsExpiry = false
+
+		return &entry
+	})
+}
+
+// Touch restarts the expiry of the entry for the provided key: it expires a
+// full TTL from now. Entries that never expire are left as-is.
+// Returns a *KeyError wrapping ErrNotFound or ErrExpired if the key doesn't exist.
+func (cache *Cache) Touch(key any) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	return cache.modify(key, func(entry cacheEntry, now time.Time) *cacheEntry {
+		if entry.expiry > 0 {
+			entry.expiresAt = now.Add(entry.expiry)
+		}
+
+		return &entry
+	})
+}
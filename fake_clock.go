@@ -0,0 +1,114 @@
+package caching
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// FakeClock is a Clock that only moves when Advance is called. It lets tests
+	// drive both lazy expiry and the background cleaner without sleeping.
+	FakeClock struct {
+		lock    sync.Mutex
+		now     time.Time
+		tickers []*fakeTicker // running tickers: Stop removes them, Reset adds them back
+	}
+
+	// fakeTicker is a Ticker fired by FakeClock.Advance
+	fakeTicker struct {
+		clock   *FakeClock
+		ch      chan time.Time
+		period  time.Duration
+		next    time.Time
+		stopped bool
+	}
+)
+
+// NewFakeClock creates a FakeClock set to the provided time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now: now,
+	}
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	return clock.now
+}
+
+// NewTicker returns a Ticker that fires every d of fake time.
+// Like time.NewTicker, it panics if d is not positive.
+func (clock *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	ticker := &fakeTicker{
+		clock:  clock,
+		ch:     make(chan time.Time, 1),
+		period: d,
+		next:   clock.now.Add(d),
+	}
+	clock.tickers = append(clock.tickers, ticker)
+
+	return ticker
+}
+
+// Advance moves the clock forward by d and fires every ticker whose next tick
+// has been reached. As with time.Ticker, ticks are dropped for slow receivers.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	clock.now = clock.now.Add(d)
+
+	for _, ticker := range clock.tickers {
+		if ticker.next.After(clock.now) {
+			continue
+		}
+
+		select {
+		case ticker.ch <- clock.now:
+		default:
+		}
+
+		for !ticker.next.After(clock.now) {
+			ticker.next = ticker.next.Add(ticker.period)
+		}
+	}
+}
+
+func (ticker *fakeTicker) C() <-chan time.Time {
+	return ticker.ch
+}
+
+func (ticker *fakeTicker) Reset(d time.Duration) {
+	ticker.clock.lock.Lock()
+	defer ticker.clock.lock.Unlock()
+
+	ticker.period = d
+	ticker.next = ticker.clock.now.Add(d)
+
+	if ticker.stopped {
+		ticker.stopped = false
+		ticker.clock.tickers = append(ticker.clock.tickers, ticker)
+	}
+}
+
+func (ticker *fakeTicker) Stop() {
+	ticker.clock.lock.Lock()
+	defer ticker.clock.lock.Unlock()
+
+	if !ticker.stopped {
+		ticker.stopped = true
+		ticker.clock.tickers = slices.DeleteFunc(ticker.clock.tickers, func(other *fakeTicker) bool {
+			return other == ticker
+		})
+	}
+}
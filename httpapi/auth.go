@@ -0,0 +1,41 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// BearerToken returns a Middleware accepting the requests authenticated with
+// one of tokens in an "Authorization: Bearer" header, and rejecting the others
+// with 401 Unauthorized
+func BearerToken(tokens ...string) func(next http.Handler) http.Handler {
+	// Hashes have the same length, so comparing them takes the same time
+	// whatever the length of the token sent.
+	digests := make([][sha256.Size]byte, len(tokens))
+	for i, token := range tokens {
+		digests[i] = sha256.Sum256([]byte(token))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+			digest := sha256.Sum256([]byte(token))
+
+			var valid int
+			for _, candidate := range digests {
+				valid |= subtle.ConstantTimeCompare(digest[:], candidate[:])
+			}
+
+			if !found || valid == 0 {
+				writer.Header().Set("WWW-Authenticate", `Bearer realm="cache"`)
+				writeStatus(writer, http.StatusUnauthorized, errUnauthorized)
+
+				return
+			}
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
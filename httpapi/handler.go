@@ -0,0 +1,538 @@
+// Package httpapi exposes a cache over HTTP as a JSON API, to inspect, change
+// and purge entries and to reconfigure the cache without writing Go.
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vijsourabh/caching"
+)
+
+const (
+	// TTLHeader carries the time left before an entry expires, in seconds, on
+	// the responses of GET /keys/{key}: -1 for an entry that never expires.
+	// On PUT /keys/{key} it sets the expiry, in seconds or as a Go duration.
+	TTLHeader = "X-Cache-TTL"
+	// TagsHeader carries the comma-separated tags of the entry set by PUT /keys/{key}
+	TagsHeader = "X-Cache-Tags"
+
+	defaultMaxBodySize = 1 << 20
+	defaultListLimit   = 1000
+)
+
+var (
+	// ErrInvalidParams is returned by New when the provided Params are rejected
+	ErrInvalidParams = errors.New("invalid HTTP API params")
+
+	errUnauthorized = errors.New("unauthorized")
+)
+
+type (
+	// Params configures New
+	Params struct {
+		// Cache is the cache served. Required.
+		Cache caching.Cacher
+		// Middleware wraps every route, typically to authenticate requests,
+		// see BearerToken. None when nil.
+		Middleware func(next http.Handler) http.Handler
+		// RedactValues also redacts the values of a non-obfuscated cache.
+		// Values of an obfuscated cache are always redacted.
+		RedactValues bool
+		// MaxBodySize is the size of the largest request body. Defaults to 1 MiB.
+		MaxBodySize int64
+	}
+
+	// Handler serves the routes of the API:
+	//
+	//	GET    /keys/{key}  the value and metadata of an entry
+	//	PUT    /keys/{key}  add an entry, with a JSON body
+	//	DELETE /keys/{key}  remove an entry
+	//	GET    /keys        list entries, without values, filtered by ?prefix= and bounded by ?limit=
+	//	POST   /purge       remove entries by keys, tags or key prefix, or all of them
+	//	GET    /stats       the counters of the cache
+	//	GET    /config      the runtime configuration
+	//	PATCH  /config      change the runtime configuration with Reconfigure
+	Handler struct {
+		cache       caching.Cacher
+		redact      bool
+		maxBodySize int64
+		handler     http.Handler
+	}
+
+	// entryResponse describes an entry. Value is the JSON encoding of the
+	// cached value, omitted when listing entries and when redacted.
+	entryResponse struct {
+		Key        string          `json:"key"`
+		Value      json.RawMessage `json:"value,omitempty"`
+		Redacted   bool            `json:"redacted,omitempty"`
+		Version    uint64          `json:"version"`
+		InsertedAt time.Time       `json:"insertedAt"`
+		ExpiresAt  *time.Time      `json:"expiresAt,omitempty"`
+		Tags       []string        `json:"tags,omitempty"`
+		Size       int             `json:"size,omitempty"`
+	}
+
+	listResponse struct {
+		Keys []entryResponse `json:"keys"`
+		// Truncated is set when more entries than the limit matched
+		Truncated bool `json:"truncated"`
+	}
+
+	// purgeRequest selects the entries removed by POST /purge. An empty
+	// request removes every entry.
+	purgeRequest struct {
+		Keys   []string `json:"keys"`
+		Tags   []string `json:"tags"`
+		Prefix string   `json:"prefix"`
+	}
+
+	statsResponse struct {
+		Hits      uint64 `json:"hits"`
+		Misses    uint64 `json:"misses"`
+		Adds      uint64 `json:"adds"`
+		Evictions uint64 `json:"evictions"`
+		Len       int    `json:"len"`
+	}
+
+	configResponse struct {
+		Expiry        duration `json:"expiry"`
+		CleanInterval duration `json:"cleanInterval"`
+	}
+
+	// configRequest is the body of PATCH /config. Omitted fields are left
+	// unchanged, and a zero CleanInterval stops the cleaner, as with Reconfigure.
+	configRequest struct {
+		Expiry          *duration `json:"expiry"`
+		CleanInterval   *duration `json:"cleanInterval"`
+		ApplyToExisting bool      `json:"applyToExisting"`
+	}
+
+	// duration is a time.Duration encoded in JSON as a Go duration string, such as "1m30s"
+	duration time.Duration
+
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+var _ http.Handler = (*Handler)(nil)
+
+// New creates the handler of the API for params.Cache
+func New(params *Params) (*Handler, error) {
+	if params.Cache == nil {
+		return nil, fmt.Errorf("%w: no cache", ErrInvalidParams)
+	}
+
+	handler := &Handler{
+		cache:       params.Cache,
+		redact:      params.RedactValues,
+		maxBodySize: params.MaxBodySize,
+	}
+
+	if handler.maxBodySize <= 0 {
+		handler.maxBodySize = defaultMaxBodySize
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /keys/{key}", handler.get)
+	mux.HandleFunc("PUT /keys/{key}", handler.put)
+	mux.HandleFunc("DELETE /keys/{key}", handler.delete)
+	mux.HandleFunc("GET /keys", handler.list)
+	mux.HandleFunc("POST /purge", handler.purge)
+	mux.HandleFunc("GET /stats", handler.stats)
+	mux.HandleFunc("GET /config", handler.config)
+	mux.HandleFunc("PATCH /config", handler.reconfigure)
+
+	handler.handler = mux
+	if params.Middleware != nil {
+		handler.handler = params.Middleware(mux)
+	}
+
+	return handler, nil
+}
+
+func (handler *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	handler.handler.ServeHTTP(writer, request)
+}
+
+// get responds with the entry of the key, its TTL in TTLHeader and its version as ETag
+func (handler *Handler) get(writer http.ResponseWriter, request *http.Request) {
+	key := request.PathValue("key")
+	redacted := handler.redact || handler.cache.IsObfuscated()
+
+	var value []byte
+
+	if !redacted {
+		var err error
+		if value, err = handler.cache.GetBytes(key, nil); err != nil {
+			writeError(writer, err)
+
+			return
+		}
+	}
+
+	info, found := handler.cache.Info(key)
+	if !found {
+		writeError(writer, caching.ErrNotFound)
+
+		return
+	}
+
+	ttl, found := handler.cache.TTL(key)
+	if !found {
+		writeError(writer, caching.ErrNotFound)
+
+		return
+	}
+
+	seconds := int64(-1)
+	if ttl >= 0 {
+		seconds = int64(math.Ceil(ttl.Seconds()))
+	}
+
+	writer.Header().Set(TTLHeader, strconv.FormatInt(seconds, 10))
+	writer.Header().Set("ETag", strconv.Quote(strconv.FormatUint(info.Version, 10)))
+
+	response := describe(key, info)
+	response.Value = value
+	response.Redacted = redacted
+
+	writeJSON(writer, http.StatusOK, response)
+}
+
+// put adds the entry of the key with the JSON value of the body, the expiry
+// of TTLHeader and the tags of TagsHeader
+func (handler *Handler) put(writer http.ResponseWriter, request *http.Request) {
+	expiry, err := parseTTL(request.Header.Get(TTLHeader))
+	if err != nil {
+		writeStatus(writer, http.StatusBadRequest, err)
+
+		return
+	}
+
+	body, ok := handler.readBody(writer, request)
+	if !ok {
+		return
+	}
+
+	if !json.Valid(body) {
+		writeStatus(writer, http.StatusBadRequest, errors.New("the body is not a JSON value"))
+
+		return
+	}
+
+	var tags []string
+	for tag := range strings.SplitSeq(request.Header.Get(TagsHeader), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	err = handler.cache.Add(&caching.AddCacheParams{
+		Key:    request.PathValue("key"),
+		Value:  json.RawMessage(body),
+		Expiry: expiry,
+		Tags:   tags,
+	})
+	if err != nil {
+		writeError(writer, err)
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// delete removes the entry of the key, responding with 404 if it didn't exist
+func (handler *Handler) delete(writer http.ResponseWriter, request *http.Request) {
+	key := request.PathValue("key")
+
+	_, found := handler.cache.TTL(key)
+	if err := handler.cache.Remove(key); err != nil {
+		writeError(writer, err)
+
+		return
+	}
+
+	if !found {
+		writeError(writer, caching.ErrNotFound)
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// list responds with the entries whose key, formatted with fmt.Sprint, starts
+// with the prefix parameter, sorted by key and without their values
+func (handler *Handler) list(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	prefix := query.Get("prefix")
+
+	limit := defaultListLimit
+	if query.Has("limit") {
+		var err error
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit < 1 {
+			writeStatus(writer, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+
+			return
+		}
+	}
+
+	response := listResponse{Keys: []entryResponse{}}
+
+	for _, key := range handler.matching(prefix) {
+		if info, found := handler.cache.Info(key); found {
+			response.Keys = append(response.Keys, describe(fmt.Sprint(key), info))
+		}
+	}
+
+	slices.SortFunc(response.Keys, func(a, b entryResponse) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	if len(response.Keys) > limit {
+		response.Keys, response.Truncated = response.Keys[:limit], true
+	}
+
+	writeJSON(writer, http.StatusOK, response)
+}
+
+// purge removes the entries selected by the purgeRequest of the body
+func (handler *Handler) purge(writer http.ResponseWriter, request *http.Request) {
+	body, ok := handler.readBody(writer, request)
+	if !ok {
+		return
+	}
+
+	var purge purgeRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &purge); err != nil {
+			writeStatus(writer, http.StatusBadRequest, err)
+
+			return
+		}
+	}
+
+	if len(purge.Keys) == 0 && len(purge.Tags) == 0 && purge.Prefix == "" {
+		if err := handler.cache.Clear(); err != nil {
+			writeError(writer, err)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	keys := make([]any, 0, len(purge.Keys))
+	for _, key := range purge.Keys {
+		keys = append(keys, key)
+	}
+
+	if purge.Prefix != "" {
+		keys = append(keys, handler.matching(purge.Prefix)...)
+	}
+
+	err := handler.cache.RemoveMany(keys...)
+	if len(purge.Tags) > 0 {
+		err = errors.Join(err, handler.cache.InvalidateTags(purge.Tags...))
+	}
+
+	if err != nil {
+		writeError(writer, err)
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (handler *Handler) stats(writer http.ResponseWriter, _ *http.Request) {
+	stats := handler.cache.Stats()
+
+	writeJSON(writer, http.StatusOK, statsResponse{
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Adds:      stats.Adds,
+		Evictions: stats.Evictions,
+		Len:       stats.Len,
+	})
+}
+
+func (handler *Handler) config(writer http.ResponseWriter, _ *http.Request) {
+	options := handler.cache.Options()
+
+	writeJSON(writer, http.StatusOK, configResponse{
+		Expiry:        duration(options.Expiry),
+		CleanInterval: duration(options.CleanInterval),
+	})
+}
+
+// reconfigure applies the configRequest of the body with Reconfigure, and to
+// the existing entries with UpdateTime if asked, then responds with the new
+// configuration
+func (handler *Handler) reconfigure(writer http.ResponseWriter, request *http.Request) {
+	body, ok := handler.readBody(writer, request)
+	if !ok {
+		return
+	}
+
+	var config configRequest
+	if err := json.Unmarshal(body, &config); err != nil {
+		writeStatus(writer, http.StatusBadRequest, err)
+
+		return
+	}
+
+	options := handler.cache.Options()
+
+	if config.Expiry != nil {
+		options.Expiry = time.Duration(*config.Expiry)
+	}
+
+	if config.CleanInterval != nil {
+		options.CleanInterval = time.Duration(*config.CleanInterval)
+	}
+
+	if err := handler.cache.Reconfigure(options); err != nil {
+		writeError(writer, err)
+
+		return
+	}
+
+	if config.ApplyToExisting {
+		// Reconfigure leaves the expiry of the existing entries as it is.
+		handler.cache.UpdateTime(&caching.UpdateCacheTimeParams{Expiry: options.Expiry, ApplyToExisting: true})
+	}
+
+	handler.config(writer, request)
+}
+
+// matching returns the keys, formatted with fmt.Sprint, starting with prefix
+func (handler *Handler) matching(prefix string) []any {
+	var keys []any
+
+	for key := range handler.cache.Keys() {
+		if strings.HasPrefix(fmt.Sprint(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// readBody returns the body of request, or responds with an error and returns
+// false if it can't be read or is larger than MaxBodySize
+func (handler *Handler) readBody(writer http.ResponseWriter, request *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, handler.maxBodySize))
+	if err == nil {
+		return body, true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeStatus(writer, http.StatusRequestEntityTooLarge, err)
+	} else {
+		writeStatus(writer, http.StatusBadRequest, err)
+	}
+
+	return nil, false
+}
+
+// describe returns the metadata of the entry of key
+func describe(key string, info *caching.EntryInfo) entryResponse {
+	response := entryResponse{
+		Key:        key,
+		Version:    info.Version,
+		InsertedAt: info.InsertionTime,
+		Tags:       info.Tags,
+		Size:       info.Size,
+	}
+
+	if !info.ExpiresAt.IsZero() {
+		response.ExpiresAt = &info.ExpiresAt
+	}
+
+	return response
+}
+
+// parseTTL parses the value of TTLHeader: a number of seconds or a Go
+// duration. An empty value is the expiry of the cache.
+func parseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds <= 0 || seconds > math.MaxInt64/int64(time.Second) {
+			return 0, fmt.Errorf("invalid %s %q", TTLHeader, value)
+		}
+
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", TTLHeader, value)
+	}
+
+	return ttl, nil
+}
+
+// writeError responds with err, returned by the cache, and the status it maps to
+func writeError(writer http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, caching.ErrNotFound) || errors.Is(err, caching.ErrExpired):
+		status = http.StatusNotFound
+	case errors.Is(err, caching.ErrClosed):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, caching.ErrDependencyCycle) || errors.Is(err, caching.ErrDependencyDepth),
+		errors.Is(err, caching.ErrInvalidOptions):
+		status = http.StatusBadRequest
+	}
+
+	writeStatus(writer, status, err)
+}
+
+func writeStatus(writer http.ResponseWriter, status int, err error) {
+	writeJSON(writer, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(writer http.ResponseWriter, status int, response any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(response)
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = duration(parsed)
+
+	return nil
+}
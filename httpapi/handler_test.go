@@ -0,0 +1,236 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vijsourabh/caching"
+)
+
+// newHandler serves a new cache created with cacheParams, closed at the end of the test
+func newHandler(test *testing.T, cacheParams *caching.CreateCacheParams, params Params) (*caching.Cache, http.Handler) {
+	cache := caching.NewCache(cacheParams)
+	test.Cleanup(func() {
+		_ = cache.Close()
+	})
+
+	params.Cache = cache
+
+	handler, err := New(&params)
+	require.NoError(test, err)
+
+	return cache, handler
+}
+
+// serve sends a request with body and headers, given as name and value pairs
+func serve(handler http.Handler, method string, target string, body string, headers ...string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func decode[T any](test *testing.T, recorder *httptest.ResponseRecorder) T {
+	var response T
+	require.NoError(test, json.Unmarshal(recorder.Body.Bytes(), &response))
+
+	return response
+}
+
+func TestService_Handler(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("entries are put, read and deleted", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := caching.NewFakeClock(time.Now())
+		cache, handler := newHandler(test, &caching.CreateCacheParams{Clock: clock}, Params{})
+
+		recorder := serve(handler, http.MethodPut, "/keys/user:1", `{"name":"Ada"}`, TTLHeader, "90", TagsHeader, "users, admins")
+		require.Equal(test, http.StatusNoContent, recorder.Code)
+
+		var value any
+		require.NoError(test, cache.Get("user:1", &value))
+		require.JSONEq(test, `{"name":"Ada"}`, string(value.(json.RawMessage)))
+
+		clock.Advance(30 * time.Second)
+
+		recorder = serve(handler, http.MethodGet, "/keys/user:1", "")
+		require.Equal(test, http.StatusOK, recorder.Code)
+		require.Equal(test, "60", recorder.Header().Get(TTLHeader))
+
+		entry := decode[entryResponse](test, recorder)
+		require.Equal(test, "user:1", entry.Key)
+		require.JSONEq(test, `{"name":"Ada"}`, string(entry.Value))
+		require.False(test, entry.Redacted)
+		require.Equal(test, []string{"admins", "users"}, entry.Tags)
+		require.NotNil(test, entry.ExpiresAt)
+		require.Equal(test, strconv.Quote(strconv.FormatUint(entry.Version, 10)), recorder.Header().Get("ETag"))
+
+		// Go durations are accepted too, and entries without expiry report -1.
+		require.Equal(test, http.StatusNoContent, serve(handler, http.MethodPut, "/keys/short", `1`, TTLHeader, "1m30s").Code)
+		ttl, _ := cache.TTL("short")
+		require.Equal(test, 90*time.Second, ttl)
+		require.Equal(test, http.StatusNoContent, serve(handler, http.MethodPut, "/keys/forever", `"x"`).Code)
+		require.Equal(test, "-1", serve(handler, http.MethodGet, "/keys/forever", "").Header().Get(TTLHeader))
+
+		require.Equal(test, http.StatusBadRequest, serve(handler, http.MethodPut, "/keys/bad", `{`).Code)
+		require.Equal(test, http.StatusBadRequest, serve(handler, http.MethodPut, "/keys/bad", `1`, TTLHeader, "-5").Code)
+
+		require.Equal(test, http.StatusNoContent, serve(handler, http.MethodDelete, "/keys/user:1", "").Code)
+		require.Equal(test, http.StatusNotFound, serve(handler, http.MethodDelete, "/keys/user:1", "").Code)
+
+		recorder = serve(handler, http.MethodGet, "/keys/user:1", "")
+		require.Equal(test, http.StatusNotFound, recorder.Code)
+		require.Contains(test, decode[errorResponse](test, recorder).Error, caching.ErrNotFound.Error())
+	})
+
+	test.Run("values are redacted for obfuscated caches", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, handler := newHandler(test, &caching.CreateCacheParams{IsCacheObfuscated: true}, Params{})
+
+		require.Equal(test, http.StatusNoContent, serve(handler, http.MethodPut, "/keys/secret", `{"password":"hunter2"}`).Code)
+
+		var value map[string]string
+		require.NoError(test, cache.Get("secret", &value))
+		require.Equal(test, "hunter2", value["password"])
+
+		recorder := serve(handler, http.MethodGet, "/keys/secret", "")
+		require.Equal(test, http.StatusOK, recorder.Code)
+		require.NotContains(test, recorder.Body.String(), "hunter2")
+
+		entry := decode[entryResponse](test, recorder)
+		require.True(test, entry.Redacted)
+		require.Empty(test, entry.Value)
+		require.Positive(test, entry.Size)
+
+		_, handler = newHandler(test, &caching.CreateCacheParams{}, Params{RedactValues: true})
+		require.Equal(test, http.StatusNoContent, serve(handler, http.MethodPut, "/keys/secret", `"hunter2"`).Code)
+		require.NotContains(test, serve(handler, http.MethodGet, "/keys/secret", "").Body.String(), "hunter2")
+	})
+
+	test.Run("entries are listed by prefix and purged", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, handler := newHandler(test, &caching.CreateCacheParams{}, Params{})
+
+		for _, key := range []string{"user:2", "user:1", "user:3", "order:1"} {
+			require.NoError(test, cache.Add(&caching.AddCacheParams{Key: key, Value: 1}))
+		}
+
+		require.NoError(test, cache.Add(&caching.AddCacheParams{Key: "tagged", Value: 1, Tags: []string{"t"}}))
+
+		list := decode[listResponse](test, serve(handler, http.MethodGet, "/keys?prefix=user:", ""))
+		require.False(test, list.Truncated)
+		require.Len(test, list.Keys, 3)
+		require.Equal(test, "user:1", list.Keys[0].Key)
+		require.Empty(test, list.Keys[0].Value)
+
+		list = decode[listResponse](test, serve(handler, http.MethodGet, "/keys?limit=2", ""))
+		require.True(test, list.Truncated)
+		require.Len(test, list.Keys, 2)
+		require.Equal(test, http.StatusBadRequest, serve(handler, http.MethodGet, "/keys?limit=0", "").Code)
+
+		require.Equal(test, http.StatusNoContent, serve(handler, http.MethodPost, "/purge", `{"prefix":"user:","keys":["order:1"],"tags":["t"]}`).Code)
+		require.Equal(test, 0, cache.Len())
+
+		require.NoError(test, cache.Add(&caching.AddCacheParams{Key: "key", Value: 1}))
+		require.Equal(test, http.StatusNoContent, serve(handler, http.MethodPost, "/purge", "").Code)
+		require.Equal(test, 0, cache.Len())
+
+		require.Equal(test, http.StatusBadRequest, serve(handler, http.MethodPost, "/purge", `[`).Code)
+	})
+
+	test.Run("stats and config are read and changed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, handler := newHandler(test, &caching.CreateCacheParams{
+			Expiry:        time.Minute,
+			CleanInterval: time.Hour,
+		}, Params{})
+
+		require.NoError(test, cache.Add(&caching.AddCacheParams{Key: "key", Value: 1}))
+		require.Equal(test, http.StatusOK, serve(handler, http.MethodGet, "/keys/key", "").Code)
+		require.Equal(test, http.StatusNotFound, serve(handler, http.MethodGet, "/keys/missing", "").Code)
+
+		stats := decode[statsResponse](test, serve(handler, http.MethodGet, "/stats", ""))
+		require.Equal(test, statsResponse{Hits: 1, Misses: 1, Adds: 1, Len: 1}, stats)
+
+		config := decode[map[string]string](test, serve(handler, http.MethodGet, "/config", ""))
+		require.Equal(test, map[string]string{"expiry": "1m0s", "cleanInterval": "1h0m0s"}, config)
+
+		recorder := serve(handler, http.MethodPatch, "/config", `{"expiry":"10m","applyToExisting":true}`)
+		require.Equal(test, http.StatusOK, recorder.Code)
+		require.Equal(test, map[string]string{"expiry": "10m0s", "cleanInterval": "1h0m0s"}, decode[map[string]string](test, recorder))
+		require.Equal(test, caching.Options{Expiry: 10 * time.Minute, CleanInterval: time.Hour}, cache.Options())
+
+		ttl, _ := cache.TTL("key")
+		require.Greater(test, ttl, 9*time.Minute)
+
+		serve(handler, http.MethodPatch, "/config", `{"cleanInterval":"5m"}`)
+		require.Equal(test, caching.Options{Expiry: 10 * time.Minute, CleanInterval: 5 * time.Minute}, cache.Options())
+
+		require.Equal(test, http.StatusBadRequest, serve(handler, http.MethodPatch, "/config", `{"expiry":"soon"}`).Code)
+		require.Equal(test, http.StatusBadRequest, serve(handler, http.MethodPatch, "/config", `{"cleanInterval":"-1s"}`).Code)
+		require.Equal(test, caching.Options{Expiry: 10 * time.Minute, CleanInterval: 5 * time.Minute}, cache.Options())
+
+		require.NoError(test, cache.Close())
+		require.Equal(test, http.StatusServiceUnavailable, serve(handler, http.MethodPatch, "/config", `{"expiry":"1m"}`).Code)
+	})
+
+	test.Run("requests are authenticated by the middleware", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, handler := newHandler(test, &caching.CreateCacheParams{}, Params{
+			Middleware: BearerToken("first-token", "second-token"),
+		})
+
+		recorder := serve(handler, http.MethodGet, "/stats", "")
+		require.Equal(test, http.StatusUnauthorized, recorder.Code)
+		require.NotEmpty(test, recorder.Header().Get("WWW-Authenticate"))
+
+		require.Equal(test, http.StatusUnauthorized, serve(handler, http.MethodGet, "/stats", "", "Authorization", "Bearer wrong").Code)
+		require.Equal(test, http.StatusUnauthorized, serve(handler, http.MethodGet, "/stats", "", "Authorization", "first-token").Code)
+		require.Equal(test, http.StatusOK, serve(handler, http.MethodGet, "/stats", "", "Authorization", "Bearer first-token").Code)
+		require.Equal(test, http.StatusOK, serve(handler, http.MethodGet, "/stats", "", "Authorization", "Bearer second-token").Code)
+	})
+
+	test.Run("requests fail on a closed cache and oversized bodies", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, handler := newHandler(test, &caching.CreateCacheParams{}, Params{MaxBodySize: 8})
+
+		require.Equal(test, http.StatusRequestEntityTooLarge, serve(handler, http.MethodPut, "/keys/key", `"too large"`).Code)
+
+		require.NoError(test, cache.Close())
+		require.Equal(test, http.StatusServiceUnavailable, serve(handler, http.MethodPut, "/keys/key", `1`).Code)
+	})
+
+	test.Run("New requires a cache", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, err := New(&Params{})
+		require.ErrorIs(test, err, ErrInvalidParams)
+	})
+}
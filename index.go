@@ -0,0 +1,88 @@
+package caching
+
+import (
+	"sync"
+)
+
+// keyIndex is a secondary index mapping terms, such as tags, to the keys of the
+// entries carrying them.
+//
+// Every stored entry adds its terms before it becomes visible in the cache map
+// and removes them once it has left it, so the index always covers the live
+// entries. Each (term, key) pair is reference-counted by the entries carrying
+// it, which keeps the index exact while entries for the same key are replaced
+// concurrently; callers still check the current entry before acting on a key.
+type keyIndex[T comparable] struct {
+	lock  sync.Mutex
+	terms map[T]map[any]int
+}
+
+// add records that an entry for key carries terms
+func (index *keyIndex[T]) add(key any, terms []T) {
+	if len(terms) == 0 {
+		return
+	}
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	if index.terms == nil {
+		index.terms = make(map[T]map[any]int)
+	}
+
+	for _, term := range terms {
+		keys, found := index.terms[term]
+		if !found {
+			keys = make(map[any]int)
+			index.terms[term] = keys
+		}
+
+		keys[key]++
+	}
+}
+
+// remove records that an entry for key carrying terms has left the cache
+func (index *keyIndex[T]) remove(key any, terms []T) {
+	if len(terms) == 0 {
+		return
+	}
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	for _, term := range terms {
+		keys, found := index.terms[term]
+		if !found {
+			continue
+		}
+
+		if keys[key]--; keys[key] <= 0 {
+			delete(keys, key)
+		}
+
+		if len(keys) == 0 {
+			delete(index.terms, term)
+		}
+	}
+}
+
+// keys returns the keys indexed under term
+func (index *keyIndex[T]) keys(term T) []any {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	keys := make([]any, 0, len(index.terms[term]))
+	for key := range index.terms[term] {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// reset empties the index
+func (index *keyIndex[T]) reset() {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	clear(index.terms)
+}
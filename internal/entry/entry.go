@@ -0,0 +1,87 @@
+// Package entry is the representation of the values the network servers store
+// in a cache, shared so that several servers can serve the same cache.
+package entry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/vijsourabh/caching"
+)
+
+// Value is a value stored by a network server. Its JSON encoding keeps binary
+// data intact in obfuscated caches.
+type Value struct {
+	Data []byte `json:"data"`
+	// Flags are the opaque flags of memcached clients
+	Flags uint32 `json:"flags,omitempty"`
+}
+
+// Load returns the value cached for key. Values added by Go code are converted:
+// strings and byte slices are returned as-is and other values JSON-encoded,
+// without flags. Returns false if the key doesn't exist or has expired.
+func Load(cache caching.Reader, key string) (Value, bool, error) {
+	var value any
+
+	err := cache.Get(key, &value)
+	if errors.Is(err, caching.ErrNotFound) || errors.Is(err, caching.ErrExpired) {
+		return Value{}, false, nil
+	}
+
+	if err != nil {
+		return Value{}, false, err
+	}
+
+	switch value := value.(type) {
+	case Value:
+		return value, true, nil
+	case string:
+		return Value{Data: []byte(value)}, true, nil
+	case []byte:
+		return Value{Data: value}, true, nil
+	case map[string]any:
+		// An obfuscated cache decodes the JSON of a Value into a map.
+		if stored, ok := fromMap(value); ok {
+			return stored, true, nil
+		}
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Value{}, false, err
+	}
+
+	return Value{Data: data}, true, nil
+}
+
+// fromMap returns the Value whose JSON encoding was decoded into fields
+func fromMap(fields map[string]any) (Value, bool) {
+	encoded, ok := fields["data"].(string)
+	if !ok || len(fields) > 2 {
+		return Value{}, false
+	}
+
+	var value Value
+
+	if flags, found := fields["flags"]; found {
+		number, ok := flags.(float64)
+		if !ok || number < 0 || number > math.MaxUint32 || number != math.Trunc(number) {
+			return Value{}, false
+		}
+
+		value.Flags = uint32(number)
+	} else if len(fields) > 1 {
+		return Value{}, false
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return Value{}, false
+	}
+
+	value.Data = data
+
+	return value, true
+}
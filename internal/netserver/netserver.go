@@ -0,0 +1,139 @@
+// Package netserver is the lifecycle shared by the network servers: the
+// listeners and connections they track, and closing them.
+package netserver
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// Server accepts connections on the listeners passed to Serve and handles
+// each of them on its own goroutine
+type Server struct {
+	handle    func(conn net.Conn)
+	errClosed error
+	lock      sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	routines  sync.WaitGroup
+}
+
+// New creates a server handling every connection with handle, which returns
+// once done with the connection; the server then closes it. errClosed is the
+// error of the server that Serve and Close return once it has been closed.
+func New(handle func(conn net.Conn), errClosed error) *Server {
+	return &Server{
+		handle:    handle,
+		errClosed: errClosed,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve
+func (server *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return server.Serve(listener)
+}
+
+// Serve accepts connections on listener and handles each of them on its own
+// goroutine, until the listener fails or the server is closed. The listener
+// is closed when Serve returns.
+// Returns errClosed once the server has been closed.
+func (server *Server) Serve(listener net.Listener) error {
+	server.lock.Lock()
+	if server.closed {
+		server.lock.Unlock()
+		_ = listener.Close()
+
+		return server.errClosed
+	}
+	server.listeners[listener] = struct{}{}
+	server.lock.Unlock()
+
+	defer func() {
+		server.lock.Lock()
+		delete(server.listeners, listener)
+		server.lock.Unlock()
+
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			server.lock.Lock()
+			closed := server.closed
+			server.lock.Unlock()
+
+			if closed {
+				return server.errClosed
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+
+			return err
+		}
+
+		server.lock.Lock()
+		if server.closed {
+			server.lock.Unlock()
+			_ = conn.Close()
+
+			return server.errClosed
+		}
+		server.conns[conn] = struct{}{}
+		// Registered under the lock, so Close can't be waiting already.
+		server.routines.Go(func() {
+			server.serve(conn)
+		})
+		server.lock.Unlock()
+	}
+}
+
+// Close stops the listeners, closes the connections and waits for their
+// handlers to return. Returns errClosed if the server has already been closed.
+func (server *Server) Close() error {
+	server.lock.Lock()
+	if server.closed {
+		server.lock.Unlock()
+
+		return server.errClosed
+	}
+	server.closed = true
+
+	for listener := range server.listeners {
+		_ = listener.Close()
+	}
+
+	for conn := range server.conns {
+		_ = conn.Close()
+	}
+	server.lock.Unlock()
+
+	server.routines.Wait()
+
+	return nil
+}
+
+// serve handles conn, then forgets and closes it
+func (server *Server) serve(conn net.Conn) {
+	defer func() {
+		server.lock.Lock()
+		delete(server.conns, conn)
+		server.lock.Unlock()
+
+		_ = conn.Close()
+	}()
+
+	server.handle(conn)
+}
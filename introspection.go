@@ -0,0 +1,97 @@
+package caching
+
+import (
+	"slices"
+	"time"
+)
+
+// TTL returns the time left before the entry for the provided key expires.
+// A live entry that never expires reports a negative duration. Returns false
+// if the key doesn't exist, has expired or the cache has been closed.
+// Like Peek, TTL has no side effects.
+func (cache *Cache) TTL(key any) (time.Duration, bool) {
+	if cache.isClosed() {
+		return 0, false
+	}
+
+	entry, err := cache.peek(key)
+	if err != nil {
+		return 0, false
+	}
+
+	if entry.expiresAt.IsZero() {
+		return defaultExpiry, true
+	}
+
+	return entry.expiresAt.Sub(cache.clock.Now()), true
+}
+
+// Peek populates value like Get, without side effects: an expired entry is
+// reported with ErrExpired but left for the background cleaner, and an entry
+// that fails to decrypt is not removed.
+func (cache *Cache) Peek(key any, value any) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	entry, err := cache.peek(key)
+	if err != nil {
+		return err
+	}
+
+	// As in Get, the value is decrypted into a pooled buffer.
+	var scratch *[]byte
+	if cache.obfuscator != nil {
+		scratch = getScratch()
+		defer putScratch(scratch)
+	}
+
+	res, err := cache.decode(key, entry, value, scratch)
+	cache.wipe(res)
+
+	return err
+}
+
+// Len returns the number of entries in the cache. It is maintained on every
+// write and removal, so it is cheap, but it counts expired entries until they
+// are evicted by a lookup or the background cleaner. Entries of namespaces are
+// not counted.
+func (cache *Cache) Len() int {
+	return int(cache.length.Load())
+}
+
+// IsObfuscated reports whether the cache encrypts its values, as set by
+// CreateCacheParams.IsCacheObfuscated
+func (cache *Cache) IsObfuscated() bool {
+	return cache.obfuscator != nil
+}
+
+// Info returns the metadata of the live entry for the provided key, without
+// decrypting its value. Returns false if the key doesn't exist, has expired or
+// the cache has been closed.
+func (cache *Cache) Info(key any) (*EntryInfo, bool) {
+	if cache.isClosed() {
+		return nil, false
+	}
+
+	entry, err := cache.peek(key)
+	if err != nil {
+		return nil, false
+	}
+
+	info := &EntryInfo{
+		Key:           key,
+		InsertionTime: entry.insertionTime,
+		Expiry:        entry.expiry,
+		ExpiresAt:     entry.expiresAt,
+		Version:       entry.version,
+		Tags:          slices.Clone(entry.tags),
+		DependsOn:     slices.Clone(entry.dependsOn),
+	}
+
+	if ciphertext, ok := entry.value.([]byte); ok && cache.obfuscator != nil {
+		info.Size = len(ciphertext)
+	}
+
+	return info, true
+}
@@ -0,0 +1,42 @@
+package invalidation
+
+import (
+	"sync"
+)
+
+// seenSize is the number of recent messages remembered for de-duplication
+const seenSize = 4096
+
+// dedup remembers the identifiers of the last seenSize messages delivered
+type dedup struct {
+	lock  sync.Mutex
+	ids   map[messageID]struct{}
+	order []messageID // ring buffer of the identifiers in ids
+	next  int         // oldest identifier in order once it is full
+}
+
+// add records id and reports whether it was seen for the first time
+func (seen *dedup) add(id messageID) bool {
+	seen.lock.Lock()
+	defer seen.lock.Unlock()
+
+	if _, found := seen.ids[id]; found {
+		return false
+	}
+
+	if seen.ids == nil {
+		seen.ids = make(map[messageID]struct{}, seenSize)
+	}
+
+	if len(seen.order) < seenSize {
+		seen.order = append(seen.order, id)
+	} else {
+		delete(seen.ids, seen.order[seen.next])
+		seen.order[seen.next] = id
+		seen.next = (seen.next + 1) % seenSize
+	}
+
+	seen.ids[id] = struct{}{}
+
+	return true
+}
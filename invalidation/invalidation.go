@@ -0,0 +1,235 @@
+// Package invalidation broadcasts key invalidations between the caches of
+// several processes over UDP or TCP, implementing caching.Invalidator.
+package invalidation
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vijsourabh/caching"
+)
+
+const (
+	// minKeySize is the size of the shortest accepted authentication key
+	minKeySize     = 16
+	defaultMaxAge  = time.Minute
+	defaultNetwork = "udp"
+)
+
+var (
+	// ErrInvalidParams is returned by New when the provided Params are rejected
+	ErrInvalidParams = errors.New("invalid invalidation bus params")
+	// ErrClosed is returned by operations on a Bus that has been closed
+	ErrClosed = errors.New("invalidation bus is closed")
+)
+
+type (
+	// Params configures New
+	Params struct {
+		// Network is "udp" or "tcp". Defaults to "udp".
+		Network string
+		// Addr is the local address to listen on, such as "127.0.0.1:7946".
+		// A zero port picks a free one, see Bus.Addr.
+		Addr string
+		// Peers are the addresses of the buses of the other processes.
+		Peers []string
+		// Key authenticates messages with HMAC-SHA256. Every bus shares it.
+		// It must be at least 16 bytes long.
+		Key []byte
+		// MaxAge is the age above which a message is rejected as a replay.
+		// Defaults to one minute. Clocks of the processes must agree within it.
+		MaxAge time.Duration
+	}
+
+	// Bus is a caching.Invalidator exchanging authenticated messages with the
+	// buses of other processes. Messages a bus published are never delivered
+	// back to it, and a message received several times is delivered once.
+	Bus struct {
+		key       []byte
+		maxAge    time.Duration
+		sender    [senderSize]byte
+		sequence  atomic.Uint64
+		transport transport
+		lock      sync.Mutex
+		peers     []string
+		handlers  []func(keys []string)
+		seen      dedup
+		rejected  atomic.Uint64
+		closed    atomic.Bool
+		routines  sync.WaitGroup
+	}
+
+	// transport carries messages between buses
+	transport interface {
+		addr() net.Addr
+		// send delivers message to the bus listening on peer
+		send(ctx context.Context, peer string, message []byte) error
+		close() error
+	}
+)
+
+var _ caching.Invalidator = (*Bus)(nil)
+
+// New creates a Bus listening on params.Addr
+func New(params *Params) (*Bus, error) {
+	if len(params.Key) < minKeySize {
+		return nil, fmt.Errorf("%w: key shorter than %d bytes", ErrInvalidParams, minKeySize)
+	}
+
+	bus := &Bus{
+		key:    slices.Clone(params.Key),
+		maxAge: params.MaxAge,
+		peers:  slices.Clone(params.Peers),
+	}
+
+	if bus.maxAge <= 0 {
+		bus.maxAge = defaultMaxAge
+	}
+
+	if _, err := rand.Read(bus.sender[:]); err != nil {
+		return nil, err
+	}
+
+	var err error
+
+	switch network := cmp.Or(params.Network, defaultNetwork); network {
+	case "udp":
+		bus.transport, err = listenUDP(params.Addr, bus.receive, &bus.routines)
+	case "tcp":
+		bus.transport, err = listenTCP(params.Addr, bus.receive, &bus.routines)
+	default:
+		return nil, fmt.Errorf("%w: unsupported network %q", ErrInvalidParams, network)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bus, nil
+}
+
+// Addr returns the address the bus listens on
+func (bus *Bus) Addr() net.Addr {
+	return bus.transport.addr()
+}
+
+// AddPeer adds the address of the bus of another process to the peers
+func (bus *Bus) AddPeer(addr string) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	bus.peers = append(bus.peers, addr)
+}
+
+// Publish sends an invalidation of keys to every peer. Long key lists are
+// split across several messages.
+// Returns the failures of the peers that couldn't be reached, and ErrClosed
+// once the bus has been closed.
+func (bus *Bus) Publish(ctx context.Context, keys ...string) error {
+	if bus.closed.Load() {
+		return ErrClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	chunks, err := split(keys)
+	if err != nil {
+		return err
+	}
+
+	bus.lock.Lock()
+	peers := slices.Clone(bus.peers)
+	bus.lock.Unlock()
+
+	var errs []error
+
+	for _, chunk := range chunks {
+		msg := message{
+			sender:   bus.sender,
+			sequence: bus.sequence.Add(1),
+			sentAt:   time.Now(),
+			keys:     chunk,
+		}
+		data := msg.marshal(bus.key)
+
+		for _, peer := range peers {
+			if err := bus.transport.send(ctx, peer, data); err != nil {
+				errs = append(errs, fmt.Errorf("peer %s: %w", peer, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Subscribe registers fn to be called with the keys invalidated by the other
+// buses. Handlers are called from the goroutines receiving the messages.
+func (bus *Bus) Subscribe(fn func(keys []string)) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	bus.handlers = append(bus.handlers, fn)
+}
+
+// Rejected returns the number of messages rejected so far, because they
+// failed authentication, were malformed or were too old
+func (bus *Bus) Rejected() uint64 {
+	return bus.rejected.Load()
+}
+
+// Close stops listening and closes the connections to the peers.
+// Returns ErrClosed if the bus has already been closed.
+func (bus *Bus) Close() error {
+	if !bus.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+
+	err := bus.transport.close()
+	bus.routines.Wait()
+	clear(bus.key)
+
+	return err
+}
+
+// receive authenticates data, a message received from a peer, and delivers it
+// to the handlers unless it was published by this bus or already delivered
+func (bus *Bus) receive(data []byte) {
+	var msg message
+	if err := msg.unmarshal(bus.key, data); err != nil {
+		bus.rejected.Add(1)
+
+		return
+	}
+
+	if msg.sender == bus.sender {
+		return
+	}
+
+	if age := time.Since(msg.sentAt); age > bus.maxAge || age < -bus.maxAge {
+		bus.rejected.Add(1)
+
+		return
+	}
+
+	if !bus.seen.add(msg.id()) {
+		return
+	}
+
+	bus.lock.Lock()
+	handlers := slices.Clone(bus.handlers)
+	bus.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg.keys)
+	}
+}
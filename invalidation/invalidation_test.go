@@ -0,0 +1,221 @@
+package invalidation
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vijsourabh/caching"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// newBus creates a bus on a free loopback port, closed at the end of the test
+func newBus(test *testing.T, network string, key []byte) *Bus {
+	bus, err := New(&Params{
+		Network: network,
+		Addr:    "127.0.0.1:0",
+		Key:     key,
+	})
+	require.NoError(test, err)
+
+	test.Cleanup(func() {
+		_ = bus.Close()
+	})
+
+	return bus
+}
+
+func TestService_Bus(test *testing.T) {
+	defer flumetest.Start(test)
+
+	for _, network := range []string{"udp", "tcp"} {
+		test.Run(network+": replicated caches drop the keys changed by others", func(test *testing.T) {
+			defer flumetest.Start(test)
+			test.Parallel()
+
+			first, second := newBus(test, network, testKey), newBus(test, network, testKey)
+
+			// The first bus also sends to itself, and must ignore its own messages.
+			first.AddPeer(second.Addr().String())
+			first.AddPeer(first.Addr().String())
+			second.AddPeer(first.Addr().String())
+
+			newCache := func(bus *Bus) *caching.Cache {
+				cache := caching.NewCache(&caching.CreateCacheParams{
+					Invalidator: bus,
+				})
+				test.Cleanup(func() {
+					_ = cache.Close()
+				})
+
+				return cache
+			}
+
+			firstCache, secondCache := newCache(first), newCache(second)
+
+			require.NoError(test, secondCache.AddMany(
+				&caching.AddCacheParams{Key: "removed", Value: 1},
+				&caching.AddCacheParams{Key: "updated", Value: 2},
+				&caching.AddCacheParams{Key: "kept", Value: 3},
+			))
+			require.NoError(test, firstCache.AddMany(
+				&caching.AddCacheParams{Key: "own", Value: 4},
+				&caching.AddCacheParams{Key: "updated", Value: 5},
+			))
+			require.NoError(test, firstCache.Remove("removed"))
+
+			require.Eventually(test, func() bool {
+				return secondCache.Len() == 1
+			}, time.Second, time.Millisecond)
+
+			_, found := secondCache.Info("kept")
+			require.True(test, found)
+
+			_, found = firstCache.Info("own")
+			require.True(test, found)
+			require.Zero(test, first.Rejected())
+			require.Zero(test, second.Rejected())
+		})
+	}
+
+	test.Run("messages are authenticated, de-duplicated and expire", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		bus := newBus(test, "udp", testKey)
+
+		var (
+			lock      sync.Mutex
+			delivered [][]string
+		)
+		bus.Subscribe(func(keys []string) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			delivered = append(delivered, keys)
+		})
+
+		msg := message{sequence: 1, sentAt: time.Now(), keys: []string{"a", "b"}}
+		data := msg.marshal(testKey)
+
+		bus.receive(data)
+		bus.receive(data)
+		require.Equal(test, [][]string{{"a", "b"}}, delivered)
+
+		forged := message{sequence: 2, sentAt: time.Now(), keys: []string{"a"}}
+		bus.receive(forged.marshal([]byte("another key of sixteen bytes")))
+
+		tampered := (&message{sequence: 3, sentAt: time.Now(), keys: []string{"a"}}).marshal(testKey)
+		tampered[len(tampered)-macSize-1] ^= 0xff
+		bus.receive(tampered)
+
+		stale := message{sequence: 4, sentAt: time.Now().Add(-2 * defaultMaxAge), keys: []string{"a"}}
+		bus.receive(stale.marshal(testKey))
+
+		bus.receive([]byte("short"))
+
+		require.Len(test, delivered, 1)
+		require.Equal(test, uint64(4), bus.Rejected())
+	})
+
+	test.Run("long key lists are split across messages", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		keys := make([]string, 100)
+		for i := range keys {
+			keys[i] = strings.Repeat(string(rune('a'+i%26)), 2000)
+		}
+
+		chunks, err := split(keys)
+		require.NoError(test, err)
+		require.Greater(test, len(chunks), 1)
+
+		var joined []string
+		for _, chunk := range chunks {
+			msg := message{sentAt: time.Now(), keys: chunk}
+			require.LessOrEqual(test, len(msg.marshal(testKey)), maxMessageSize)
+
+			joined = append(joined, chunk...)
+		}
+		require.Equal(test, keys, joined)
+
+		_, err = split([]string{strings.Repeat("a", maxKeySize+1)})
+		require.Error(test, err)
+	})
+
+	test.Run("tcp: Close doesn't wait for a sender blocked by a peer", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		// The peer accepts connections but never reads them.
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(test, err)
+		test.Cleanup(func() {
+			_ = listener.Close()
+		})
+
+		accepted := make(chan net.Conn, 1)
+
+		go func() {
+			if conn, err := listener.Accept(); err == nil {
+				accepted <- conn
+			}
+		}()
+
+		bus, err := New(&Params{Network: "tcp", Addr: "127.0.0.1:0", Key: testKey})
+		require.NoError(test, err)
+		bus.AddPeer(listener.Addr().String())
+
+		var sent atomic.Uint64
+
+		done := make(chan struct{})
+		key := strings.Repeat("k", maxKeySize)
+
+		go func() {
+			defer close(done)
+
+			for bus.Publish(context.Background(), key) == nil {
+				sent.Add(1)
+			}
+		}()
+
+		// Once the buffers of the connection are full, the sender is blocked.
+		require.Eventually(test, func() bool {
+			before := sent.Load()
+			time.Sleep(50 * time.Millisecond)
+
+			return sent.Load() == before
+		}, 5*time.Second, time.Millisecond)
+
+		start := time.Now()
+		require.NoError(test, bus.Close())
+		<-done
+		require.Less(test, time.Since(start), writeTimeout/2)
+		require.NoError(test, (<-accepted).Close())
+	})
+
+	test.Run("New rejects short keys and unknown networks, Close is terminal", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, err := New(&Params{Addr: "127.0.0.1:0", Key: []byte("short")})
+		require.ErrorIs(test, err, ErrInvalidParams)
+
+		_, err = New(&Params{Network: "sctp", Addr: "127.0.0.1:0", Key: testKey})
+		require.ErrorIs(test, err, ErrInvalidParams)
+
+		bus := newBus(test, "tcp", testKey)
+		require.NoError(test, bus.Close())
+		require.ErrorIs(test, bus.Close(), ErrClosed)
+		require.ErrorIs(test, bus.Publish(context.Background(), "a"), ErrClosed)
+	})
+}
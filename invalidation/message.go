@@ -0,0 +1,149 @@
+package invalidation
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// version is the version of the message format
+	version = 1
+	// headerSize is the size of version|sender|sequence|sentAt|count
+	headerSize = 1 + senderSize + 8 + 8 + 2
+	senderSize = 16
+	macSize    = sha256.Size
+	// maxMessageSize bounds messages so that they fit in a UDP datagram
+	maxMessageSize = 60 << 10
+	// maxKeySize is the size of the longest key a message can carry
+	maxKeySize = maxMessageSize - headerSize - macSize - 2
+)
+
+var errMalformed = errors.New("malformed message")
+
+type (
+	// message is an invalidation of keys, published by sender. On the wire it
+	// takes the form header|keys|mac, each key being prefixed by its length,
+	// where mac is the HMAC-SHA256 of header|keys.
+	message struct {
+		sender   [senderSize]byte
+		sequence uint64
+		sentAt   time.Time
+		keys     []string
+	}
+
+	// messageID identifies a message across every bus
+	messageID struct {
+		sender   [senderSize]byte
+		sequence uint64
+	}
+)
+
+// id returns the identifier of the message
+func (msg *message) id() messageID {
+	return messageID{sender: msg.sender, sequence: msg.sequence}
+}
+
+// marshal encodes and authenticates the message with key
+func (msg *message) marshal(key []byte) []byte {
+	size := headerSize + macSize
+	for _, k := range msg.keys {
+		size += 2 + len(k)
+	}
+
+	data := make([]byte, 0, size)
+	data = append(data, version)
+	data = append(data, msg.sender[:]...)
+	data = binary.BigEndian.AppendUint64(data, msg.sequence)
+	data = binary.BigEndian.AppendUint64(data, uint64(msg.sentAt.UnixNano()))
+	data = binary.BigEndian.AppendUint16(data, uint16(len(msg.keys)))
+
+	for _, k := range msg.keys {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(k)))
+		data = append(data, k...)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	return mac.Sum(data)
+}
+
+// unmarshal authenticates data with key and decodes it into the message
+func (msg *message) unmarshal(key []byte, data []byte) error {
+	if len(data) < headerSize+macSize {
+		return errMalformed
+	}
+
+	body, sum := data[:len(data)-macSize], data[len(data)-macSize:]
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return errors.New("message authentication failed")
+	}
+
+	if body[0] != version {
+		return fmt.Errorf("%w: unsupported version %d", errMalformed, body[0])
+	}
+
+	copy(msg.sender[:], body[1:])
+	msg.sequence = binary.BigEndian.Uint64(body[1+senderSize:])
+	msg.sentAt = time.Unix(0, int64(binary.BigEndian.Uint64(body[9+senderSize:])))
+	count := int(binary.BigEndian.Uint16(body[17+senderSize:]))
+
+	body = body[headerSize:]
+	msg.keys = make([]string, 0, count)
+
+	for range count {
+		if len(body) < 2 {
+			return errMalformed
+		}
+
+		size := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+size {
+			return errMalformed
+		}
+
+		msg.keys = append(msg.keys, string(body[2:2+size]))
+		body = body[2+size:]
+	}
+
+	if len(body) != 0 {
+		return errMalformed
+	}
+
+	return nil
+}
+
+// split splits keys into the key lists of messages no larger than maxMessageSize
+func split(keys []string) ([][]string, error) {
+	var (
+		chunks [][]string
+		start  int
+		size   = headerSize + macSize
+	)
+
+	for i, key := range keys {
+		if len(key) > maxKeySize {
+			return nil, fmt.Errorf("key of %d bytes longer than %d", len(key), maxKeySize)
+		}
+
+		if size+2+len(key) > maxMessageSize || i-start == 1<<16-1 {
+			chunks = append(chunks, keys[start:i])
+			start, size = i, headerSize+macSize
+		}
+
+		size += 2 + len(key)
+	}
+
+	if start < len(keys) {
+		chunks = append(chunks, keys[start:])
+	}
+
+	return chunks, nil
+}
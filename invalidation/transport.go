@@ -0,0 +1,297 @@
+package invalidation
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// dialTimeout bounds the connection to a TCP peer when ctx has no deadline
+	dialTimeout = 5 * time.Second
+	// writeTimeout bounds the write of a message to a TCP peer, even when ctx
+	// has a later deadline or none
+	writeTimeout = 5 * time.Second
+)
+
+type (
+	// udpTransport sends each message as a datagram to every peer
+	udpTransport struct {
+		conn *net.UDPConn
+	}
+
+	// tcpTransport sends length-prefixed messages over a connection to each
+	// peer, dialled on first use and re-dialled after a failure
+	tcpTransport struct {
+		listener net.Listener
+		deliver  func(data []byte)
+		routines *sync.WaitGroup
+		lock     sync.Mutex
+		peers    map[string]*tcpPeer
+		inbound  map[net.Conn]struct{}
+		closed   bool
+	}
+
+	// tcpPeer is the outbound connection to a peer. Its lock serialises the
+	// messages sent to the peer; conn is also changed under the lock of the
+	// transport, which close holds to close it without waiting for a sender.
+	tcpPeer struct {
+		lock sync.Mutex
+		conn net.Conn
+	}
+)
+
+// listenUDP listens on addr and delivers the datagrams received until closed
+func listenUDP(addr string, deliver func(data []byte), routines *sync.WaitGroup) (*udpTransport, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	routines.Go(func() {
+		buf := make([]byte, 64<<10)
+
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			if err == nil {
+				deliver(buf[:n])
+			}
+		}
+	})
+
+	return &udpTransport{conn: conn}, nil
+}
+
+func (transport *udpTransport) addr() net.Addr {
+	return transport.conn.LocalAddr()
+}
+
+func (transport *udpTransport) send(_ context.Context, peer string, message []byte) error {
+	addr, err := net.ResolveUDPAddr("udp", peer)
+	if err != nil {
+		return err
+	}
+
+	_, err = transport.conn.WriteToUDP(message, addr)
+
+	return err
+}
+
+func (transport *udpTransport) close() error {
+	return transport.conn.Close()
+}
+
+// listenTCP listens on addr and delivers the messages received on every
+// accepted connection until closed
+func listenTCP(addr string, deliver func(data []byte), routines *sync.WaitGroup) (*tcpTransport, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &tcpTransport{
+		listener: listener,
+		deliver:  deliver,
+		routines: routines,
+		peers:    make(map[string]*tcpPeer),
+		inbound:  make(map[net.Conn]struct{}),
+	}
+
+	routines.Go(transport.accept)
+
+	return transport, nil
+}
+
+func (transport *tcpTransport) addr() net.Addr {
+	return transport.listener.Addr()
+}
+
+// accept serves the connections of the peers until the listener is closed
+func (transport *tcpTransport) accept() {
+	for {
+		conn, err := transport.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		if err != nil {
+			continue
+		}
+
+		transport.lock.Lock()
+		if transport.closed {
+			transport.lock.Unlock()
+			_ = conn.Close()
+
+			return
+		}
+		transport.inbound[conn] = struct{}{}
+		transport.lock.Unlock()
+
+		transport.routines.Go(func() {
+			transport.serve(conn)
+		})
+	}
+}
+
+// serve delivers the messages received on conn until it fails or is closed
+func (transport *tcpTransport) serve(conn net.Conn) {
+	defer func() {
+		transport.lock.Lock()
+		delete(transport.inbound, conn)
+		transport.lock.Unlock()
+
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		var size uint32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return
+		}
+
+		if size > maxMessageSize {
+			return
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return
+		}
+
+		transport.deliver(data)
+	}
+}
+
+func (transport *tcpTransport) send(ctx context.Context, peer string, message []byte) error {
+	transport.lock.Lock()
+	if transport.closed {
+		transport.lock.Unlock()
+
+		return ErrClosed
+	}
+
+	target, found := transport.peers[peer]
+	if !found {
+		target = &tcpPeer{}
+		transport.peers[peer] = target
+	}
+	transport.lock.Unlock()
+
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(message)), uint32(len(message)))
+	frame = append(frame, message...)
+
+	target.lock.Lock()
+	defer target.lock.Unlock()
+
+	// A connection broken since the last message fails the first write, so
+	// the message is retried once on a new connection.
+	for attempt := 0; ; attempt++ {
+		if target.conn == nil {
+			conn, err := dial(ctx, peer)
+			if err != nil {
+				return err
+			}
+
+			if err = transport.setConn(target, conn); err != nil {
+				return err
+			}
+		}
+
+		deadline := time.Now().Add(writeTimeout)
+		if ctxDeadline, found := ctx.Deadline(); found && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+
+		if err := target.conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+
+		_, err := target.conn.Write(frame)
+		if err == nil {
+			return nil
+		}
+
+		_ = target.conn.Close()
+		_ = transport.setConn(target, nil)
+
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+func (transport *tcpTransport) close() error {
+	err := transport.listener.Close()
+
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+
+	transport.closed = true
+
+	for conn := range transport.inbound {
+		_ = conn.Close()
+	}
+
+	// A sender blocked on a write holds the lock of its peer, and fails once
+	// its connection is closed.
+	for _, peer := range transport.peers {
+		if peer.conn != nil {
+			_ = peer.conn.Close()
+		}
+	}
+
+	return err
+}
+
+// setConn sets the connection of target, sent to under its lock. A connection
+// set once the transport is closed is closed instead, returning ErrClosed.
+func (transport *tcpTransport) setConn(target *tcpPeer, conn net.Conn) error {
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+
+	if transport.closed && conn != nil {
+		_ = conn.Close()
+
+		return ErrClosed
+	}
+
+	target.conn = conn
+
+	return nil
+}
+
+// dial connects to peer within the deadline of ctx, or dialTimeout
+func dial(ctx context.Context, peer string) (net.Conn, error) {
+	if _, found := ctx.Deadline(); !found {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", peer)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,81 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+)
+
+// Invalidator broadcasts invalidations of keys between the caches of several
+// processes, so that replicated local caches drop the copies another process
+// changed. Implementations must be safe for concurrent use, and must not
+// deliver the invalidations a process published back to it.
+type Invalidator interface {
+	// Publish broadcasts an invalidation of keys to the other processes.
+	Publish(ctx context.Context, keys ...string) error
+	// Subscribe registers fn to be called with the keys invalidated by other processes.
+	Subscribe(fn func(keys []string))
+}
+
+// checkKey rejects the keys of a cache with an Invalidator that aren't
+// strings: other processes remove the keys they receive as strings, so they
+// could never be invalidated.
+// Returns a *KeyError wrapping ErrInvalidation.
+func (cache *Cache) checkKey(key any) error {
+	if cache.invalidator == nil {
+		return nil
+	}
+
+	if _, ok := key.(string); !ok {
+		return newKeyError(key, ErrInvalidation, fmt.Errorf("key of type %T instead of string", key))
+	}
+
+	return nil
+}
+
+// publish broadcasts the invalidation of keys, changed by the cache, through
+// its Invalidator, if any. Keys other than strings, which checkKey keeps out
+// of the cache, are not published. Publishing is bounded by InvalidationTimeout.
+// Returns a *KeyError wrapping ErrInvalidation per key if publishing fails.
+func (cache *Cache) publish(keys ...any) []*KeyError {
+	if cache.invalidator == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if name, ok := key.(string); ok {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(cache.ctx, cache.publishTimeout)
+	defer cancel()
+
+	err := cache.invalidator.Publish(ctx, names...)
+	if err == nil {
+		return nil
+	}
+
+	keyErrors := make([]*KeyError, len(keys))
+	for i, key := range keys {
+		keyErrors[i] = newKeyError(key, ErrInvalidation, err)
+	}
+
+	return keyErrors
+}
+
+// invalidated removes the keys invalidated by other processes, without
+// publishing their removal back
+func (cache *Cache) invalidated(keys []string) {
+	if cache.isClosed() {
+		return
+	}
+
+	for _, key := range keys {
+		cache.remove(key)
+	}
+}
@@ -0,0 +1,63 @@
+package caching
+
+import (
+	"iter"
+)
+
+// All returns an iterator over the live entries of the cache. Values are the
+// same as GetCacheResponse.Value: the stored value, or the decrypted JSON for
+// obfuscated caches. See Scan for the iteration semantics.
+func (cache *Cache) All() iter.Seq2[any, any] {
+	return cache.Scan(nil)
+}
+
+// Keys returns an iterator over the keys of the live entries of the cache.
+// No value is decrypted.
+func (cache *Cache) Keys() iter.Seq[any] {
+	return func(yield func(any) bool) {
+		cache.scan(func(key any, _ *cacheEntry) bool {
+			return yield(key)
+		})
+	}
+}
+
+// Scan returns an iterator over the live entries whose key is accepted by
+// filter; a nil filter accepts every key.
+//
+// Entries are streamed lazily from the underlying map rather than copied:
+// expired entries are skipped (the background cleaner removes them), values are
+// only decrypted for accepted entries, and iteration stops as soon as the
+// consumer breaks. Entries that fail to decrypt are skipped. As with
+// sync.Map.Range, entries added or removed during iteration may or may not be seen.
+func (cache *Cache) Scan(filter func(key any) bool) iter.Seq2[any, any] {
+	return func(yield func(any, any) bool) {
+		cache.scan(func(key any, entry *cacheEntry) bool {
+			if filter != nil && !filter(key) {
+				return true
+			}
+
+			res, err := cache.decode(key, entry, nil, nil)
+			if err != nil {
+				return true
+			}
+
+			return yield(key, res.Value)
+		})
+	}
+}
+
+// scan calls fn for every live entry of the cache until fn returns false
+func (cache *Cache) scan(fn func(key any, entry *cacheEntry) bool) {
+	if cache.isClosed() {
+		return
+	}
+
+	now := cache.clock.Now()
+	cache.rangeEntries(func(key any, entry *cacheEntry) bool {
+		if entry.isExpired(now) {
+			return true
+		}
+
+		return fn(key, entry)
+	})
+}
@@ -0,0 +1,601 @@
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vijsourabh/caching"
+	"github.com/vijsourabh/caching/internal/entry"
+)
+
+// version is the memcached version reported by version and stats
+const version = "1.6.21"
+
+const (
+	// bufferSize is the size of the read and write buffers of a connection,
+	// and of the longest command line
+	bufferSize         = 64 << 10
+	defaultMaxItemSize = 1 << 20
+	// maxKeySize is the size of the longest key accepted, as in memcached
+	maxKeySize = 250
+	// maxRelativeExptime is the largest exptime taken as a number of seconds
+	// rather than a Unix time, as in memcached
+	maxRelativeExptime = 60 * 60 * 24 * 30
+)
+
+const (
+	errFormat     = "CLIENT_ERROR bad command line format"
+	errDataChunk  = "CLIENT_ERROR bad data chunk"
+	errNonNumeric = "CLIENT_ERROR cannot increment or decrement non-numeric value"
+	errTooLarge   = "SERVER_ERROR object too large for cache"
+)
+
+// lineBreaks replaces the line breaks that would end a reply early
+var lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
+type (
+	// client is the state of a connection
+	client struct {
+		server *Server
+		cache  caching.Cacher
+		reader *bufio.Reader
+		writer *bufio.Writer
+		quit   bool // set by quit, the connection is closed once the replies are flushed
+	}
+
+	// storage is a parsed storage command:
+	// <command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+	storage struct {
+		name    string
+		key     string
+		flags   uint32
+		expiry  time.Duration // zero for the expiry of the cache, negative for an expired item
+		cas     uint64
+		noReply bool
+	}
+)
+
+// execute runs the command of fields and writes its reply. Returns an error
+// when the connection fails while reading the data of a storage command.
+func (client *client) execute(fields []string) error {
+	client.server.applyFlush()
+	switch name, args := fields[0], fields[1:]; name {
+	case "get", "gets":
+		client.get(args, name == "gets")
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return client.store(name, args)
+	case "delete":
+		client.delete(args)
+	case "incr", "decr":
+		client.increment(args, name == "incr")
+	case "touch":
+		client.touch(args)
+	case "flush_all":
+		client.flushAll(args)
+	case "stats":
+		client.stats(args)
+	case "version":
+		client.reply("VERSION " + version)
+	case "verbosity":
+		client.replyUnless(noReply(args), "OK")
+	case "quit":
+		client.quit = true
+	default:
+		client.reply("ERROR")
+	}
+
+	return nil
+}
+
+// get implements get and gets <key>*, gets also returning the cas unique of
+// each item: the version of its entry
+func (client *client) get(keys []string, withCAS bool) {
+	if len(keys) == 0 {
+		client.reply("ERROR")
+
+		return
+	}
+
+	client.cache.RLock()
+	defer client.cache.RUnlock()
+
+	for _, key := range keys {
+		client.server.stats.gets.Add(1)
+
+		if !validKey(key) {
+			client.reply(errFormat)
+
+			return
+		}
+
+		value, found, err := entry.Load(client.cache, key)
+		if err != nil {
+			client.failed(err)
+
+			return
+		}
+
+		if !found {
+			continue
+		}
+
+		if withCAS {
+			info, found := client.cache.Info(key)
+			if !found {
+				continue
+			}
+
+			fmt.Fprintf(client.writer, "VALUE %s %d %d %d\r\n", key, value.Flags, len(value.Data), info.Version)
+		} else {
+			fmt.Fprintf(client.writer, "VALUE %s %d %d\r\n", key, value.Flags, len(value.Data))
+		}
+
+		_, _ = client.writer.Write(value.Data)
+		_, _ = client.writer.WriteString("\r\n")
+	}
+
+	client.reply("END")
+}
+
+// store implements the storage commands set, add, replace, append, prepend
+// and cas, reading their data block
+func (client *client) store(name string, args []string) error {
+	client.server.stats.sets.Add(1)
+
+	command, ok := parseStorage(name, args, client.server.now())
+	if !ok {
+		client.reply(errFormat)
+
+		return nil
+	}
+
+	size, _ := strconv.Atoi(args[3])
+	if size > client.server.maxItemSize {
+		if _, err := client.reader.Discard(size + 2); err != nil {
+			return err
+		}
+
+		client.reply(errTooLarge)
+
+		return nil
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(client.reader, data); err != nil {
+		return err
+	}
+
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		// The rest of the line is swallowed, as in memcached.
+		if data[len(data)-1] != '\n' {
+			if _, err := client.reader.ReadSlice('\n'); err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+				return err
+			}
+		}
+
+		client.reply(errDataChunk)
+
+		return nil
+	}
+
+	reply, err := client.apply(command, data[:size])
+	if err != nil {
+		client.failed(err)
+
+		return nil
+	}
+
+	client.replyUnless(command.noReply, reply)
+
+	return nil
+}
+
+// apply applies the storage command with data and returns its reply
+func (client *client) apply(command storage, data []byte) (string, error) {
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	_, found := client.cache.TTL(command.key)
+
+	switch command.name {
+	case "add":
+		if found {
+			return "NOT_STORED", nil
+		}
+	case "replace":
+		if !found {
+			return "NOT_STORED", nil
+		}
+	case "append", "prepend":
+		current, found, err := entry.Load(client.cache, command.key)
+		if err != nil {
+			return "", err
+		}
+
+		if !found {
+			return "NOT_STORED", nil
+		}
+
+		// The stored data may be shared with readers, so it is copied.
+		if command.name == "append" {
+			data = slices.Concat(current.Data, data)
+		} else {
+			data = slices.Concat(data, current.Data)
+		}
+
+		// The exptime and flags of append and prepend are ignored.
+		return client.update(command.key, entry.Value{Data: data, Flags: current.Flags}, "STORED", "NOT_STORED")
+	case "cas":
+		if !found {
+			return "NOT_FOUND", nil
+		}
+
+		if info, found := client.cache.Info(command.key); !found || info.Version != command.cas {
+			return "EXISTS", nil
+		}
+	}
+
+	if command.expiry < 0 {
+		// The item would expire immediately.
+		if err := client.cache.Remove(command.key); err != nil {
+			return "", err
+		}
+
+		return "STORED", nil
+	}
+
+	err := client.cache.Add(&caching.AddCacheParams{
+		Key:    command.key,
+		Value:  entry.Value{Data: data, Flags: command.flags},
+		Expiry: command.expiry,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return "STORED", nil
+}
+
+// update replaces the value of key, keeping its expiry, and returns stored,
+// or missing if the key expired in the meantime
+func (client *client) update(key string, value entry.Value, stored string, missing string) (string, error) {
+	err := client.cache.Update(&caching.UpdateCacheParams{Key: key, Value: value})
+	if errors.Is(err, caching.ErrNotFound) || errors.Is(err, caching.ErrExpired) {
+		return missing, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return stored, nil
+}
+
+// delete implements delete <key> [0] [noreply]
+func (client *client) delete(args []string) {
+	if len(args) == 0 || len(args) > 3 || !validKey(args[0]) {
+		client.reply(errFormat)
+
+		return
+	}
+
+	if len(args) > 1 && args[1] != "0" && args[1] != "noreply" {
+		client.reply("CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]")
+
+		return
+	}
+
+	key := args[0]
+
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	if _, found := client.cache.TTL(key); !found {
+		client.replyUnless(noReply(args), "NOT_FOUND")
+
+		return
+	}
+
+	if err := client.cache.Remove(key); err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	client.replyUnless(noReply(args), "DELETED")
+}
+
+// increment implements incr and decr <key> <value> [noreply] on the decimal
+// representation of a 64-bit unsigned integer. incr wraps around, and decr
+// stops at 0. The item keeps its expiry and flags.
+func (client *client) increment(args []string, incr bool) {
+	if len(args) < 2 || len(args) > 3 || !validKey(args[0]) {
+		client.reply(errFormat)
+
+		return
+	}
+
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		client.reply("CLIENT_ERROR invalid numeric delta argument")
+
+		return
+	}
+
+	key := args[0]
+
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	value, found, err := entry.Load(client.cache, key)
+	if err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	if !found {
+		client.replyUnless(noReply(args), "NOT_FOUND")
+
+		return
+	}
+
+	n, err := strconv.ParseUint(string(bytes.TrimRight(value.Data, " ")), 10, 64)
+	if err != nil {
+		client.reply(errNonNumeric)
+
+		return
+	}
+
+	switch {
+	case incr:
+		n += delta
+	case delta > n:
+		n = 0
+	default:
+		n -= delta
+	}
+
+	value.Data = strconv.AppendUint(nil, n, 10)
+
+	reply, err := client.update(key, value, string(value.Data), "NOT_FOUND")
+	if err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	client.replyUnless(noReply(args), reply)
+}
+
+// touch implements touch <key> <exptime> [noreply]
+func (client *client) touch(args []string) {
+	client.server.stats.touches.Add(1)
+
+	if len(args) < 2 || len(args) > 3 || !validKey(args[0]) {
+		client.reply(errFormat)
+
+		return
+	}
+
+	expiry, ok := parseExptime(args[1], client.server.now())
+	if !ok {
+		client.reply("CLIENT_ERROR invalid exptime argument")
+
+		return
+	}
+
+	var err error
+
+	switch {
+	case expiry != 0:
+		err = client.cache.Expire(args[0], expiry)
+	case client.cache.Options().Expiry > 0:
+		err = client.cache.Expire(args[0], client.cache.Options().Expiry)
+	default:
+		err = client.cache.Persist(args[0])
+	}
+
+	switch {
+	case errors.Is(err, caching.ErrNotFound) || errors.Is(err, caching.ErrExpired):
+		client.replyUnless(noReply(args), "NOT_FOUND")
+	case err != nil:
+		client.failed(err)
+	default:
+		client.replyUnless(noReply(args), "TOUCHED")
+	}
+}
+
+// flushAll implements flush_all [delay] [noreply]. With a delay, the items
+// stored until it elapses, including those stored in the meantime, are
+// removed once it has.
+func (client *client) flushAll(args []string) {
+	client.server.stats.flushes.Add(1)
+
+	var delay time.Duration
+
+	if len(args) > 0 && args[0] != "noreply" {
+		seconds, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || seconds < 0 || seconds > maxRelativeExptime {
+			client.reply(errFormat)
+
+			return
+		}
+
+		delay = time.Duration(seconds) * time.Second
+	}
+
+	if delay > 0 {
+		client.server.flushAt.Store(client.server.now().Add(delay).UnixNano())
+		client.replyUnless(noReply(args), "OK")
+
+		return
+	}
+
+	client.server.flushAt.Store(0)
+
+	if err := client.cache.Clear(); err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	client.replyUnless(noReply(args), "OK")
+}
+
+// stats implements stats without arguments, mapping the cache counters onto
+// those of memcached
+func (client *client) stats(args []string) {
+	if len(args) > 0 {
+		client.reply("ERROR")
+
+		return
+	}
+
+	server := client.server
+	stats := client.cache.Stats()
+
+	for _, stat := range []struct {
+		name  string
+		value any
+	}{
+		{"pid", os.Getpid()},
+		{"uptime", int64(time.Since(server.started).Seconds())},
+		{"time", server.now().Unix()},
+		{"version", version},
+		{"curr_connections", server.stats.connected.Load()},
+		{"total_connections", server.stats.accepted.Load()},
+		{"cmd_get", server.stats.gets.Load()},
+		{"cmd_set", server.stats.sets.Load()},
+		{"cmd_touch", server.stats.touches.Load()},
+		{"cmd_flush", server.stats.flushes.Load()},
+		{"get_hits", stats.Hits},
+		{"get_misses", stats.Misses},
+		{"curr_items", stats.Len},
+		{"total_items", stats.Adds},
+		{"evictions", stats.Evictions},
+	} {
+		fmt.Fprintf(client.writer, "STAT %s %v\r\n", stat.name, stat.value)
+	}
+
+	client.reply("END")
+}
+
+// reply writes a line. Write errors are sticky, and reported by Flush.
+func (client *client) reply(line string) {
+	_, _ = client.writer.WriteString(line)
+	_, _ = client.writer.WriteString("\r\n")
+}
+
+// replyUnless writes line unless the client asked for no reply
+func (client *client) replyUnless(noReply bool, line string) {
+	if !noReply {
+		client.reply(line)
+	}
+}
+
+// failed writes err, returned by the cache, as a server error
+func (client *client) failed(err error) {
+	client.reply("SERVER_ERROR " + lineBreaks.Replace(err.Error()))
+}
+
+// parseStorage parses the arguments of the storage command name, received at now
+func parseStorage(name string, args []string, now time.Time) (storage, bool) {
+	command := storage{name: name}
+
+	fields := 4
+	if name == "cas" {
+		fields = 5
+	}
+
+	if len(args) == fields+1 && args[fields] == "noreply" {
+		command.noReply = true
+		args = args[:fields]
+	}
+
+	if len(args) != fields || !validKey(args[0]) {
+		return command, false
+	}
+
+	command.key = args[0]
+
+	flags, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return command, false
+	}
+
+	command.flags = uint32(flags)
+
+	var ok bool
+	if command.expiry, ok = parseExptime(args[2], now); !ok {
+		return command, false
+	}
+
+	if size, err := strconv.Atoi(args[3]); err != nil || size < 0 {
+		return command, false
+	}
+
+	if name == "cas" {
+		if command.cas, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			return command, false
+		}
+	}
+
+	return command, true
+}
+
+// parseExptime parses an exptime: 0 for the expiry of the cache, a number of
+// seconds up to 30 days, a Unix time beyond, compared with now, and a negative
+// value for an item that has already expired. An expired item is reported with
+// a negative duration.
+func parseExptime(arg string, now time.Time) (time.Duration, bool) {
+	exptime, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	switch {
+	case exptime == 0:
+		return 0, true
+	case exptime < 0:
+		return -1, true
+	case exptime <= maxRelativeExptime:
+		return time.Duration(exptime) * time.Second, true
+	}
+
+	expiry := time.Unix(exptime, 0).Sub(now)
+	if expiry <= 0 {
+		return -1, true
+	}
+
+	return expiry, true
+}
+
+// validKey reports whether key is accepted by memcached: at most 250 bytes
+// without control characters. Keys are split on spaces already.
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeySize {
+		return false
+	}
+
+	for i := range len(key) {
+		if key[i] < ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// noReply reports whether the last argument of a command is noreply
+func noReply(args []string) bool {
+	return len(args) > 0 && args[len(args)-1] == "noreply"
+}
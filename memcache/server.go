@@ -0,0 +1,178 @@
+// Package memcache serves a cache over the text protocol of memcached, so
+// that memcached clients can use it.
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/vijsourabh/caching"
+	"github.com/vijsourabh/caching/internal/netserver"
+)
+
+var (
+	// ErrInvalidParams is returned by New when the provided Params are rejected
+	ErrInvalidParams = errors.New("invalid memcached server params")
+	// ErrClosed is returned by Serve once the server has been closed, and by a second Close
+	ErrClosed = errors.New("memcached server is closed")
+)
+
+type (
+	// Params configures New
+	Params struct {
+		// Cache is the cache served. Keys are strings. Required.
+		Cache caching.Cacher
+		// MaxItemSize is the size of the largest value accepted. Defaults to 1 MiB.
+		MaxItemSize int
+		// Clock is the clock of the cache, against which absolute exptimes
+		// are converted to expiries. Defaults to the system clock.
+		Clock caching.Clock
+	}
+
+	// Server serves a cache to the clients of the listeners passed to Serve
+	Server struct {
+		cache       caching.Cacher
+		maxItemSize int
+		clock       caching.Clock // nil for the system clock
+		started     time.Time
+		flushAt     atomic.Int64 // Unix nanoseconds of the pending flush_all deadline, zero for none
+		conns       *netserver.Server
+		stats       serverStats
+	}
+
+	// serverStats holds the server counters reported by stats
+	serverStats struct {
+		connected atomic.Int64  // clients currently connected
+		accepted  atomic.Uint64 // connections accepted since the server started
+		gets      atomic.Uint64 // keys requested by get and gets
+		sets      atomic.Uint64 // storage commands
+		touches   atomic.Uint64 // touch commands
+		flushes   atomic.Uint64 // flush_all commands
+	}
+)
+
+// New creates a server for params.Cache. The cache is left open by Close.
+func New(params *Params) (*Server, error) {
+	if params.Cache == nil {
+		return nil, fmt.Errorf("%w: no cache", ErrInvalidParams)
+	}
+
+	server := &Server{
+		cache:       params.Cache,
+		maxItemSize: params.MaxItemSize,
+		clock:       params.Clock,
+		started:     time.Now(),
+	}
+	server.conns = netserver.New(server.serve, ErrClosed)
+
+	if server.maxItemSize <= 0 {
+		server.maxItemSize = defaultMaxItemSize
+	}
+
+	return server, nil
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve
+func (server *Server) ListenAndServe(addr string) error {
+	return server.conns.ListenAndServe(addr)
+}
+
+// Serve accepts connections on listener and serves each of them on its own
+// goroutine, until the listener fails or the server is closed. The listener
+// is closed when Serve returns.
+// Returns ErrClosed once the server has been closed.
+func (server *Server) Serve(listener net.Listener) error {
+	return server.conns.Serve(listener)
+}
+
+// Close stops the listeners, closes the connections of the clients and waits
+// for their commands to complete. Returns ErrClosed if the server has already
+// been closed.
+func (server *Server) Close() error {
+	return server.conns.Close()
+}
+
+// now returns the time of the clock of the cache
+func (server *Server) now() time.Time {
+	if server.clock == nil {
+		return time.Now()
+	}
+
+	return server.clock.Now()
+}
+
+// applyFlush removes the items stored until the deadline of a delayed
+// flush_all once it has passed, as memcached then takes them as invalid
+func (server *Server) applyFlush() {
+	at := server.flushAt.Load()
+
+	if at == 0 || !server.now().After(time.Unix(0, at)) {
+		return
+	}
+
+	server.cache.Lock()
+	defer server.cache.Unlock()
+
+	if !server.flushAt.CompareAndSwap(at, 0) {
+		return
+	}
+
+	deadline := time.Unix(0, at)
+
+	for key := range server.cache.Keys() {
+		if info, found := server.cache.Info(key); found && !info.InsertionTime.After(deadline) {
+			_ = server.cache.Remove(key)
+		}
+	}
+}
+
+// serve executes the commands of the client connected on conn until it quits,
+// sends a malformed request or disconnects. Replies are flushed once every
+// pipelined command received has been executed.
+func (server *Server) serve(conn net.Conn) {
+	server.stats.accepted.Add(1)
+	server.stats.connected.Add(1)
+
+	defer server.stats.connected.Add(-1)
+
+	client := &client{
+		server: server,
+		cache:  server.cache,
+		reader: bufio.NewReaderSize(conn, bufferSize),
+		writer: bufio.NewWriterSize(conn, bufferSize),
+	}
+
+	for !client.quit {
+		line, err := client.reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			client.reply("CLIENT_ERROR line too long")
+			_ = client.writer.Flush()
+
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			client.reply("ERROR")
+		} else if err = client.execute(fields); err != nil {
+			return
+		}
+
+		if client.reader.Buffered() == 0 {
+			if err = client.writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	_ = client.writer.Flush()
+}
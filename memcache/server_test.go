@@ -0,0 +1,329 @@
+package memcache
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vijsourabh/caching"
+	"github.com/vijsourabh/caching/internal/entry"
+)
+
+// testClient is a raw TCP client exchanging lines with the server
+type testClient struct {
+	test   *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newServer serves a new cache on a free loopback port, closed at the end of the test
+func newServer(test *testing.T, params *caching.CreateCacheParams) (*caching.Cache, *Server, string) {
+	cache := caching.NewCache(params)
+
+	server, err := New(&Params{Cache: cache, MaxItemSize: 1 << 10, Clock: params.Clock})
+	require.NoError(test, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(test, err)
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	test.Cleanup(func() {
+		_ = server.Close()
+		require.ErrorIs(test, <-served, ErrClosed)
+		_ = cache.Close()
+	})
+
+	return cache, server, listener.Addr().String()
+}
+
+func dial(test *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(test, err)
+
+	test.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return &testClient{test: test, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// do sends request, whose lines are terminated by CRLF, and returns the
+// replies read until one of them starts with a terminal line
+func (client *testClient) do(request string, lines int) []string {
+	_, err := client.conn.Write([]byte(strings.ReplaceAll(request, "\n", "\r\n")))
+	require.NoError(client.test, err)
+
+	return client.read(lines)
+}
+
+// read returns the next lines, without their terminators
+func (client *testClient) read(lines int) []string {
+	require.NoError(client.test, client.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	replies := make([]string, lines)
+	for i := range replies {
+		line, err := client.reader.ReadString('\n')
+		require.NoError(client.test, err)
+
+		replies[i] = strings.TrimSuffix(line, "\r\n")
+	}
+
+	return replies
+}
+
+func TestService_Server(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("items are stored, retrieved and deleted", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		require.Equal(test, []string{"STORED"}, client.do("set key 42 0 5\nvalue\n", 1))
+		require.Equal(test, []string{"VALUE key 42 5", "value", "END"}, client.do("get key missing\n", 3))
+
+		var value any
+		require.NoError(test, cache.Get("key", &value))
+		require.Equal(test, entry.Value{Data: []byte("value"), Flags: 42}, value)
+
+		require.Equal(test, []string{"NOT_STORED"}, client.do("add key 0 0 1\nx\n", 1))
+		require.Equal(test, []string{"NOT_STORED"}, client.do("replace missing 0 0 1\nx\n", 1))
+		require.Equal(test, []string{"STORED"}, client.do("add other 0 0 0\n\n", 1))
+		require.Equal(test, []string{"STORED"}, client.do("replace other 0 0 1\nx\n", 1))
+
+		require.Equal(test, []string{"STORED"}, client.do("append key 0 0 2\n!!\n", 1))
+		require.Equal(test, []string{"STORED"}, client.do("prepend key 0 0 2\n<<\n", 1))
+		require.Equal(test, []string{"NOT_STORED"}, client.do("append missing 0 0 2\n!!\n", 1))
+		require.Equal(test, []string{"VALUE key 42 9", "<<value!!", "END"}, client.do("get key\n", 3))
+
+		require.Equal(test, []string{"DELETED"}, client.do("delete key\n", 1))
+		require.Equal(test, []string{"NOT_FOUND"}, client.do("delete key\n", 1))
+
+		// Strings added by Go code are served without flags.
+		require.NoError(test, cache.Add(&caching.AddCacheParams{Key: "string", Value: "text"}))
+		require.Equal(test, []string{"VALUE string 0 4", "text", "END"}, client.do("get string\n", 3))
+
+		require.Equal(test, []string{"OK"}, client.do("flush_all\n", 1))
+		require.Equal(test, 0, cache.Len())
+	})
+
+	test.Run("cas tokens are the versions of the entries", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		require.Equal(test, []string{"NOT_FOUND"}, client.do("cas key 0 0 1 1\nx\n", 1))
+		require.Equal(test, []string{"STORED"}, client.do("set key 0 0 5\nfirst\n", 1))
+
+		info, found := cache.Info("key")
+		require.True(test, found)
+
+		replies := client.do("gets key\n", 3)
+		require.Equal(test, "VALUE key 0 5 "+uitoa(info.Version), replies[0])
+
+		require.Equal(test, []string{"EXISTS"}, client.do("cas key 0 0 6 "+uitoa(info.Version+1)+"\nsecond\n", 1))
+		require.Equal(test, []string{"STORED"}, client.do("cas key 0 0 6 "+uitoa(info.Version)+"\nsecond\n", 1))
+		require.Equal(test, []string{"EXISTS"}, client.do("cas key 0 0 5 "+uitoa(info.Version)+"\nthird\n", 1))
+		require.Equal(test, []string{"VALUE key 0 6", "second", "END"}, client.do("get key\n", 3))
+	})
+
+	test.Run("counters wrap on incr and stop at 0 on decr", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		require.Equal(test, []string{"NOT_FOUND"}, client.do("incr counter 1\n", 1))
+		require.Equal(test, []string{"STORED"}, client.do("set counter 7 0 2\n10\n", 1))
+		require.Equal(test, []string{"15"}, client.do("incr counter 5\n", 1))
+		require.Equal(test, []string{"0"}, client.do("decr counter 100\n", 1))
+		require.Equal(test, []string{"VALUE counter 7 1", "0", "END"}, client.do("get counter\n", 3))
+
+		require.Equal(test, []string{"STORED"}, client.do("set max 0 0 20\n18446744073709551615\n", 1))
+		require.Equal(test, []string{"0"}, client.do("incr max 1\n", 1))
+
+		require.Equal(test, []string{"STORED"}, client.do("set text 0 0 3\nabc\n", 1))
+		require.Equal(test, []string{errNonNumeric}, client.do("incr text 1\n", 1))
+		require.Equal(test, []string{"CLIENT_ERROR invalid numeric delta argument"}, client.do("incr counter -1\n", 1))
+	})
+
+	test.Run("items expire and are touched", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		// The clock of the cache is a day ahead.
+		clock := caching.NewFakeClock(time.Now().Add(24 * time.Hour))
+		cache, _, addr := newServer(test, &caching.CreateCacheParams{Clock: clock})
+		client := dial(test, addr)
+
+		require.Equal(test, []string{"STORED"}, client.do("set key 0 10 1\nx\n", 1))
+		ttl, found := cache.TTL("key")
+		require.True(test, found)
+		require.Equal(test, 10*time.Second, ttl)
+
+		require.Equal(test, []string{"TOUCHED"}, client.do("touch key 100\n", 1))
+		require.Equal(test, []string{"NOT_FOUND"}, client.do("touch missing 100\n", 1))
+		ttl, _ = cache.TTL("key")
+		require.Equal(test, 100*time.Second, ttl)
+
+		require.Equal(test, []string{"TOUCHED"}, client.do("touch key 0\n", 1))
+		ttl, _ = cache.TTL("key")
+		require.Negative(test, ttl)
+
+		// A Unix time beyond 30 days is absolute.
+		require.Equal(test, []string{"STORED"}, client.do("set absolute 0 "+itoa(clock.Now().Add(time.Hour).Unix())+" 1\nx\n", 1))
+		ttl, _ = cache.TTL("absolute")
+		require.InDelta(test, time.Hour, ttl, float64(time.Second))
+
+		// A negative exptime expires the item at once.
+		require.Equal(test, []string{"STORED"}, client.do("set key 0 -1 1\nx\n", 1))
+		require.Equal(test, []string{"END"}, client.do("get key\n", 1))
+
+		// A delayed flush_all removes the items stored until its deadline,
+		// including those stored in the meantime, but not those stored later.
+		require.Equal(test, []string{"STORED"}, client.do("set key 0 0 1\nx\n", 1))
+		require.Equal(test, []string{"OK"}, client.do("flush_all 30\n", 1))
+		clock.Advance(10 * time.Second)
+		require.Equal(test, []string{"STORED"}, client.do("set later 0 0 1\ny\n", 1))
+		clock.Advance(20 * time.Second)
+		require.Equal(test, []string{"VALUE key 0 1", "x", "VALUE later 0 1", "y", "END"}, client.do("get key later\n", 5))
+
+		clock.Advance(time.Nanosecond)
+		require.Equal(test, []string{"STORED"}, client.do("set after 0 0 1\nz\n", 1))
+		require.Equal(test, []string{"VALUE after 0 1", "z", "END"}, client.do("get key later after\n", 3))
+
+		// flush_all without a delay cancels a pending one.
+		require.Equal(test, []string{"OK"}, client.do("flush_all 30\n", 1))
+		require.Equal(test, []string{"OK"}, client.do("flush_all\n", 1))
+		require.Equal(test, []string{"STORED"}, client.do("set key 0 0 1\nx\n", 1))
+		clock.Advance(time.Minute)
+		require.Equal(test, []string{"VALUE key 0 1", "x", "END"}, client.do("get key\n", 3))
+	})
+
+	test.Run("noreply suppresses the replies", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		replies := client.do("set a 0 0 1 noreply\n1\nincr a 1 noreply\ndelete missing noreply\ntouch a 10 noreply\nget a\n", 3)
+		require.Equal(test, []string{"VALUE a 0 1", "2", "END"}, replies)
+	})
+
+	test.Run("malformed requests get errors", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		require.Equal(test, []string{"ERROR"}, client.do("bogus\n", 1))
+		require.Equal(test, []string{"ERROR"}, client.do("get\n", 1))
+		require.Equal(test, []string{errFormat}, client.do("set key x 0 1\n", 1))
+		require.Equal(test, []string{errFormat}, client.do("get "+strings.Repeat("k", maxKeySize+1)+"\n", 1))
+		require.Equal(test, []string{errDataChunk}, client.do("set key 0 0 1\nxyz\n", 1))
+		require.Equal(test, []string{errTooLarge}, client.do("set key 0 0 2000\n"+strings.Repeat("x", 2000)+"\n", 1))
+		require.Equal(test, []string{"VERSION " + version}, client.do("version\n", 1))
+
+		_, err := client.conn.Write([]byte("quit\r\n"))
+		require.NoError(test, err)
+		_, err = client.reader.ReadByte()
+		require.ErrorIs(test, err, io.EOF)
+	})
+
+	test.Run("stats reports the counters of the cache", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		require.Equal(test, []string{"STORED"}, client.do("set key 0 0 1\nx\n", 1))
+		require.Len(test, client.do("get key missing\n", 3), 3)
+
+		_, err := client.conn.Write([]byte("stats\r\n"))
+		require.NoError(test, err)
+
+		stats := map[string]string{}
+
+		for {
+			line := client.read(1)[0]
+			if line == "END" {
+				break
+			}
+
+			fields := strings.Fields(line)
+			require.Len(test, fields, 3)
+			stats[fields[1]] = fields[2]
+		}
+
+		require.Equal(test, "1", stats["get_hits"])
+		require.Equal(test, "1", stats["get_misses"])
+		require.Equal(test, "2", stats["cmd_get"])
+		require.Equal(test, "1", stats["cmd_set"])
+		require.Equal(test, "1", stats["curr_items"])
+		require.Equal(test, "1", stats["total_items"])
+		require.Equal(test, "1", stats["curr_connections"])
+	})
+
+	test.Run("binary values survive an obfuscated cache", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{IsCacheObfuscated: true})
+		client := dial(test, addr)
+
+		binary := string([]byte{0xff, 0x00, 0xfe})
+		require.Equal(test, []string{"STORED"}, client.do("set key 3 0 3\n"+binary+"\n", 1))
+		require.Equal(test, []string{"VALUE key 3 3", binary, "END"}, client.do("get key\n", 3))
+	})
+
+	test.Run("Close disconnects the clients", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, server, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+		require.Equal(test, []string{"VERSION " + version}, client.do("version\n", 1))
+
+		require.NoError(test, server.Close())
+		require.ErrorIs(test, server.Close(), ErrClosed)
+
+		_, err := client.reader.ReadByte()
+		require.Error(test, err)
+	})
+
+	test.Run("New requires a cache", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, err := New(&Params{})
+		require.ErrorIs(test, err, ErrInvalidParams)
+	})
+}
+
+func uitoa(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,77 @@
+package caching
+
+// namespacedKey is the key of an entry of a namespace in the shared cache map,
+// so namespaces never collide with each other or with the root cache
+type namespacedKey struct {
+	namespace string
+	key       any
+}
+
+// Namespace returns the namespace of the cache with the provided name, creating
+// it on first use. A namespace is a view with the same API whose keys are
+// partitioned from those of the root cache and of other namespaces. It has its
+// own expiry, stats and tags, and is cleared or closed independently, while
+// sharing the storage, the background cleaner and the obfuscation key of the
+// root cache.
+//
+// A new namespace inherits the expiry of the cache it is created from. Nested
+// namespaces join their names with "/"; an empty name returns the cache itself.
+// Closing a namespace removes its entries, and a later Namespace call with the
+// same name returns a new, empty namespace. Closing the root cache closes every
+// namespace. Namespaces don't use the Store or the Invalidator of the root cache.
+func (cache *Cache) Namespace(name string) *Cache {
+	if name == "" {
+		return cache
+	}
+
+	if !cache.isRoot() {
+		name = cache.namespace + "/" + name
+	}
+
+	if namespace, found := cache.namespaces.Load(name); found {
+		return namespace.(*Cache)
+	}
+
+	namespace := &Cache{
+		store:     cache.store,
+		namespace: name,
+	}
+
+	options := cache.Options()
+	namespace.config.Store(&options)
+
+	actual, _ := cache.namespaces.LoadOrStore(name, namespace)
+
+	return actual.(*Cache)
+}
+
+// closeNamespace removes the entries of a namespace and detaches it from the
+// root cache
+func (cache *Cache) closeNamespace() error {
+	if cache.closed.Load() || !cache.detached.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+
+	cache.namespaces.CompareAndDelete(cache.namespace, cache)
+	cache.clear()
+
+	return nil
+}
+
+// mapKey returns the key of the cache map under which the cache stores key
+func (cache *Cache) mapKey(key any) any {
+	if cache.isRoot() {
+		return key
+	}
+
+	return namespacedKey{namespace: cache.namespace, key: key}
+}
+
+// userKey returns the key of the cache for a key of the cache map
+func (cache *Cache) userKey(key any) any {
+	if namespaced, ok := key.(namespacedKey); ok {
+		return namespaced.key
+	}
+
+	return key
+}
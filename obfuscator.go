@@ -5,17 +5,24 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"errors"
+	"io"
+	"slices"
+	"sync/atomic"
 )
 
 const (
 	keyBytes = 32
 )
 
-// Obfuscator struct to hold random key bytes
+// Obfuscator struct to hold random key bytes and the AES-GCM cipher built from them.
+// The cipher is built once and is safe for concurrent use.
 type Obfuscator struct {
-	key []byte
+	key  []byte
+	aead atomic.Pointer[cipher.AEAD] // nil once closed
 }
 
+var _ io.Closer = (*Obfuscator)(nil)
+
 // NewObfuscator generates a random 256-bit key for obfuscation
 func NewObfuscator() *Obfuscator {
 	buf := make([]byte, keyBytes)
@@ -23,50 +30,93 @@ func NewObfuscator() *Obfuscator {
 		panic(err)
 	}
 
-	return &Obfuscator{
+	block, err := aes.NewCipher(buf)
+	if err != nil {
+		panic(err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+
+	obfuscator := &Obfuscator{
 		key: buf,
 	}
+	obfuscator.aead.Store(&gcm)
+
+	return obfuscator
 }
 
 // Obfuscate method obfuscate data using 256-bit AES-GCM. This both hides the content of
 // the data and provides a check that it hasn't been altered. Output takes the
 // form nonce|ciphertext|tag where '|' indicates concatenation.
 func (obfuscator *Obfuscator) Obfuscate(plaintext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(obfuscator.key)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = rand.Read(nonce); err != nil {
-		return nil, err
+	aead := obfuscator.aead.Load()
+	if aead == nil {
+		return nil, ErrClosed
 	}
 
-	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+	return obfuscator.SealTo(make([]byte, 0, sealedSize(*aead, len(plaintext))), plaintext)
 }
 
 // Deobfuscate method deobfuscate the data using 256-bit AES-GCM. This both hides the content of
 // the data and provides a check that it hasn't been altered. Expects input
 // form nonce|ciphertext|tag where '|' indicates concatenation.
 func (obfuscator *Obfuscator) Deobfuscate(ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(obfuscator.key)
-	if err != nil {
-		return nil, err
+	return obfuscator.OpenTo(nil, ciphertext)
+}
+
+// SealTo obfuscates plaintext like Obfuscate, appending the output to dst and
+// returning the updated slice. Reusing dst avoids allocating the output; dst and
+// plaintext must not overlap.
+func (obfuscator *Obfuscator) SealTo(dst []byte, plaintext []byte) ([]byte, error) {
+	aead := obfuscator.aead.Load()
+	if aead == nil {
+		return nil, ErrClosed
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
+	nonceSize := (*aead).NonceSize()
+
+	dst = slices.Grow(dst, sealedSize(*aead, len(plaintext)))
+	nonce := dst[len(dst) : len(dst)+nonceSize]
+
+	if _, err := rand.Read(nonce); err != nil {
 		return nil, err
 	}
 
-	if len(ciphertext) < gcm.NonceSize() {
+	return (*aead).Seal(dst[:len(dst)+nonceSize], nonce, plaintext, nil), nil
+}
+
+// OpenTo deobfuscates ciphertext like Deobfuscate, appending the plaintext to
+// dst and returning the updated slice. Reusing dst avoids allocating the output;
+// dst and ciphertext must not overlap.
+func (obfuscator *Obfuscator) OpenTo(dst []byte, ciphertext []byte) ([]byte, error) {
+	aead := obfuscator.aead.Load()
+	if aead == nil {
+		return nil, ErrClosed
+	}
+
+	nonceSize := (*aead).NonceSize()
+	if len(ciphertext) < nonceSize {
 		return nil, errors.New("malformed ciphertext")
 	}
 
-	return gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], nil)
+	return (*aead).Open(dst, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+}
+
+// Close zeroes the key and releases the cipher, after which every operation
+// returns ErrClosed. Operations already in progress complete normally. The AES
+// key schedule inside the cipher can't be zeroed from Go; it is left to the
+// garbage collector once those operations complete. Close is idempotent.
+func (obfuscator *Obfuscator) Close() error {
+	obfuscator.aead.Store(nil)
+	clear(obfuscator.key)
+
+	return nil
+}
+
+// sealedSize returns the size of the output of aead for a plaintext of n bytes
+func sealedSize(aead cipher.AEAD, n int) int {
+	return aead.NonceSize() + n + aead.Overhead()
 }
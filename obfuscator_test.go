@@ -0,0 +1,190 @@
+package caching
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/require"
+)
+
+var benchmarkPlaintext = bytes.Repeat([]byte(`{"Value":"value"}`), 16)
+
+func TestService_Obfuscator(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("SealTo and OpenTo append to dst", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		obfuscator := NewObfuscator()
+		prefix := []byte("prefix")
+
+		sealed, err := obfuscator.SealTo(bytes.Clone(prefix), benchmarkPlaintext)
+		require.NoError(test, err)
+		require.Equal(test, prefix, sealed[:len(prefix)])
+
+		opened, err := obfuscator.OpenTo(bytes.Clone(prefix), sealed[len(prefix):])
+		require.NoError(test, err)
+		require.Equal(test, append(bytes.Clone(prefix), benchmarkPlaintext...), opened)
+
+		// Output of SealTo and Obfuscate is interchangeable.
+		plaintext, err := obfuscator.Deobfuscate(sealed[len(prefix):])
+		require.NoError(test, err)
+		require.Equal(test, benchmarkPlaintext, plaintext)
+	})
+
+	test.Run("OpenTo rejects tampered and malformed ciphertext", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		obfuscator := NewObfuscator()
+
+		ciphertext, err := obfuscator.Obfuscate(benchmarkPlaintext)
+		require.NoError(test, err)
+
+		ciphertext[len(ciphertext)-1] ^= 0xff
+
+		_, err = obfuscator.OpenTo(nil, ciphertext)
+		require.Error(test, err)
+
+		_, err = obfuscator.OpenTo(nil, []byte("short"))
+		require.Error(test, err)
+	})
+
+	test.Run("Close zeroes the key and rejects later operations", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		obfuscator := NewObfuscator()
+
+		ciphertext, err := obfuscator.Obfuscate(benchmarkPlaintext)
+		require.NoError(test, err)
+
+		require.NoError(test, obfuscator.Close())
+		require.Equal(test, make([]byte, keyBytes), obfuscator.key)
+
+		_, err = obfuscator.Obfuscate(benchmarkPlaintext)
+		require.ErrorIs(test, err, ErrClosed)
+
+		_, err = obfuscator.Deobfuscate(ciphertext)
+		require.ErrorIs(test, err, ErrClosed)
+
+		_, err = obfuscator.SealTo(nil, benchmarkPlaintext)
+		require.ErrorIs(test, err, ErrClosed)
+
+		_, err = obfuscator.OpenTo(nil, ciphertext)
+		require.ErrorIs(test, err, ErrClosed)
+
+		require.NoError(test, obfuscator.Close())
+	})
+
+	test.Run("SealTo and OpenTo don't allocate when dst has room", func(test *testing.T) {
+		defer flumetest.Start(test)
+
+		obfuscator := NewObfuscator()
+
+		ciphertext, err := obfuscator.Obfuscate(benchmarkPlaintext)
+		require.NoError(test, err)
+
+		sealBuf := make([]byte, 0, len(ciphertext))
+		openBuf := make([]byte, 0, len(benchmarkPlaintext))
+
+		allocs := testing.AllocsPerRun(100, func() {
+			sealBuf, _ = obfuscator.SealTo(sealBuf[:0], benchmarkPlaintext)
+			openBuf, _ = obfuscator.OpenTo(openBuf[:0], ciphertext)
+		})
+		require.Zero(test, allocs)
+	})
+}
+
+// BenchmarkObfuscator_RebuildCipher measures obfuscation with the AES-GCM cipher
+// rebuilt on every call, as the Obfuscator used to, for comparison
+func BenchmarkObfuscator_RebuildCipher(b *testing.B) {
+	key := make([]byte, keyBytes)
+	_, _ = rand.Read(key)
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		block, _ := aes.NewCipher(key)
+		gcm, _ := cipher.NewGCM(block)
+
+		nonce := make([]byte, gcm.NonceSize())
+		_, _ = rand.Read(nonce)
+
+		ciphertext := gcm.Seal(nonce, nonce, benchmarkPlaintext, nil)
+		_, _ = gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], nil)
+	}
+}
+
+func BenchmarkObfuscator_Obfuscate(b *testing.B) {
+	obfuscator := NewObfuscator()
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		ciphertext, _ := obfuscator.Obfuscate(benchmarkPlaintext)
+		_, _ = obfuscator.Deobfuscate(ciphertext)
+	}
+}
+
+func BenchmarkObfuscator_SealTo(b *testing.B) {
+	obfuscator := NewObfuscator()
+
+	var sealBuf, openBuf []byte
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		sealBuf, _ = obfuscator.SealTo(sealBuf[:0], benchmarkPlaintext)
+		openBuf, _ = obfuscator.OpenTo(openBuf[:0], sealBuf)
+	}
+}
+
+func BenchmarkCache_GetObfuscated(b *testing.B) {
+	cache := NewCache(&CreateCacheParams{
+		IsCacheObfuscated: true,
+		Clock:             NewFakeClock(time.Now()),
+	})
+	b.Cleanup(func() {
+		_ = cache.Close()
+	})
+
+	err := cache.Add(&AddCacheParams{
+		Key:   testCacheKey,
+		Value: testCacheValue,
+	})
+	require.NoError(b, err)
+
+	var value testStruct
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		_ = cache.Get(testCacheKey, &value)
+	}
+}
+
+func BenchmarkCache_AddObfuscated(b *testing.B) {
+	cache := NewCache(&CreateCacheParams{
+		IsCacheObfuscated: true,
+		Clock:             NewFakeClock(time.Now()),
+	})
+	b.Cleanup(func() {
+		_ = cache.Close()
+	})
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		_ = cache.Add(&AddCacheParams{
+			Key:   testCacheKey,
+			Value: testCacheValue,
+		})
+	}
+}
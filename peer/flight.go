@@ -0,0 +1,66 @@
+package peer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// flights collapses concurrent calls for the same key into one
+	flights struct {
+		timeout time.Duration // bound of each call
+		lock    sync.Mutex
+		calls   map[string]*flight
+	}
+
+	// flight is a call in progress, whose result is shared by every caller
+	flight struct {
+		done chan struct{}
+		data []byte
+		err  error
+	}
+)
+
+// do calls fn for key, unless a call for key is already in progress, and
+// waits for its result. Callers must not modify the returned data. fn runs on
+// a context detached from ctx and bounded by the timeout, so that a caller
+// whose ctx is done stops waiting while the call goes on for the others.
+func (flights *flights) do(ctx context.Context, key string, fn func(ctx context.Context, key string) ([]byte, error)) ([]byte, error) {
+	flights.lock.Lock()
+
+	call, found := flights.calls[key]
+	if !found {
+		if flights.calls == nil {
+			flights.calls = make(map[string]*flight)
+		}
+
+		call = &flight{done: make(chan struct{})}
+		flights.calls[key] = call
+
+		go flights.run(context.WithoutCancel(ctx), key, call, fn)
+	}
+
+	flights.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run makes call, then releases its callers
+func (flights *flights) run(ctx context.Context, key string, call *flight, fn func(ctx context.Context, key string) ([]byte, error)) {
+	ctx, cancel := context.WithTimeout(ctx, flights.timeout)
+	defer cancel()
+
+	call.data, call.err = fn(ctx, key)
+
+	flights.lock.Lock()
+	delete(flights.calls, key)
+	flights.lock.Unlock()
+
+	close(call.done)
+}
@@ -0,0 +1,329 @@
+// Package peer spreads the keys of a cache across several processes. Each key
+// is owned by one process, chosen on a consistent-hash ring: the owner loads
+// it and caches it, and the other processes fetch it from the owner over HTTP
+// instead of loading it themselves. Keys fetched often are replicated for a
+// short time by the processes fetching them.
+package peer
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vijsourabh/caching"
+)
+
+const (
+	defaultReplicas     = 64
+	defaultHotThreshold = 10
+	defaultHotExpiry    = 10 * time.Second
+	defaultBasePath     = "/_peer/"
+	defaultTimeout      = 5 * time.Second
+	defaultMaxValueSize = 16 << 20
+	// hotNamespace is the namespace of the cache holding the replicated hot keys
+	hotNamespace = "hot"
+	// maxTracked bounds the number of keys whose fetches are counted
+	maxTracked = 1 << 16
+)
+
+var (
+	// ErrInvalidParams is returned by New when the provided Params are rejected
+	ErrInvalidParams = errors.New("invalid peer group params")
+	// ErrPeer is returned when the owner of a key fails to serve it
+	ErrPeer = errors.New("peer failed")
+)
+
+type (
+	// Loader loads the value of a key in the process owning it. Any
+	// caching.Store is a Loader. Implementations must be safe for concurrent use.
+	Loader interface {
+		// Load returns the value of key, or an error wrapping caching.ErrNotFound
+		// if there is none. Values are JSON-encoded to be cached and sent to peers.
+		Load(ctx context.Context, key any) (any, error)
+	}
+
+	// Params configures New
+	Params struct {
+		// Self is the base URL other processes reach this one at, such as
+		// "http://10.0.0.1:8080". It is added to Peers if missing.
+		Self string
+		// Peers are the base URLs of every process of the group.
+		Peers []string
+		// Cache caches the keys this process owns, and its "hot" namespace the
+		// hot keys it replicates.
+		Cache *caching.Cache
+		// Loader loads the keys this process owns.
+		Loader Loader
+		// Replicas is the number of virtual nodes of each peer on the ring.
+		// Defaults to 64. Every process must use the same.
+		Replicas int
+		// HotThreshold is the number of fetches of a key from its owner after
+		// which the key is replicated locally. Defaults to 10; negative disables
+		// replication.
+		HotThreshold int
+		// HotExpiry is the TTL of replicated keys. Keep it short: replicas are
+		// not refreshed when the owner reloads the key. Defaults to 10 seconds.
+		HotExpiry time.Duration
+		// BasePath is the path the group serves peers on. Defaults to "/_peer/".
+		BasePath string
+		// Timeout bounds every load and fetch, which goes on when the callers
+		// waiting for it give up. Defaults to 5 seconds.
+		Timeout time.Duration
+		// Client fetches keys from their owners. Defaults to a client timing
+		// out after Timeout.
+		Client *http.Client
+		// MaxValueSize is the size in bytes of the largest value fetched from
+		// a peer. Larger values fail with ErrPeer. Defaults to 16 MiB.
+		MaxValueSize int64
+	}
+
+	// Group is a cache whose keys are owned by the processes of a group. It is
+	// an http.Handler serving the keys this process owns to the other ones, to
+	// mount on BasePath.
+	Group struct {
+		self         string
+		cache        *caching.Cache
+		hot          *caching.Cache
+		loader       Loader
+		replicas     int
+		hotThreshold int
+		hotExpiry    time.Duration
+		basePath     string
+		client       *http.Client
+		maxValueSize int64
+		lock         sync.RWMutex
+		ring         *ring
+		fetches      map[string]int
+		loading      flights // loads of owned keys, for this process and its peers
+		fetching     flights // fetches of keys owned by peers
+		stats        groupStats
+	}
+
+	// Stats is a snapshot of the counters of a Group
+	Stats struct {
+		LocalHits   uint64 // keys found in the cache of owned keys
+		HotHits     uint64 // keys found among the replicated hot keys
+		Loads       uint64 // keys loaded by the Loader
+		PeerFetches uint64 // keys fetched from their owner
+		PeerErrors  uint64 // failed fetches, loaded locally instead
+		Served      uint64 // requests of other processes served
+	}
+
+	// groupStats holds the counters reported by Stats
+	groupStats struct {
+		localHits   atomic.Uint64
+		hotHits     atomic.Uint64
+		loads       atomic.Uint64
+		peerFetches atomic.Uint64
+		peerErrors  atomic.Uint64
+		served      atomic.Uint64
+	}
+)
+
+// New creates a Group. Closing it is left to the owner of the cache.
+func New(params *Params) (*Group, error) {
+	switch {
+	case params.Self == "":
+		return nil, fmt.Errorf("%w: Self is required", ErrInvalidParams)
+	case params.Cache == nil:
+		return nil, fmt.Errorf("%w: Cache is required", ErrInvalidParams)
+	case params.Loader == nil:
+		return nil, fmt.Errorf("%w: Loader is required", ErrInvalidParams)
+	}
+
+	group := &Group{
+		self:         params.Self,
+		cache:        params.Cache,
+		hot:          params.Cache.Namespace(hotNamespace),
+		loader:       params.Loader,
+		replicas:     cmp.Or(params.Replicas, defaultReplicas),
+		hotThreshold: cmp.Or(params.HotThreshold, defaultHotThreshold),
+		hotExpiry:    cmp.Or(params.HotExpiry, defaultHotExpiry),
+		basePath:     cmp.Or(params.BasePath, defaultBasePath),
+		maxValueSize: cmp.Or(params.MaxValueSize, defaultMaxValueSize),
+		fetches:      make(map[string]int),
+	}
+
+	timeout := cmp.Or(params.Timeout, defaultTimeout)
+	group.client = cmp.Or(params.Client, &http.Client{Timeout: timeout})
+	group.loading.timeout = timeout
+	group.fetching.timeout = timeout
+
+	group.SetPeers(params.Peers...)
+
+	return group, nil
+}
+
+// SetPeers replaces the peers of the group, Self being added if missing.
+// Keys cached before no longer owned by this process expire with the cache.
+func (group *Group) SetPeers(peers ...string) {
+	if !slices.Contains(peers, group.self) {
+		peers = append(slices.Clone(peers), group.self)
+	}
+
+	ring := newRing(group.replicas, peers)
+
+	group.lock.Lock()
+	defer group.lock.Unlock()
+
+	group.ring = ring
+}
+
+// Owner returns the base URL of the process owning key
+func (group *Group) Owner(key string) string {
+	group.lock.RLock()
+	defer group.lock.RUnlock()
+
+	return group.ring.owner(key)
+}
+
+// Get populates value, as json.Unmarshal does, with the value of key. It is
+// read from the cache, or loaded if this process owns key, or fetched from its
+// owner otherwise. Concurrent calls for a key make a single load or fetch. A
+// key whose owner fails is loaded locally, without being cached.
+// Failures are reported as a *caching.KeyError wrapping caching.ErrNotFound
+// when the Loader has no value for key, caching.ErrStore when it fails, or
+// caching.ErrDecode.
+func (group *Group) Get(ctx context.Context, key string, value any) error {
+	data, err := group.get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(data, value); err != nil {
+		return &caching.KeyError{Key: key, Err: fmt.Errorf("%w: %w", caching.ErrDecode, err)}
+	}
+
+	return nil
+}
+
+// Stats returns a snapshot of the counters of the group
+func (group *Group) Stats() Stats {
+	return Stats{
+		LocalHits:   group.stats.localHits.Load(),
+		HotHits:     group.stats.hotHits.Load(),
+		Loads:       group.stats.loads.Load(),
+		PeerFetches: group.stats.peerFetches.Load(),
+		PeerErrors:  group.stats.peerErrors.Load(),
+		Served:      group.stats.served.Load(),
+	}
+}
+
+// get returns the JSON encoding of the value of key
+func (group *Group) get(ctx context.Context, key string) ([]byte, error) {
+	if data, err := group.cache.GetBytes(key, nil); err == nil {
+		group.stats.localHits.Add(1)
+
+		return data, nil
+	}
+
+	if data, err := group.hot.GetBytes(key, nil); err == nil {
+		group.stats.hotHits.Add(1)
+
+		return data, nil
+	}
+
+	owner := group.Owner(key)
+	if owner == group.self {
+		return group.loading.do(ctx, key, group.load)
+	}
+
+	// Fetches have flights of their own: a fetch waiting for a peer, itself
+	// fetching the key from this process, must not hold up the load it serves.
+	return group.fetching.do(ctx, key, func(ctx context.Context, key string) ([]byte, error) {
+		data, err := group.fetch(ctx, owner, key)
+		if err == nil {
+			group.stats.peerFetches.Add(1)
+			group.replicate(key, data)
+
+			return data, nil
+		}
+
+		if errors.Is(err, caching.ErrNotFound) {
+			return nil, err
+		}
+
+		group.stats.peerErrors.Add(1)
+
+		return group.loadValue(ctx, key)
+	})
+}
+
+// load returns the JSON encoding of the value of key, an owned key, from the
+// cache or loaded and cached
+func (group *Group) load(ctx context.Context, key string) ([]byte, error) {
+	// The key may have been cached since the caller missed it.
+	if data, err := group.cache.GetBytes(key, nil); err == nil {
+		return data, nil
+	}
+
+	data, err := group.loadValue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = group.cache.Add(&caching.AddCacheParams{Key: key, Value: json.RawMessage(data)}); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// loadValue returns the JSON encoding of the value of key loaded by the Loader
+func (group *Group) loadValue(ctx context.Context, key string) ([]byte, error) {
+	group.stats.loads.Add(1)
+
+	value, err := group.loader.Load(ctx, key)
+	if errors.Is(err, caching.ErrNotFound) {
+		return nil, &caching.KeyError{Key: key, Err: caching.ErrNotFound}
+	}
+
+	if err != nil {
+		return nil, &caching.KeyError{Key: key, Err: fmt.Errorf("%w: %w", caching.ErrStore, err)}
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, &caching.KeyError{Key: key, Err: fmt.Errorf("%w: %w", caching.ErrEncode, err)}
+	}
+
+	return data, nil
+}
+
+// replicate caches data, the value of key fetched from its owner, in the hot
+// keys once key has been fetched HotThreshold times
+func (group *Group) replicate(key string, data []byte) {
+	if group.hotThreshold < 0 {
+		return
+	}
+
+	group.lock.Lock()
+
+	if len(group.fetches) >= maxTracked {
+		clear(group.fetches)
+	}
+
+	group.fetches[key]++
+
+	hot := group.fetches[key] >= group.hotThreshold
+	if hot {
+		delete(group.fetches, key)
+	}
+
+	group.lock.Unlock()
+
+	if hot {
+		_ = group.hot.Add(&caching.AddCacheParams{
+			Key:    key,
+			Value:  json.RawMessage(data),
+			Expiry: group.hotExpiry,
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package peer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vijsourabh/caching"
+)
+
+// testLoader is a Loader shared by the groups of a test, like a database,
+// counting the loads of each key. Loads wait for gate when it is set.
+type testLoader struct {
+	store *caching.MemoryStore
+	gate  chan struct{}
+	lock  sync.Mutex
+	loads map[any]int
+}
+
+func newTestLoader(values map[string]string) *testLoader {
+	loader := &testLoader{
+		store: caching.NewMemoryStore(),
+		loads: make(map[any]int),
+	}
+
+	for key, value := range values {
+		_ = loader.store.Save(context.Background(), key, value)
+	}
+
+	return loader
+}
+
+func (loader *testLoader) Load(ctx context.Context, key any) (any, error) {
+	loader.lock.Lock()
+	loader.loads[key]++
+	loader.lock.Unlock()
+
+	if loader.gate != nil {
+		<-loader.gate
+	}
+
+	return loader.store.Load(ctx, key)
+}
+
+func (loader *testLoader) count(key any) int {
+	loader.lock.Lock()
+	defer loader.lock.Unlock()
+
+	return loader.loads[key]
+}
+
+// newGroups starts n groups on loopback servers, sharing loader and configured
+// by params. Their servers and caches are closed at the end of the test.
+func newGroups(test *testing.T, n int, loader Loader, params Params) []*Group {
+	groups := make([]*Group, n)
+	peers := make([]string, n)
+
+	for i := range n {
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			groups[i].ServeHTTP(writer, request)
+		}))
+		test.Cleanup(server.Close)
+
+		peers[i] = server.URL
+	}
+
+	for i := range n {
+		cache := caching.NewCache(&caching.CreateCacheParams{})
+		test.Cleanup(func() {
+			_ = cache.Close()
+		})
+
+		params := params
+		params.Self = peers[i]
+		params.Peers = peers
+		params.Cache = cache
+		params.Loader = loader
+
+		group, err := New(&params)
+		require.NoError(test, err)
+
+		groups[i] = group
+	}
+
+	return groups
+}
+
+// ownedBy returns a key of values owned by owner
+func ownedBy(test *testing.T, owner *Group, values map[string]string) string {
+	for key := range values {
+		if owner.Owner(key) == owner.self {
+			return key
+		}
+	}
+
+	require.FailNow(test, "no key owned by "+owner.self)
+
+	return ""
+}
+
+func testValues(n int) map[string]string {
+	values := make(map[string]string, n)
+	for i := range n {
+		values[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("value-%d", i)
+	}
+
+	return values
+}
+
+func TestService_Group(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("keys are loaded once, by their owner", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		values := testValues(60)
+		loader := newTestLoader(values)
+		groups := newGroups(test, 3, loader, Params{HotThreshold: -1})
+
+		for _, group := range groups {
+			for key, want := range values {
+				var value string
+				require.NoError(test, group.Get(context.Background(), key, &value))
+				require.Equal(test, want, value)
+			}
+		}
+
+		owned := 0
+
+		for _, group := range groups {
+			for key := range values {
+				// Every group agrees on the owner, the only one caching the key.
+				require.Equal(test, groups[0].Owner(key), group.Owner(key))
+
+				_, cached := group.cache.TTL(key)
+				require.Equal(test, group.Owner(key) == group.self, cached)
+			}
+
+			owned += group.cache.Len()
+			stats := group.Stats()
+			require.Equal(test, uint64(group.cache.Len()), stats.Loads)
+			require.Equal(test, uint64(len(values)-group.cache.Len()), stats.PeerFetches)
+			require.Zero(test, stats.PeerErrors)
+		}
+
+		require.Equal(test, len(values), owned)
+
+		for key := range values {
+			require.Equal(test, 1, loader.count(key))
+		}
+	})
+
+	test.Run("concurrent gets of a key make a single load and fetch per peer", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		loader := newTestLoader(map[string]string{"key": "value"})
+		loader.gate = make(chan struct{})
+		groups := newGroups(test, 3, loader, Params{HotThreshold: -1})
+
+		var (
+			arrived atomic.Int32
+			done    sync.WaitGroup
+		)
+
+		for _, group := range groups {
+			for range 10 {
+				done.Add(1)
+
+				go func() {
+					defer done.Done()
+
+					arrived.Add(1)
+
+					var value string
+					if err := group.Get(context.Background(), "key", &value); err != nil || value != "value" {
+						test.Errorf("unexpected value %q: %v", value, err)
+					}
+				}()
+			}
+		}
+
+		require.Eventually(test, func() bool {
+			return arrived.Load() == 30 && loader.count("key") == 1
+		}, time.Second, time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(loader.gate)
+		done.Wait()
+
+		require.Equal(test, 1, loader.count("key"))
+
+		for _, group := range groups {
+			if group.Owner("key") == group.self {
+				require.Equal(test, uint64(1), group.Stats().Loads)
+				require.Equal(test, uint64(2), group.Stats().Served)
+			} else {
+				require.Equal(test, uint64(1), group.Stats().PeerFetches)
+			}
+		}
+	})
+
+	test.Run("hot keys are replicated by the peers fetching them", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		values := testValues(20)
+		groups := newGroups(test, 2, newTestLoader(values), Params{HotThreshold: 2, HotExpiry: time.Hour})
+		owner, other := groups[0], groups[1]
+		key := ownedBy(test, owner, values)
+
+		var value string
+		for range 4 {
+			require.NoError(test, other.Get(context.Background(), key, &value))
+			require.Equal(test, values[key], value)
+		}
+
+		require.Equal(test, Stats{HotHits: 2, PeerFetches: 2}, other.Stats())
+		require.Equal(test, uint64(2), owner.Stats().Served)
+
+		ttl, found := other.hot.TTL(key)
+		require.True(test, found)
+		require.Greater(test, ttl, 59*time.Minute)
+
+		// Replicas are not keys the peer owns.
+		_, found = other.cache.TTL(key)
+		require.False(test, found)
+	})
+
+	test.Run("a caller giving up leaves the load to the others", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		values := testValues(20)
+		loader := newTestLoader(values)
+		loader.gate = make(chan struct{})
+		groups := newGroups(test, 2, loader, Params{HotThreshold: -1})
+		owner, other := groups[0], groups[1]
+		key := ownedBy(test, owner, values)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		failed := make(chan error, 1)
+
+		go func() {
+			var value string
+			failed <- other.Get(ctx, key, &value)
+		}()
+
+		require.Eventually(test, func() bool {
+			return loader.count(key) == 1
+		}, time.Second, time.Millisecond)
+
+		got := make(chan error, 1)
+
+		go func() {
+			var value string
+			got <- owner.Get(context.Background(), key, &value)
+		}()
+
+		cancel()
+		require.ErrorIs(test, <-failed, context.Canceled)
+
+		close(loader.gate)
+		require.NoError(test, <-got)
+		require.Equal(test, 1, loader.count(key))
+
+		var value string
+		require.NoError(test, other.Get(context.Background(), key, &value))
+		require.Equal(test, values[key], value)
+		require.Equal(test, 1, loader.count(key))
+	})
+
+	test.Run("peers whose rings disagree serve each other without waiting", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		values := testValues(200)
+		loader := newTestLoader(values)
+		loader.gate = make(chan struct{})
+		groups := newGroups(test, 2, loader, Params{HotThreshold: -1})
+		first, second := groups[0], groups[1]
+
+		key := ownedBy(test, second, values)
+
+		// The ring of second is missing second itself, as if it were late to join.
+		second.ring = newRing(second.replicas, []string{first.self})
+		require.Equal(test, first.self, second.Owner(key))
+
+		var done sync.WaitGroup
+
+		for _, group := range groups {
+			done.Go(func() {
+				var value string
+				if err := group.Get(context.Background(), key, &value); err != nil || value != values[key] {
+					test.Errorf("unexpected value %q: %v", value, err)
+				}
+			})
+		}
+
+		// Each process loads the key for the other while its own fetch waits.
+		require.Eventually(test, func() bool {
+			return loader.count(key) == 2
+		}, time.Second, time.Millisecond)
+		close(loader.gate)
+		done.Wait()
+
+		for _, group := range groups {
+			require.Equal(test, Stats{Loads: 1, PeerFetches: 1, Served: 1}, group.Stats())
+		}
+	})
+
+	test.Run("keys of a peer that is down are loaded locally", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		values := testValues(20)
+		group := newGroups(test, 1, newTestLoader(values), Params{HotThreshold: 1})[0]
+
+		// Nothing listens on the address of the other peer anymore.
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		group.SetPeers(server.URL)
+
+		var key string
+		for key = range values {
+			if group.Owner(key) == server.URL {
+				break
+			}
+		}
+
+		require.Equal(test, server.URL, group.Owner(key))
+
+		var value string
+		require.NoError(test, group.Get(context.Background(), key, &value))
+		require.Equal(test, values[key], value)
+		require.Equal(test, Stats{Loads: 1, PeerErrors: 1}, group.Stats())
+
+		_, found := group.cache.TTL(key)
+		require.False(test, found)
+		_, found = group.hot.TTL(key)
+		require.False(test, found)
+	})
+
+	test.Run("missing keys are reported by owners and peers", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		groups := newGroups(test, 2, newTestLoader(nil), Params{})
+
+		for _, group := range groups {
+			var value string
+			err := group.Get(context.Background(), "missing", &value)
+			require.ErrorIs(test, err, caching.ErrNotFound)
+
+			var keyErr *caching.KeyError
+			require.ErrorAs(test, err, &keyErr)
+			require.Equal(test, "missing", keyErr.Key)
+		}
+	})
+
+	test.Run("404s not marked as misses and large values are peer failures", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		values := testValues(20)
+
+		// The other group fetches on a path its owner doesn't serve.
+		groups := newGroups(test, 2, newTestLoader(values), Params{})
+		owner, other := groups[0], groups[1]
+		other.basePath = "/elsewhere/"
+		key := ownedBy(test, owner, values)
+
+		var value string
+		require.NoError(test, other.Get(context.Background(), key, &value))
+		require.Equal(test, values[key], value)
+		require.Equal(test, Stats{Loads: 1, PeerErrors: 1}, other.Stats())
+
+		groups = newGroups(test, 2, newTestLoader(values), Params{MaxValueSize: 4})
+		owner, other = groups[0], groups[1]
+		key = ownedBy(test, owner, values)
+
+		_, err := other.fetch(context.Background(), owner.self, key)
+		require.ErrorIs(test, err, ErrPeer)
+		require.ErrorContains(test, err, "larger than 4 bytes")
+
+		require.NoError(test, other.Get(context.Background(), key, &value))
+		require.Equal(test, values[key], value)
+		require.Equal(test, Stats{Loads: 1, PeerErrors: 1}, other.Stats())
+	})
+
+	test.Run("failing loads are reported by peers", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		groups := newGroups(test, 2, failingLoader{}, Params{})
+		owner, other := groups[0], groups[1]
+		key := ownedBy(test, owner, testValues(20))
+
+		var value string
+		require.ErrorIs(test, owner.Get(context.Background(), key, &value), caching.ErrStore)
+
+		// The peer fails to fetch the key, then to load it locally.
+		require.ErrorIs(test, other.Get(context.Background(), key, &value), caching.ErrStore)
+		require.Equal(test, Stats{Loads: 1, PeerErrors: 1}, other.Stats())
+	})
+
+	test.Run("keys with special characters are fetched", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		values := map[string]string{}
+		for i := range 20 {
+			values[fmt.Sprintf("user/%d?name=a b#%%", i)] = fmt.Sprint(i)
+		}
+
+		groups := newGroups(test, 2, newTestLoader(values), Params{})
+
+		for _, group := range groups {
+			for key, want := range values {
+				var value string
+				require.NoError(test, group.Get(context.Background(), key, &value))
+				require.Equal(test, want, value)
+			}
+		}
+	})
+
+	test.Run("only requests for keys on BasePath are served", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		groups := newGroups(test, 1, newTestLoader(map[string]string{"key": "value"}), Params{BasePath: "/cache/"})
+
+		recorder := httptest.NewRecorder()
+		groups[0].ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/cache/key", nil))
+		require.Equal(test, http.StatusOK, recorder.Code)
+		require.JSONEq(test, `"value"`, recorder.Body.String())
+
+		for _, request := range []*http.Request{
+			httptest.NewRequest(http.MethodGet, "/_peer/key", nil),
+			httptest.NewRequest(http.MethodGet, "/cache/", nil),
+			httptest.NewRequest(http.MethodGet, "/cache/missing", nil),
+		} {
+			recorder = httptest.NewRecorder()
+			groups[0].ServeHTTP(recorder, request)
+			require.Equal(test, http.StatusNotFound, recorder.Code)
+		}
+
+		recorder = httptest.NewRecorder()
+		groups[0].ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/cache/key", nil))
+		require.Equal(test, http.StatusMethodNotAllowed, recorder.Code)
+	})
+
+	test.Run("New requires Self, a cache and a loader", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := caching.NewCache(&caching.CreateCacheParams{})
+		defer func() {
+			_ = cache.Close()
+		}()
+
+		for _, params := range []Params{
+			{Cache: cache, Loader: newTestLoader(nil)},
+			{Self: "http://self", Loader: newTestLoader(nil)},
+			{Self: "http://self", Cache: cache},
+		} {
+			_, err := New(&params)
+			require.ErrorIs(test, err, ErrInvalidParams)
+		}
+	})
+}
+
+func TestService_Ring(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("keys are spread evenly and few move when a peer joins", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		peers := []string{"http://a", "http://b", "http://c"}
+		before := newRing(defaultReplicas, peers)
+		after := newRing(defaultReplicas, append(peers, "http://d"))
+
+		owned := map[string]int{}
+		moved := 0
+
+		for i := range 10000 {
+			key := fmt.Sprint(i)
+			owned[before.owner(key)]++
+
+			if owner := after.owner(key); owner != before.owner(key) {
+				// Keys only move to the new peer.
+				require.Equal(test, "http://d", owner)
+				moved++
+			}
+		}
+
+		for _, peer := range peers {
+			require.InDelta(test, 10000/3, owned[peer], 1000, peer)
+		}
+
+		require.InDelta(test, 10000/4, moved, 1000)
+	})
+
+	test.Run("an empty ring has no owner", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		require.Empty(test, newRing(defaultReplicas, nil).owner("key"))
+	})
+}
+
+// failingLoader fails every load
+type failingLoader struct{}
+
+func (failingLoader) Load(context.Context, any) (any, error) {
+	return nil, fmt.Errorf("database is down")
+}
@@ -0,0 +1,68 @@
+package peer
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// ring is a consistent-hash ring placing every peer at several points, its
+// virtual nodes. A key is owned by the peer of the first point at or after
+// the hash of the key, so adding or removing a peer only moves the keys of
+// the points it gains or loses. Every process builds the same ring from the
+// same peers.
+type ring struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+// newRing places replicas virtual nodes of each of the peers on a ring
+func newRing(replicas int, peers []string) *ring {
+	ring := &ring{
+		points: make([]uint64, 0, replicas*len(peers)),
+		owners: make(map[uint64]string, replicas*len(peers)),
+	}
+
+	for _, peer := range peers {
+		for i := range replicas {
+			point := hash(strconv.Itoa(i) + "#" + peer)
+			if _, taken := ring.owners[point]; taken {
+				continue
+			}
+
+			ring.points = append(ring.points, point)
+			ring.owners[point] = peer
+		}
+	}
+
+	slices.Sort(ring.points)
+
+	return ring
+}
+
+// owner returns the peer owning key, or "" if the ring is empty
+func (ring *ring) owner(key string) string {
+	if len(ring.points) == 0 {
+		return ""
+	}
+
+	i, _ := slices.BinarySearch(ring.points, hash(key))
+	if i == len(ring.points) {
+		i = 0
+	}
+
+	return ring.owners[ring.points[i]]
+}
+
+// hash returns the FNV-64a hash of s, mixed with the finalizer of SplitMix64
+// so that similar strings, such as the names of virtual nodes, spread evenly
+func hash(s string) uint64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(s))
+
+	h := hasher.Sum64()
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+
+	return h ^ h>>31
+}
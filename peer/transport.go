@@ -0,0 +1,100 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vijsourabh/caching"
+)
+
+const (
+	// maxErrorSize bounds the part of an error response of a peer read into an error
+	maxErrorSize = 512
+	// missHeader marks the responses of the group for keys without a value,
+	// telling them apart from the 404 of a server not serving the group
+	missHeader = "X-Peer-Miss"
+)
+
+// ServeHTTP serves GET BasePath{key} with the JSON encoding of the value of
+// key, read from the cache or loaded. The key is loaded whoever owns it on the
+// ring of this process, so that peers whose rings disagree never loop, and
+// never waits for a fetch.
+func (group *Group) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	key, found := strings.CutPrefix(request.URL.Path, group.basePath)
+	if !found || key == "" {
+		http.NotFound(writer, request)
+
+		return
+	}
+
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	group.stats.served.Add(1)
+
+	data, err := group.loading.do(request.Context(), key, group.load)
+
+	switch {
+	case errors.Is(err, caching.ErrNotFound):
+		writer.Header().Set(missHeader, "1")
+		http.Error(writer, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	default:
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(data)
+	}
+}
+
+// fetch returns the JSON encoding of the value of key from owner.
+// Returns an error wrapping caching.ErrNotFound if owner has no value for key,
+// or ErrPeer, for a value larger than MaxValueSize or a 404 not marked as a
+// miss by the group, for example.
+func (group *Group) fetch(ctx context.Context, owner string, key string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, owner+group.basePath+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPeer, err)
+	}
+
+	response, err := group.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPeer, err)
+	}
+
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(io.LimitReader(response.Body, group.maxValueSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrPeer, owner, err)
+		}
+
+		if int64(len(data)) > group.maxValueSize {
+			return nil, fmt.Errorf("%w: %s: value larger than %d bytes", ErrPeer, owner, group.maxValueSize)
+		}
+
+		return data, nil
+	case http.StatusNotFound:
+		if response.Header.Get(missHeader) != "" {
+			return nil, &caching.KeyError{Key: key, Err: caching.ErrNotFound}
+		}
+
+		fallthrough
+	default:
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorSize))
+
+		return nil, fmt.Errorf("%w: %s: %s: %s", ErrPeer, owner, response.Status, strings.TrimSpace(string(message)))
+	}
+}
@@ -0,0 +1,104 @@
+package caching
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// RemoteCache is a cache shared by several processes, such as a Redis or
+	// memcached server, storing encoded values. It is the second tier of a
+	// TieredCache. Implementations must be safe for concurrent use.
+	RemoteCache interface {
+		// Get returns the value stored for key, or an error wrapping ErrNotFound
+		// if there is none or it has expired.
+		Get(ctx context.Context, key string) ([]byte, error)
+		// Set stores value for key for ttl. Zero or negative means it never expires.
+		Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+		// Delete removes key. Deleting a missing key is not an error.
+		Delete(ctx context.Context, key string) error
+	}
+
+	// MemoryRemote is an in-process RemoteCache, for tests and as a reference
+	// implementation
+	MemoryRemote struct {
+		lock    sync.Mutex
+		clock   Clock
+		entries map[string]remoteEntry
+	}
+
+	// remoteEntry is a value stored in a MemoryRemote
+	remoteEntry struct {
+		value     []byte
+		expiresAt time.Time // zero when the value never expires
+	}
+)
+
+var _ RemoteCache = (*MemoryRemote)(nil)
+
+// NewMemoryRemote creates an empty MemoryRemote expiring values with clock.
+// Defaults to the system clock when nil.
+func NewMemoryRemote(clock Clock) *MemoryRemote {
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	return &MemoryRemote{
+		clock:   clock,
+		entries: make(map[string]remoteEntry),
+	}
+}
+
+func (remote *MemoryRemote) Get(_ context.Context, key string) ([]byte, error) {
+	remote.lock.Lock()
+	defer remote.lock.Unlock()
+
+	entry, found := remote.entries[key]
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	if !entry.expiresAt.IsZero() && remote.clock.Now().After(entry.expiresAt) {
+		delete(remote.entries, key)
+
+		return nil, ErrNotFound
+	}
+
+	return bytes.Clone(entry.value), nil
+}
+
+func (remote *MemoryRemote) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := remoteEntry{
+		value: bytes.Clone(value),
+	}
+
+	if ttl > 0 {
+		entry.expiresAt = remote.clock.Now().Add(ttl)
+	}
+
+	remote.lock.Lock()
+	defer remote.lock.Unlock()
+
+	remote.entries[key] = entry
+
+	return nil
+}
+
+func (remote *MemoryRemote) Delete(_ context.Context, key string) error {
+	remote.lock.Lock()
+	defer remote.lock.Unlock()
+
+	delete(remote.entries, key)
+
+	return nil
+}
+
+// Len returns the number of values stored, expired or not
+func (remote *MemoryRemote) Len() int {
+	remote.lock.Lock()
+	defer remote.lock.Unlock()
+
+	return len(remote.entries)
+}
@@ -0,0 +1,446 @@
+package caching
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultLogSize = 10000
+
+type (
+	// ReplicationParams configures the replication log of a cache, which
+	// followers tail to mirror its entries
+	ReplicationParams struct {
+		// Enabled records the changes of the entries of the cache in a log,
+		// read with Snapshot and Events.
+		Enabled bool
+		// LogSize is the number of events the log holds. A follower further
+		// behind needs a new Snapshot. Defaults to 10000.
+		LogSize int
+	}
+
+	// EventType is the kind of change an Event records
+	EventType uint8
+
+	// Event is a change of an entry recorded in the replication log of a cache
+	Event struct {
+		// Sequence numbers the events of a log from 1, without gaps.
+		Sequence uint64
+		Type     EventType
+		// Key is the key of the entry in its default format.
+		Key string
+		// Value is the JSON encoding of the value, nil for EventRemove and EventExpire.
+		Value json.RawMessage
+		// ExpiresAt is the time the entry expires, zero when it never expires.
+		ExpiresAt time.Time
+		Tags      []string
+	}
+
+	// LogPosition is a position in the replication log of a cache: the last
+	// event a follower has applied
+	LogPosition struct {
+		// LogID identifies the log, and changes with every cache.
+		LogID uint64
+		// Sequence is the sequence of the last event applied, 0 before the first.
+		Sequence uint64
+	}
+
+	// Snapshot is the content of a cache at a position of its replication log
+	Snapshot struct {
+		Position LogPosition
+		// Entries are the live entries as EventAdd events, numbered with the
+		// sequence of the position.
+		Entries []Event
+	}
+
+	// replicationLog holds the latest changes of a cache in a ring
+	replicationLog struct {
+		id      uint64
+		lock    sync.Mutex // serialises the changes of the cache map and their recording
+		records []record
+		last    uint64        // sequence of the latest record, 0 before the first
+		changed chan struct{} // closed and replaced when a record is appended
+	}
+
+	// record is a change recorded in a replicationLog. The entry is that of
+	// the key after the change, nil for removals.
+	record struct {
+		eventType EventType
+		key       any
+		entry     *cacheEntry
+	}
+)
+
+const (
+	// EventAdd records an entry added or overwritten by Add, AddMany or a read-through
+	EventAdd EventType = iota + 1
+	// EventUpdate records the value of an entry replaced by Update
+	EventUpdate
+	// EventExpiry records the expiry of an entry changed by Expire, ExpireAt,
+	// Persist, Touch or UpdateTime
+	EventExpiry
+	// EventRemove records an entry removed by Remove, Clear, Expire, a tag or a dependency
+	EventRemove
+	// EventExpire records an expired entry evicted by a lookup or the cleaner
+	EventExpire
+)
+
+// newReplicationLog creates an empty log holding size records
+func newReplicationLog(size int) *replicationLog {
+	if size <= 0 {
+		size = defaultLogSize
+	}
+
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+
+	return &replicationLog{
+		id:      binary.BigEndian.Uint64(id[:]),
+		records: make([]record, size),
+		changed: make(chan struct{}),
+	}
+}
+
+// Snapshot returns the live entries of a cache created with replication
+// enabled, and the position of its log they reflect. Followers load the
+// snapshot, then apply the Events after its position.
+// Writes to the cache wait for the entries to be collected. Entries whose
+// value can't be JSON-encoded are left out, so followers remove them.
+// Returns ErrNotReplicated without replication, and ErrClosed once the cache
+// has been closed.
+func (cache *Cache) Snapshot() (*Snapshot, error) {
+	if cache.isClosed() {
+		return nil, ErrClosed
+	}
+
+	log := cache.replication
+	if log == nil {
+		return nil, ErrNotReplicated
+	}
+
+	var records []record
+
+	now := cache.clock.Now()
+
+	log.lock.Lock()
+	position := LogPosition{LogID: log.id, Sequence: log.last}
+	cache.rangeEntries(func(key any, entry *cacheEntry) bool {
+		if !entry.isExpired(now) {
+			records = append(records, record{eventType: EventAdd, key: key, entry: entry})
+		}
+
+		return true
+	})
+	log.lock.Unlock()
+
+	snapshot := &Snapshot{
+		Position: position,
+		Entries:  make([]Event, 0, len(records)),
+	}
+
+	for _, record := range records {
+		if event := cache.event(position.Sequence, record); event.Type == EventAdd {
+			snapshot.Entries = append(snapshot.Entries, event)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Events returns up to limit events following after in the replication log of
+// a cache created with replication enabled, waiting for one if there is none.
+// Changes to values that can't be JSON-encoded are returned as EventRemove.
+// Returns ErrNotReplicated without replication, ErrLogPosition if after is
+// not a position of the log or its next events are no longer held, the error
+// of ctx if it is done first, and ErrClosed once the cache has been closed.
+func (cache *Cache) Events(ctx context.Context, after LogPosition, limit int) ([]Event, error) {
+	log := cache.replication
+	if log == nil {
+		return nil, ErrNotReplicated
+	}
+
+	for {
+		if cache.isClosed() {
+			return nil, ErrClosed
+		}
+
+		log.lock.Lock()
+		records, err := log.since(after, max(limit, 1))
+		changed := log.changed
+		log.lock.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) > 0 {
+			events := make([]Event, len(records))
+			for i, record := range records {
+				events[i] = cache.event(after.Sequence+uint64(i)+1, record)
+			}
+
+			return events, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-cache.ctx.Done():
+			return nil, ErrClosed
+		}
+	}
+}
+
+// LogPosition returns the position of the latest event of the replication
+// log, or the zero position without replication
+func (cache *Cache) LogPosition() LogPosition {
+	log := cache.replication
+	if log == nil {
+		return LogPosition{}
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	return LogPosition{LogID: log.id, Sequence: log.last}
+}
+
+// Apply applies an event of the replication log of another cache, such as a
+// leader followed by a replication.Follower: the value, as json.RawMessage,
+// tags and expiry time of the key for EventAdd, EventUpdate and EventExpiry,
+// its removal for EventRemove and EventExpire. Unlike Add and Remove, it
+// neither writes through the Store nor publishes to the Invalidator: the
+// cache the event comes from already did.
+// Returns ErrClosed once the cache has been closed.
+func (cache *Cache) Apply(event *Event) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	now := cache.clock.Now()
+
+	switch {
+	case event.Type == EventRemove || event.Type == EventExpire:
+		cache.remove(event.Key)
+
+		return nil
+	case !event.ExpiresAt.IsZero() && !event.ExpiresAt.After(now):
+		// An expiry in the past removes the entry.
+		cache.remove(event.Key)
+
+		return nil
+	}
+
+	entry := newEntry(&AddCacheParams{Key: event.Key, Value: event.Value, Tags: event.Tags}, defaultExpiry, now)
+	entry.inheritsExpiry = false
+
+	if !event.ExpiresAt.IsZero() {
+		entry.expiry = event.ExpiresAt.Sub(now)
+		entry.expiresAt = event.ExpiresAt
+	}
+
+	return cache.addInCache(event.Key, entry)
+}
+
+// LoadSnapshot replaces the entries of the cache with those of a snapshot of
+// another cache, applied as Apply does. Entries are added before the others
+// are removed, so readers never see an empty cache.
+// Returns ErrClosed once the cache has been closed.
+func (cache *Cache) LoadSnapshot(snapshot *Snapshot) error {
+	keys := make(map[string]struct{}, len(snapshot.Entries))
+
+	for i := range snapshot.Entries {
+		if err := cache.Apply(&snapshot.Entries[i]); err != nil {
+			return err
+		}
+
+		keys[snapshot.Entries[i].Key] = struct{}{}
+	}
+
+	var stale []any
+
+	cache.rangeEntries(func(key any, _ *cacheEntry) bool {
+		if name, ok := key.(string); ok {
+			if _, found := keys[name]; found {
+				return true
+			}
+		}
+
+		stale = append(stale, key)
+
+		return true
+	})
+
+	for _, key := range stale {
+		cache.remove(key)
+	}
+
+	return nil
+}
+
+// append records a change as the next event and wakes the readers up
+func (log *replicationLog) append(eventType EventType, key any, entry *cacheEntry) {
+	log.last++
+	log.records[log.last%uint64(len(log.records))] = record{
+		eventType: eventType,
+		key:       key,
+		entry:     entry,
+	}
+
+	close(log.changed)
+	log.changed = make(chan struct{})
+}
+
+// since returns up to limit records following after, none if after is the
+// latest position
+func (log *replicationLog) since(after LogPosition, limit int) ([]record, error) {
+	size := uint64(len(log.records))
+	if after.LogID != log.id || after.Sequence > log.last || log.last-after.Sequence > size {
+		return nil, ErrLogPosition
+	}
+
+	count := min(log.last-after.Sequence, uint64(limit))
+	records := make([]record, count)
+
+	for i := range count {
+		records[i] = log.records[(after.Sequence+i+1)%size]
+	}
+
+	return records, nil
+}
+
+// event returns the event of a record, with the JSON encoding of its value.
+// A value that can't be encoded, or decrypted, makes it an EventRemove: the
+// followers drop the key rather than failing on it forever.
+func (cache *Cache) event(sequence uint64, record record) Event {
+	event := Event{
+		Sequence: sequence,
+		Type:     record.eventType,
+		Key:      remoteKey(record.key),
+	}
+
+	if record.entry == nil {
+		return event
+	}
+
+	data, err := cache.marshal(record.key, record.entry)
+	if err != nil {
+		event.Type = EventRemove
+
+		return event
+	}
+
+	event.Value = data
+	event.ExpiresAt = record.entry.expiresAt
+	event.Tags = slices.Clone(record.entry.tags)
+
+	return event
+}
+
+// marshal returns the JSON encoding of the value of entry
+func (cache *Cache) marshal(key any, entry *cacheEntry) ([]byte, error) {
+	if cache.obfuscator == nil {
+		data, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, newKeyError(key, ErrEncode, err)
+		}
+
+		return data, nil
+	}
+
+	res, err := cache.decode(key, entry, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Value.([]byte), nil
+}
+
+// swap stores value for key in the cache map, as sync.Map.Swap does, and
+// records it in the replication log, if any
+func (cache *Cache) swap(key any, value *cacheEntry) (any, bool) {
+	log := cache.replication
+	if log == nil {
+		return cache.cacheMap.Swap(cache.mapKey(key), value)
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	previous, loaded := cache.cacheMap.Swap(cache.mapKey(key), value)
+	log.append(EventAdd, key, value)
+
+	return previous, loaded
+}
+
+// compareAndSwap replaces entry with updated for key in the cache map, as
+// sync.Map.CompareAndSwap does, and records the replacement in the replication
+// log, if any: as an update when the version changed, an expiry change otherwise
+func (cache *Cache) compareAndSwap(key any, entry *cacheEntry, updated *cacheEntry) bool {
+	log := cache.replication
+	if log == nil {
+		return cache.cacheMap.CompareAndSwap(cache.mapKey(key), entry, updated)
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	if !cache.cacheMap.CompareAndSwap(cache.mapKey(key), entry, updated) {
+		return false
+	}
+
+	eventType := EventExpiry
+	if updated.version != entry.version {
+		eventType = EventUpdate
+	}
+
+	log.append(eventType, key, updated)
+
+	return true
+}
+
+// compareAndDelete deletes key from the cache map if it maps to entry, as
+// sync.Map.CompareAndDelete does, and records the removal in the replication
+// log, if any, as eventType
+func (cache *Cache) compareAndDelete(key any, entry any, eventType EventType) bool {
+	log := cache.replication
+	if log == nil {
+		return cache.cacheMap.CompareAndDelete(cache.mapKey(key), entry)
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	if !cache.cacheMap.CompareAndDelete(cache.mapKey(key), entry) {
+		return false
+	}
+
+	log.append(eventType, key, nil)
+
+	return true
+}
+
+// loadAndDelete deletes key from the cache map, as sync.Map.LoadAndDelete
+// does, and records the removal in the replication log, if any
+func (cache *Cache) loadAndDelete(key any) (any, bool) {
+	log := cache.replication
+	if log == nil {
+		return cache.cacheMap.LoadAndDelete(cache.mapKey(key))
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	previous, loaded := cache.cacheMap.LoadAndDelete(cache.mapKey(key))
+	if loaded {
+		log.append(EventRemove, key, nil)
+	}
+
+	return previous, loaded
+}
@@ -0,0 +1,221 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vijsourabh/caching"
+)
+
+type (
+	// FollowerParams configures NewFollower
+	FollowerParams struct {
+		// Cache receives the entries of the leader. Followers own its content:
+		// entries added by others are removed by the next snapshot. Required.
+		Cache *caching.Cache
+		// Addr is the TCP address of the leader. Required without Dial.
+		Addr string
+		// Dial connects to the leader instead of Addr, such as with tls.Dialer.
+		Dial func(ctx context.Context) (net.Conn, error)
+		// RetryInterval is the time waited before reconnecting to the leader.
+		// Defaults to one second.
+		RetryInterval time.Duration
+		// Timeout is the time without message from the leader after which the
+		// follower reconnects. It must exceed the HeartbeatInterval of the
+		// leader. Defaults to five seconds.
+		Timeout time.Duration
+	}
+
+	// Follower applies the changes of a leader to a cache. Values are stored
+	// as json.RawMessage: read them with GetBytes, or Get from an obfuscated
+	// cache. Keys are the default format of the keys of the leader.
+	Follower struct {
+		cache         *caching.Cache
+		dial          func(ctx context.Context) (net.Conn, error)
+		retryInterval time.Duration
+		timeout       time.Duration
+		lock          sync.Mutex
+		position      caching.LogPosition
+		leader        uint64 // sequence of the latest event of the leader
+		connected     atomic.Bool
+		connects      atomic.Uint64
+		snapshots     atomic.Uint64
+	}
+
+	// FollowerStats is a snapshot of the state of a Follower
+	FollowerStats struct {
+		// Position is the last event applied.
+		Position caching.LogPosition
+		// LeaderSequence is the sequence of the latest event of the leader, as
+		// of its last message.
+		LeaderSequence uint64
+		// Lag is the number of events of the leader not applied yet.
+		Lag uint64
+		// Connected is set while the follower is connected to the leader.
+		Connected bool
+		// Connects counts the connections made to the leader.
+		Connects uint64
+		// Snapshots counts the snapshots loaded.
+		Snapshots uint64
+	}
+)
+
+// NewFollower creates a follower of the leader at params.Addr, or dialed by
+// params.Dial. It connects once Run is called.
+func NewFollower(params *FollowerParams) (*Follower, error) {
+	if params.Cache == nil {
+		return nil, fmt.Errorf("%w: no cache", ErrInvalidParams)
+	}
+
+	follower := &Follower{
+		cache:         params.Cache,
+		dial:          params.Dial,
+		retryInterval: params.RetryInterval,
+		timeout:       params.Timeout,
+	}
+
+	if follower.dial == nil {
+		if params.Addr == "" {
+			return nil, fmt.Errorf("%w: no leader address", ErrInvalidParams)
+		}
+
+		var dialer net.Dialer
+
+		follower.dial = func(ctx context.Context) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", params.Addr)
+		}
+	}
+
+	if follower.retryInterval <= 0 {
+		follower.retryInterval = defaultRetryInterval
+	}
+
+	if follower.timeout <= 0 {
+		follower.timeout = defaultTimeout
+	}
+
+	return follower, nil
+}
+
+// Run follows the leader until ctx is done, reconnecting after every failure
+// and resuming from the last event applied. Returns the error of ctx, or
+// caching.ErrClosed once the cache has been closed.
+func (follower *Follower) Run(ctx context.Context) error {
+	for {
+		if err := follower.follow(ctx); errors.Is(err, caching.ErrClosed) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(follower.retryInterval):
+		}
+	}
+}
+
+// Stats returns the state of the follower
+func (follower *Follower) Stats() FollowerStats {
+	follower.lock.Lock()
+	defer follower.lock.Unlock()
+
+	stats := FollowerStats{
+		Position:       follower.position,
+		LeaderSequence: follower.leader,
+		Connected:      follower.connected.Load(),
+		Connects:       follower.connects.Load(),
+		Snapshots:      follower.snapshots.Load(),
+	}
+
+	if stats.LeaderSequence > stats.Position.Sequence {
+		stats.Lag = stats.LeaderSequence - stats.Position.Sequence
+	}
+
+	return stats
+}
+
+// follow connects to the leader and applies its messages until the connection
+// fails or ctx is done
+func (follower *Follower) follow(ctx context.Context) error {
+	conn, err := follower.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+
+	defer func() {
+		stop()
+		follower.connected.Store(false)
+
+		_ = conn.Close()
+	}()
+
+	follower.connects.Add(1)
+	follower.connected.Store(true)
+
+	follower.lock.Lock()
+	greeting := hello{Position: follower.position}
+	follower.lock.Unlock()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(follower.timeout))
+	if err = json.NewEncoder(conn).Encode(&greeting); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bufio.NewReaderSize(conn, bufferSize))
+
+	for {
+		var msg message
+
+		_ = conn.SetReadDeadline(time.Now().Add(follower.timeout))
+		if err = decoder.Decode(&msg); err != nil {
+			return err
+		}
+
+		if err = follower.apply(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// apply applies a message of the leader to the cache and moves the position.
+// The cache neither writes the changes through its store nor publishes them.
+func (follower *Follower) apply(msg *message) error {
+	follower.lock.Lock()
+	defer follower.lock.Unlock()
+
+	if msg.Snapshot != nil {
+		if err := follower.cache.LoadSnapshot(msg.Snapshot); err != nil {
+			return err
+		}
+
+		follower.position = msg.Snapshot.Position
+		follower.snapshots.Add(1)
+	}
+
+	for _, event := range msg.Events {
+		if event.Sequence != follower.position.Sequence+1 {
+			return fmt.Errorf("event %d received after event %d", event.Sequence, follower.position.Sequence)
+		}
+
+		if err := follower.cache.Apply(&event); err != nil {
+			return err
+		}
+
+		follower.position.Sequence = event.Sequence
+	}
+
+	follower.leader = msg.Sequence
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vijsourabh/caching"
+	"github.com/vijsourabh/caching/internal/netserver"
+)
+
+type (
+	// LeaderParams configures NewLeader
+	LeaderParams struct {
+		// Cache is the cache replicated. It must be created with replication
+		// enabled. Required.
+		Cache *caching.Cache
+		// HeartbeatInterval is the idle time after which a heartbeat is sent to
+		// the followers. Defaults to one second.
+		HeartbeatInterval time.Duration
+		// BatchSize is the largest number of events sent in a message. Defaults to 256.
+		BatchSize int
+	}
+
+	// Leader streams the changes of a cache to the followers connected to the
+	// listeners passed to Serve
+	Leader struct {
+		cache             *caching.Cache
+		heartbeatInterval time.Duration
+		batchSize         int
+		ctx               context.Context
+		cancel            context.CancelFunc
+		conns             *netserver.Server
+	}
+)
+
+// NewLeader creates a leader for params.Cache. The cache is left open by Close.
+func NewLeader(params *LeaderParams) (*Leader, error) {
+	if params.Cache == nil {
+		return nil, fmt.Errorf("%w: no cache", ErrInvalidParams)
+	}
+
+	if params.Cache.LogPosition().LogID == 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidParams, caching.ErrNotReplicated)
+	}
+
+	leader := &Leader{
+		cache:             params.Cache,
+		heartbeatInterval: params.HeartbeatInterval,
+		batchSize:         params.BatchSize,
+	}
+
+	if leader.heartbeatInterval <= 0 {
+		leader.heartbeatInterval = defaultHeartbeatInterval
+	}
+
+	if leader.batchSize <= 0 {
+		leader.batchSize = defaultBatchSize
+	}
+
+	leader.ctx, leader.cancel = context.WithCancel(context.Background())
+	leader.conns = netserver.New(func(conn net.Conn) {
+		_ = leader.serve(conn)
+	}, ErrClosed)
+
+	return leader, nil
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve
+func (leader *Leader) ListenAndServe(addr string) error {
+	return leader.conns.ListenAndServe(addr)
+}
+
+// Serve accepts connections on listener and streams the changes of the cache
+// to each follower on its own goroutine, until the listener fails or the
+// leader is closed. The listener is closed when Serve returns. Wrap it with
+// tls.NewListener to encrypt the stream.
+// Returns ErrClosed once the leader has been closed.
+func (leader *Leader) Serve(listener net.Listener) error {
+	return leader.conns.Serve(listener)
+}
+
+// Close stops the listeners, disconnects the followers and waits for their
+// streams to end. Returns ErrClosed if the leader has already been closed.
+func (leader *Leader) Close() error {
+	leader.cancel()
+
+	return leader.conns.Close()
+}
+
+// serve streams the changes of the cache to the follower connected on conn,
+// from the position of its hello, until it disconnects or the leader is closed
+func (leader *Leader) serve(conn net.Conn) error {
+	var greeting hello
+
+	_ = conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	if err := json.NewDecoder(conn).Decode(&greeting); err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriterSize(conn, bufferSize)
+	encoder := json.NewEncoder(writer)
+	position := greeting.Position
+
+	for {
+		var msg message
+
+		ctx, cancel := context.WithTimeout(leader.ctx, leader.heartbeatInterval)
+		events, err := leader.cache.Events(ctx, position, leader.batchSize)
+		cancel()
+
+		switch {
+		case errors.Is(err, caching.ErrLogPosition):
+			// A new follower, a follower of another cache, or one too far behind
+			if msg.Snapshot, err = leader.cache.Snapshot(); err != nil {
+				return err
+			}
+
+			position = msg.Snapshot.Position
+		case errors.Is(err, context.DeadlineExceeded):
+		case err != nil:
+			return err
+		default:
+			msg.Events = events
+			position.Sequence = events[len(events)-1].Sequence
+		}
+
+		msg.Sequence = leader.cache.LogPosition().Sequence
+
+		_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err = encoder.Encode(&msg); err != nil {
+			return err
+		}
+
+		if err = writer.Flush(); err != nil {
+			return err
+		}
+	}
+}
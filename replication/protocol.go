@@ -0,0 +1,53 @@
+// Package replication mirrors a leader cache into follower caches over
+// net.Conn. A follower bootstraps from a snapshot of the leader, then tails
+// its replication log; after a disconnection it resumes from the last event
+// it applied, or loads a new snapshot if the leader no longer holds it.
+//
+// The protocol is a stream of JSON values. The follower sends a hello with its
+// position, then the leader sends messages carrying a snapshot, events, or
+// neither as a heartbeat, each with the sequence of its latest event.
+package replication
+
+import (
+	"errors"
+	"time"
+
+	"github.com/vijsourabh/caching"
+)
+
+const (
+	defaultHeartbeatInterval = time.Second
+	defaultBatchSize         = 256
+	defaultRetryInterval     = time.Second
+	defaultTimeout           = 5 * time.Second
+	// handshakeTimeout bounds the time a leader waits for the hello of a follower
+	handshakeTimeout = 5 * time.Second
+	// writeTimeout bounds the time a leader waits for a follower to read a message
+	writeTimeout = 10 * time.Second
+	bufferSize   = 32 << 10
+)
+
+var (
+	// ErrInvalidParams is returned by NewLeader and NewFollower when the provided params are rejected
+	ErrInvalidParams = errors.New("invalid replication params")
+	// ErrClosed is returned by Serve once the leader has been closed, and by a second Close
+	ErrClosed = errors.New("replication leader is closed")
+)
+
+type (
+	// hello is sent by a follower when it connects
+	hello struct {
+		// Position is the last event the follower applied, the zero position
+		// for a new follower.
+		Position caching.LogPosition `json:"position"`
+	}
+
+	// message is sent by a leader: a snapshot to load in place of the
+	// entries of the follower, events to apply, or a heartbeat with neither
+	message struct {
+		Snapshot *caching.Snapshot `json:"snapshot,omitempty"`
+		Events   []caching.Event   `json:"events,omitempty"`
+		// Sequence is the sequence of the latest event of the leader.
+		Sequence uint64 `json:"sequence"`
+	}
+)
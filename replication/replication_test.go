@@ -0,0 +1,420 @@
+package replication
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vijsourabh/caching"
+)
+
+const waitFor = 5 * time.Second
+
+// newCache creates a cache with params, closed at the end of the test
+func newCache(test *testing.T, params *caching.CreateCacheParams) *caching.Cache {
+	cache := caching.NewCache(params)
+	test.Cleanup(func() {
+		_ = cache.Close()
+	})
+
+	return cache
+}
+
+// startLeader serves cache on listener, closed at the end of the test
+func startLeader(test *testing.T, cache *caching.Cache, listener net.Listener) *Leader {
+	leader, err := NewLeader(&LeaderParams{
+		Cache:             cache,
+		HeartbeatInterval: 20 * time.Millisecond,
+		BatchSize:         8,
+	})
+	require.NoError(test, err)
+
+	go func() {
+		_ = leader.Serve(listener)
+	}()
+
+	test.Cleanup(func() {
+		_ = leader.Close()
+	})
+
+	return leader
+}
+
+// startFollower follows the leader dialed by dial into cache until the end of the test
+func startFollower(test *testing.T, cache *caching.Cache, dial func(ctx context.Context) (net.Conn, error)) *Follower {
+	follower, err := NewFollower(&FollowerParams{
+		Cache:         cache,
+		Dial:          dial,
+		RetryInterval: 10 * time.Millisecond,
+		Timeout:       time.Second,
+	})
+	require.NoError(test, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_ = follower.Run(ctx)
+	}()
+
+	test.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return follower
+}
+
+// switchboard dials the leader listening on its current address
+type switchboard struct {
+	lock sync.Mutex
+	addr string
+}
+
+func (board *switchboard) set(addr string) {
+	board.lock.Lock()
+	defer board.lock.Unlock()
+
+	board.addr = addr
+}
+
+func (board *switchboard) dial(ctx context.Context) (net.Conn, error) {
+	board.lock.Lock()
+	addr := board.addr
+	board.lock.Unlock()
+
+	var dialer net.Dialer
+
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// listen returns a listener on a free loopback port, dialed by board
+func (board *switchboard) listen(test *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(test, err)
+
+	board.set(listener.Addr().String())
+
+	return listener
+}
+
+// requireMirror waits for follower to apply every event of leader, then
+// requires cache to hold the values of want
+func requireMirror(test *testing.T, leader *caching.Cache, follower *Follower, cache *caching.Cache, want map[string]string) {
+	require.Eventually(test, func() bool {
+		stats := follower.Stats()
+
+		return stats.Position == leader.LogPosition() && stats.Lag == 0
+	}, waitFor, time.Millisecond)
+
+	keys := slices.Sorted(func(yield func(string) bool) {
+		for key := range cache.Keys() {
+			if !yield(key.(string)) {
+				return
+			}
+		}
+	})
+
+	require.Equal(test, slices.Sorted(func(yield func(string) bool) {
+		for key := range want {
+			if !yield(key) {
+				return
+			}
+		}
+	}), keys)
+
+	for key, value := range want {
+		data, err := cache.GetBytes(key, nil)
+		require.NoError(test, err)
+		require.JSONEq(test, value, string(data), key)
+	}
+}
+
+// recordingInvalidator is an Invalidator recording the published keys
+type recordingInvalidator struct {
+	lock      sync.Mutex
+	published []string
+}
+
+func (invalidator *recordingInvalidator) Publish(_ context.Context, keys ...string) error {
+	invalidator.lock.Lock()
+	defer invalidator.lock.Unlock()
+
+	invalidator.published = append(invalidator.published, keys...)
+
+	return nil
+}
+
+func (invalidator *recordingInvalidator) Subscribe(func(keys []string)) {}
+
+func TestService_Replication(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("followers bootstrap from a snapshot then tail the log", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		source := newCache(test, &caching.CreateCacheParams{Replication: caching.ReplicationParams{Enabled: true}})
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "a", Value: 1}))
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: 2, Value: map[string]any{"b": true}, Tags: []string{"tag"}}))
+
+		board := &switchboard{}
+		startLeader(test, source, board.listen(test))
+
+		mirror := newCache(test, &caching.CreateCacheParams{IsCacheObfuscated: true})
+		// Entries of the follower cache the leader doesn't have are removed.
+		require.NoError(test, mirror.Add(&caching.AddCacheParams{Key: "stale", Value: 0}))
+
+		follower := startFollower(test, mirror, board.dial)
+		requireMirror(test, source, follower, mirror, map[string]string{"a": "1", "2": `{"b":true}`})
+
+		stats := follower.Stats()
+		require.True(test, stats.Connected)
+		require.Equal(test, uint64(1), stats.Snapshots)
+		require.Equal(test, uint64(1), stats.Connects)
+
+		var value map[string]bool
+		require.NoError(test, mirror.Get("2", &value))
+		require.True(test, value["b"])
+
+		info, found := mirror.Info("2")
+		require.True(test, found)
+		require.Equal(test, []string{"tag"}, info.Tags)
+
+		// More changes than a batch holds, of every kind
+		for i := range 20 {
+			require.NoError(test, source.Add(&caching.AddCacheParams{Key: "a", Value: i}))
+		}
+
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "c", Value: "x", Expiry: time.Hour}))
+		require.NoError(test, source.Update(&caching.UpdateCacheParams{Key: "c", Value: "y"}))
+		require.NoError(test, source.Remove(2))
+		require.NoError(test, source.InvalidateTag("none"))
+
+		requireMirror(test, source, follower, mirror, map[string]string{"a": "19", "c": `"y"`})
+
+		ttl, found := mirror.TTL("c")
+		require.True(test, found)
+		require.InDelta(test, time.Hour, ttl, float64(time.Minute))
+
+		ttl, _ = mirror.TTL("a")
+		require.Negative(test, ttl)
+
+		require.NoError(test, source.Clear())
+		requireMirror(test, source, follower, mirror, map[string]string{})
+		require.Equal(test, uint64(1), follower.Stats().Snapshots)
+	})
+
+	test.Run("followers neither write through nor publish the changes", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		source := newCache(test, &caching.CreateCacheParams{Replication: caching.ReplicationParams{Enabled: true}})
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "a", Value: 1}))
+
+		board := &switchboard{}
+		startLeader(test, source, board.listen(test))
+
+		store := caching.NewMemoryStore()
+		invalidator := &recordingInvalidator{}
+		mirror := newCache(test, &caching.CreateCacheParams{Store: store, Invalidator: invalidator})
+
+		follower := startFollower(test, mirror, board.dial)
+		requireMirror(test, source, follower, mirror, map[string]string{"a": "1"})
+
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "b", Value: 2}))
+		require.NoError(test, source.Remove("a"))
+		requireMirror(test, source, follower, mirror, map[string]string{"b": "2"})
+
+		require.Zero(test, store.Len())
+
+		invalidator.lock.Lock()
+		defer invalidator.lock.Unlock()
+
+		require.Empty(test, invalidator.published)
+	})
+
+	test.Run("values that can't be encoded are replicated as removals", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		source := newCache(test, &caching.CreateCacheParams{Replication: caching.ReplicationParams{Enabled: true}})
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "a", Value: 1}))
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "channel", Value: make(chan int)}))
+
+		board := &switchboard{}
+		startLeader(test, source, board.listen(test))
+
+		mirror := newCache(test, &caching.CreateCacheParams{})
+		follower := startFollower(test, mirror, board.dial)
+		requireMirror(test, source, follower, mirror, map[string]string{"a": "1"})
+
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "a", Value: func() {}}))
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "b", Value: 2}))
+		requireMirror(test, source, follower, mirror, map[string]string{"b": "2"})
+		require.Equal(test, uint64(1), follower.Stats().Snapshots)
+	})
+
+	test.Run("followers resume after a reconnection", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		source := newCache(test, &caching.CreateCacheParams{Replication: caching.ReplicationParams{Enabled: true}})
+		board := &switchboard{}
+		leader := startLeader(test, source, board.listen(test))
+
+		mirror := newCache(test, &caching.CreateCacheParams{})
+		follower := startFollower(test, mirror, board.dial)
+
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "a", Value: 1}))
+		requireMirror(test, source, follower, mirror, map[string]string{"a": "1"})
+
+		// The leader goes away while the cache changes, and comes back elsewhere.
+		require.NoError(test, leader.Close())
+		require.Eventually(test, func() bool {
+			return !follower.Stats().Connected
+		}, waitFor, time.Millisecond)
+
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "b", Value: 2}))
+		require.NoError(test, source.Remove("a"))
+		require.Equal(test, uint64(1), follower.Stats().Position.Sequence)
+
+		startLeader(test, source, board.listen(test))
+		requireMirror(test, source, follower, mirror, map[string]string{"b": "2"})
+
+		stats := follower.Stats()
+		require.Equal(test, uint64(1), stats.Snapshots)
+		require.GreaterOrEqual(test, stats.Connects, uint64(2))
+	})
+
+	test.Run("followers load a new snapshot when the log moved on", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		source := newCache(test, &caching.CreateCacheParams{
+			Replication: caching.ReplicationParams{Enabled: true, LogSize: 4},
+		})
+		board := &switchboard{}
+		leader := startLeader(test, source, board.listen(test))
+
+		mirror := newCache(test, &caching.CreateCacheParams{})
+		follower := startFollower(test, mirror, board.dial)
+
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "a", Value: 1}))
+		requireMirror(test, source, follower, mirror, map[string]string{"a": "1"})
+
+		require.NoError(test, leader.Close())
+		require.Eventually(test, func() bool {
+			return !follower.Stats().Connected
+		}, waitFor, time.Millisecond)
+
+		for i := range 10 {
+			require.NoError(test, source.Add(&caching.AddCacheParams{Key: "b", Value: i}))
+		}
+
+		leader = startLeader(test, source, board.listen(test))
+		requireMirror(test, source, follower, mirror, map[string]string{"a": "1", "b": "9"})
+		require.Equal(test, uint64(2), follower.Stats().Snapshots)
+
+		// A new leader cache has another log: its content replaces the mirror.
+		other := newCache(test, &caching.CreateCacheParams{Replication: caching.ReplicationParams{Enabled: true}})
+		require.NoError(test, other.Add(&caching.AddCacheParams{Key: "c", Value: 3}))
+
+		startLeader(test, other, board.listen(test))
+		require.NoError(test, leader.Close())
+		requireMirror(test, other, follower, mirror, map[string]string{"c": "3"})
+		require.Equal(test, uint64(3), follower.Stats().Snapshots)
+	})
+
+	test.Run("the lag counts the events not applied yet", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		follower, err := NewFollower(&FollowerParams{Cache: newCache(test, &caching.CreateCacheParams{}), Addr: "127.0.0.1:1"})
+		require.NoError(test, err)
+
+		// The follower has applied the snapshot at sequence 1, the leader is at 3.
+		require.NoError(test, follower.apply(&message{
+			Snapshot: &caching.Snapshot{Position: caching.LogPosition{LogID: 1, Sequence: 1}},
+			Sequence: 3,
+		}))
+		require.Equal(test, uint64(2), follower.Stats().Lag)
+
+		require.NoError(test, follower.apply(&message{
+			Events:   []caching.Event{{Sequence: 2, Type: caching.EventRemove, Key: "a"}},
+			Sequence: 3,
+		}))
+		require.Equal(test, uint64(1), follower.Stats().Lag)
+
+		// Events out of sequence are rejected.
+		require.Error(test, follower.apply(&message{
+			Events: []caching.Event{{Sequence: 4, Type: caching.EventRemove, Key: "a"}},
+		}))
+	})
+
+	test.Run("Close stops the leader and Run the follower", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		source := newCache(test, &caching.CreateCacheParams{Replication: caching.ReplicationParams{Enabled: true}})
+		leader, err := NewLeader(&LeaderParams{Cache: source})
+		require.NoError(test, err)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(test, err)
+
+		served := make(chan error, 1)
+
+		go func() {
+			served <- leader.Serve(listener)
+		}()
+
+		mirror := caching.NewCache(&caching.CreateCacheParams{})
+		follower, err := NewFollower(&FollowerParams{Cache: mirror, Addr: listener.Addr().String()})
+		require.NoError(test, err)
+
+		ran := make(chan error, 1)
+
+		go func() {
+			ran <- follower.Run(context.Background())
+		}()
+
+		require.Eventually(test, func() bool {
+			return follower.Stats().Snapshots == 1
+		}, waitFor, time.Millisecond)
+
+		require.NoError(test, mirror.Close())
+		require.NoError(test, source.Add(&caching.AddCacheParams{Key: "a", Value: 1}))
+		require.ErrorIs(test, <-ran, caching.ErrClosed)
+
+		require.NoError(test, leader.Close())
+		require.ErrorIs(test, <-served, ErrClosed)
+		require.ErrorIs(test, leader.Close(), ErrClosed)
+		require.ErrorIs(test, leader.Serve(listener), ErrClosed)
+	})
+
+	test.Run("leaders need a replicated cache and followers a leader", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache := newCache(test, &caching.CreateCacheParams{})
+
+		for _, params := range []*LeaderParams{{}, {Cache: cache}} {
+			_, err := NewLeader(params)
+			require.ErrorIs(test, err, ErrInvalidParams)
+		}
+
+		for _, params := range []*FollowerParams{{Addr: "127.0.0.1:1"}, {Cache: cache}} {
+			_, err := NewFollower(params)
+			require.ErrorIs(test, err, ErrInvalidParams)
+		}
+	})
+}
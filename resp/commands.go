@@ -0,0 +1,863 @@
+package resp
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vijsourabh/caching"
+	"github.com/vijsourabh/caching/internal/entry"
+)
+
+// version is the Redis version reported by HELLO and INFO, which clients use
+// to pick the commands they send
+const version = "7.0.0"
+
+const (
+	errSyntax      = "ERR syntax error"
+	errNotInteger  = "ERR value is not an integer or out of range"
+	errOverflow    = "ERR increment or decrement would overflow"
+	defaultScanLen = 10
+)
+
+type (
+	// client is the state of a connection
+	client struct {
+		server *Server
+		cache  caching.Cacher
+		id     int64
+		reader requestReader
+		writer replyWriter
+		quit   bool // set by QUIT, once the reply is written the connection is closed
+	}
+
+	// command is an entry of the command table
+	command struct {
+		// arity is the number of arguments, including the command name.
+		// A negative arity is the opposite of the minimum number of arguments.
+		arity int
+		run   func(client *client, args [][]byte)
+	}
+)
+
+// commands are the supported commands, by lowercase name
+var commands = map[string]command{
+	"command":  {-1, (*client).command},
+	"dbsize":   {1, (*client).dbSize},
+	"decr":     {2, (*client).decr},
+	"decrby":   {3, (*client).decrBy},
+	"del":      {-2, (*client).del},
+	"echo":     {2, (*client).echo},
+	"exists":   {-2, (*client).exists},
+	"expire":   {-3, (*client).expire},
+	"flushall": {-1, (*client).flush},
+	"flushdb":  {-1, (*client).flush},
+	"get":      {2, (*client).get},
+	"hello":    {-1, (*client).hello},
+	"incr":     {2, (*client).incr},
+	"incrby":   {3, (*client).incrBy},
+	"info":     {-1, (*client).info},
+	"keys":     {2, (*client).keys},
+	"mget":     {-2, (*client).mget},
+	"mset":     {-3, (*client).mset},
+	"persist":  {2, (*client).persist},
+	"pexpire":  {-3, (*client).pexpire},
+	"ping":     {-1, (*client).ping},
+	"pttl":     {2, (*client).pttl},
+	"quit":     {1, (*client).quitCommand},
+	"scan":     {-2, (*client).scan},
+	"select":   {2, (*client).selectDB},
+	"set":      {-3, (*client).set},
+	"ttl":      {2, (*client).ttl},
+}
+
+// execute runs the command of args and writes its reply
+func (client *client) execute(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+
+	cmd, found := commands[name]
+	if !found {
+		client.writer.error(fmt.Sprintf("ERR unknown command '%s', with args beginning with: %s", args[0], quoteArgs(args[1:])))
+
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		client.writer.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+
+		return
+	}
+
+	cmd.run(client, args)
+}
+
+// value returns the data cached for key, see entry.Load.
+// Returns false if the key doesn't exist or has expired.
+func (client *client) value(key string) ([]byte, bool, error) {
+	value, found, err := entry.Load(client.cache, key)
+
+	return value.Data, found, err
+}
+
+// has reports whether key holds a live entry
+func (client *client) has(key string) bool {
+	_, found := client.cache.TTL(key)
+
+	return found
+}
+
+// failed writes err, returned by the cache, as an error reply
+func (client *client) failed(err error) {
+	client.writer.error("ERR " + err.Error())
+}
+
+func (client *client) get(args [][]byte) {
+	value, found, err := client.value(string(args[1]))
+	switch {
+	case err != nil:
+		client.failed(err)
+	case !found:
+		client.writer.null()
+	default:
+		client.writer.bulk(value)
+	}
+}
+
+// set implements SET key value [NX | XX] [GET] [EX seconds | PX milliseconds].
+// Without EX or PX the entry gets the expiry of the cache.
+func (client *client) set(args [][]byte) {
+	var (
+		expiry          time.Duration
+		nx, xx, withGet bool
+	)
+
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			withGet = true
+		case "EX", "PX":
+			if expiry != 0 || i+1 == len(args) {
+				client.writer.error(errSyntax)
+
+				return
+			}
+
+			i++
+
+			var ok bool
+			if expiry, ok = parseExpiry(args[i], option == "EX"); !ok || expiry <= 0 {
+				client.writer.error("ERR invalid expire time in 'set' command")
+
+				return
+			}
+		default:
+			client.writer.error(errSyntax)
+
+			return
+		}
+	}
+
+	if nx && xx {
+		client.writer.error(errSyntax)
+
+		return
+	}
+
+	key := string(args[1])
+
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	var (
+		previous []byte
+		found    bool
+	)
+
+	if withGet {
+		var err error
+		if previous, found, err = client.value(key); err != nil {
+			client.failed(err)
+
+			return
+		}
+	} else if nx || xx {
+		found = client.has(key)
+	}
+
+	if (nx && found) || (xx && !found) {
+		client.previous(withGet, previous, found)
+
+		return
+	}
+
+	err := client.cache.Add(&caching.AddCacheParams{
+		Key:    key,
+		Value:  entry.Value{Data: args[2]},
+		Expiry: expiry,
+	})
+	if err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	if withGet {
+		client.previous(true, previous, found)
+
+		return
+	}
+
+	client.writer.simple("OK")
+}
+
+// previous writes the reply of a SET that wasn't applied, or that was applied with GET
+func (client *client) previous(withGet bool, previous []byte, found bool) {
+	if withGet && found {
+		client.writer.bulk(previous)
+
+		return
+	}
+
+	client.writer.null()
+}
+
+func (client *client) mget(args [][]byte) {
+	client.writer.array(len(args) - 1)
+
+	for _, key := range args[1:] {
+		value, found, err := client.value(string(key))
+		if err != nil || !found {
+			client.writer.null()
+
+			continue
+		}
+
+		client.writer.bulk(value)
+	}
+}
+
+func (client *client) mset(args [][]byte) {
+	if len(args)%2 == 0 {
+		client.writer.error("ERR wrong number of arguments for 'mset' command")
+
+		return
+	}
+
+	params := make([]*caching.AddCacheParams, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		params = append(params, &caching.AddCacheParams{
+			Key:   string(args[i]),
+			Value: entry.Value{Data: args[i+1]},
+		})
+	}
+
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	if err := client.cache.AddMany(params...); err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	client.writer.simple("OK")
+}
+
+// del removes the keys and replies with the number of keys that existed
+func (client *client) del(args [][]byte) {
+	seen := make(map[string]bool, len(args)-1)
+	keys := make([]any, 0, len(args)-1)
+
+	for _, key := range args[1:] {
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			keys = append(keys, string(key))
+		}
+	}
+
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	var removed int64
+
+	for _, key := range keys {
+		if client.has(key.(string)) {
+			removed++
+		}
+	}
+
+	if err := client.cache.RemoveMany(keys...); err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	client.writer.integer(removed)
+}
+
+// exists replies with the number of keys that exist, counting repeated keys as many times
+func (client *client) exists(args [][]byte) {
+	var count int64
+
+	for _, key := range args[1:] {
+		if client.has(string(key)) {
+			count++
+		}
+	}
+
+	client.writer.integer(count)
+}
+
+func (client *client) ttl(args [][]byte) {
+	client.remaining(args, time.Second)
+}
+
+func (client *client) pttl(args [][]byte) {
+	client.remaining(args, time.Millisecond)
+}
+
+// remaining replies with the time left before the key expires, in unit:
+// -2 if the key doesn't exist, and -1 if it never expires
+func (client *client) remaining(args [][]byte, unit time.Duration) {
+	ttl, found := client.cache.TTL(string(args[1]))
+	switch {
+	case !found:
+		client.writer.integer(-2)
+	case ttl < 0:
+		client.writer.integer(-1)
+	default:
+		client.writer.integer(int64((ttl + unit/2) / unit))
+	}
+}
+
+func (client *client) expire(args [][]byte) {
+	client.setExpiry(args, true)
+}
+
+func (client *client) pexpire(args [][]byte) {
+	client.setExpiry(args, false)
+}
+
+// setExpiry implements EXPIRE and PEXPIRE key timeout [NX | XX | GT | LT].
+// A non-positive timeout removes the key. Replies with 1 if the expiry was
+// set, and 0 if the key doesn't exist or the condition isn't met.
+func (client *client) setExpiry(args [][]byte, seconds bool) {
+	if len(args) > 4 {
+		client.writer.error(errSyntax)
+
+		return
+	}
+
+	if _, err := strconv.ParseInt(string(args[2]), 10, 64); err != nil {
+		client.writer.error(errNotInteger)
+
+		return
+	}
+
+	d, ok := parseExpiry(args[2], seconds)
+	if !ok {
+		client.writer.error(fmt.Sprintf("ERR invalid expire time in '%s' command", strings.ToLower(string(args[0]))))
+
+		return
+	}
+
+	key := string(args[1])
+
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	ttl, found := client.cache.TTL(key)
+	if !found {
+		client.writer.integer(0)
+
+		return
+	}
+
+	if len(args) == 4 {
+		// A key without expiry has an infinite TTL.
+		persistent := ttl < 0
+
+		var apply bool
+
+		switch strings.ToUpper(string(args[3])) {
+		case "NX":
+			apply = persistent
+		case "XX":
+			apply = !persistent
+		case "GT":
+			apply = !persistent && d > ttl
+		case "LT":
+			apply = persistent || d < ttl
+		default:
+			client.writer.error(errSyntax)
+
+			return
+		}
+
+		if !apply {
+			client.writer.integer(0)
+
+			return
+		}
+	}
+
+	err := client.cache.Expire(key, d)
+	switch {
+	case errors.Is(err, caching.ErrNotFound) || errors.Is(err, caching.ErrExpired):
+		client.writer.integer(0)
+	case err != nil:
+		client.failed(err)
+	default:
+		client.writer.integer(1)
+	}
+}
+
+// persist removes the expiry of the key. Replies with 1 if the key had one, and 0 otherwise.
+func (client *client) persist(args [][]byte) {
+	key := string(args[1])
+
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	if ttl, found := client.cache.TTL(key); !found || ttl < 0 {
+		client.writer.integer(0)
+
+		return
+	}
+
+	err := client.cache.Persist(key)
+	switch {
+	case errors.Is(err, caching.ErrNotFound) || errors.Is(err, caching.ErrExpired):
+		client.writer.integer(0)
+	case err != nil:
+		client.failed(err)
+	default:
+		client.writer.integer(1)
+	}
+}
+
+func (client *client) incr(args [][]byte) {
+	client.incrementBy(string(args[1]), 1)
+}
+
+func (client *client) decr(args [][]byte) {
+	client.incrementBy(string(args[1]), -1)
+}
+
+func (client *client) incrBy(args [][]byte) {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		client.writer.error(errNotInteger)
+
+		return
+	}
+
+	client.incrementBy(string(args[1]), delta)
+}
+
+func (client *client) decrBy(args [][]byte) {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil || delta == math.MinInt64 {
+		client.writer.error(errNotInteger)
+
+		return
+	}
+
+	client.incrementBy(string(args[1]), -delta)
+}
+
+// incrementBy adds delta to the integer held by key, a missing key holding 0,
+// and replies with the result. An existing entry keeps its expiry and flags.
+func (client *client) incrementBy(key string, delta int64) {
+	client.cache.Lock()
+	defer client.cache.Unlock()
+
+	value, found, err := entry.Load(client.cache, key)
+	if err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	var n int64
+	if found {
+		if n, err = strconv.ParseInt(string(value.Data), 10, 64); err != nil {
+			client.writer.error(errNotInteger)
+
+			return
+		}
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		client.writer.error(errOverflow)
+
+		return
+	}
+
+	n += delta
+	value.Data = strconv.AppendInt(nil, n, 10)
+
+	if found {
+		err = client.cache.Update(&caching.UpdateCacheParams{Key: key, Value: value})
+	}
+
+	// The entry may have expired since it was read.
+	if !found || errors.Is(err, caching.ErrNotFound) || errors.Is(err, caching.ErrExpired) {
+		err = client.cache.Add(&caching.AddCacheParams{Key: key, Value: value})
+	}
+
+	if err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	client.writer.integer(n)
+}
+
+// keys replies with the keys matching the pattern, sorted
+func (client *client) keys(args [][]byte) {
+	pattern := string(args[1])
+
+	var keys []string
+
+	for key := range client.cache.Keys() {
+		if key, ok := key.(string); ok && match(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+	client.writer.array(len(keys))
+
+	for _, key := range keys {
+		client.writer.bulkString(key)
+	}
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count] [TYPE type].
+// Keys are returned by increasing hash, and the cursor is the hash to resume
+// from, so every key present for the whole iteration is returned, and only
+// keys added or removed during the iteration may be missed.
+func (client *client) scan(args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		client.writer.error("ERR invalid cursor")
+
+		return
+	}
+
+	pattern, count, typed := "*", defaultScanLen, true
+
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			client.writer.error(errSyntax)
+
+			return
+		}
+
+		value := string(args[i+1])
+
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = value
+		case "COUNT":
+			if count, err = strconv.Atoi(value); err != nil {
+				client.writer.error(errNotInteger)
+
+				return
+			}
+
+			if count < 1 {
+				client.writer.error(errSyntax)
+
+				return
+			}
+		case "TYPE":
+			// Every value is a string.
+			typed = strings.EqualFold(value, "string")
+		default:
+			client.writer.error(errSyntax)
+
+			return
+		}
+	}
+
+	type hashedKey struct {
+		hash uint64
+		key  string
+	}
+
+	var found []hashedKey
+
+	for key := range client.cache.Keys() {
+		key, ok := key.(string)
+		if !ok || !typed || !match(pattern, key) {
+			continue
+		}
+
+		if hash := hashKey(key); hash >= cursor {
+			found = append(found, hashedKey{hash, key})
+		}
+	}
+
+	slices.SortFunc(found, func(a, b hashedKey) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.key, b.key))
+	})
+
+	// Keys sharing the hash of the last key returned are returned with it.
+	end := min(count, len(found))
+	for end < len(found) && found[end].hash == found[end-1].hash {
+		end++
+	}
+
+	next := uint64(0)
+	if end < len(found) {
+		next = found[end-1].hash + 1
+	}
+
+	client.writer.array(2)
+	client.writer.bulkString(strconv.FormatUint(next, 10))
+	client.writer.array(end)
+
+	for _, key := range found[:end] {
+		client.writer.bulkString(key.key)
+	}
+}
+
+// hashKey returns the position of key in the iteration order of SCAN
+func hashKey(key string) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+
+	return hash.Sum64()
+}
+
+// flush implements FLUSHDB and FLUSHALL [ASYNC | SYNC], which both clear the cache
+func (client *client) flush(args [][]byte) {
+	if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(string(args[1]), "ASYNC") && !strings.EqualFold(string(args[1]), "SYNC")) {
+		client.writer.error(errSyntax)
+
+		return
+	}
+
+	if err := client.cache.Clear(); err != nil {
+		client.failed(err)
+
+		return
+	}
+
+	client.writer.simple("OK")
+}
+
+func (client *client) dbSize([][]byte) {
+	client.writer.integer(int64(client.cache.Len()))
+}
+
+// info implements INFO [section ...] with the server, clients, stats and keyspace sections
+func (client *client) info(args [][]byte) {
+	sections := map[string]bool{}
+	for _, section := range args[1:] {
+		sections[strings.ToLower(string(section))] = true
+	}
+
+	all := len(sections) == 0 || sections["all"] || sections["default"] || sections["everything"]
+	server := client.server
+
+	var text strings.Builder
+
+	section := func(name string, fields ...string) {
+		if !all && !sections[strings.ToLower(name)] {
+			return
+		}
+
+		if text.Len() > 0 {
+			text.WriteString("\r\n")
+		}
+
+		fmt.Fprintf(&text, "# %s\r\n", name)
+
+		for _, field := range fields {
+			text.WriteString(field + "\r\n")
+		}
+	}
+
+	section("Server",
+		"redis_version:"+version,
+		"redis_mode:standalone",
+		fmt.Sprintf("process_id:%d", os.Getpid()),
+		fmt.Sprintf("uptime_in_seconds:%d", int64(time.Since(server.started).Seconds())),
+	)
+	section("Clients",
+		fmt.Sprintf("connected_clients:%d", server.stats.connected.Load()),
+	)
+
+	stats := client.cache.Stats()
+	section("Stats",
+		fmt.Sprintf("total_connections_received:%d", server.stats.accepted.Load()),
+		fmt.Sprintf("total_commands_processed:%d", server.stats.commands.Load()),
+		fmt.Sprintf("keyspace_hits:%d", stats.Hits),
+		fmt.Sprintf("keyspace_misses:%d", stats.Misses),
+		fmt.Sprintf("evicted_keys:%d", stats.Evictions),
+		fmt.Sprintf("cache_adds:%d", stats.Adds),
+	)
+
+	var keyspace []string
+	if stats.Len > 0 {
+		keyspace = append(keyspace, fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=0", stats.Len, client.expiring()))
+	}
+
+	section("Keyspace", keyspace...)
+
+	client.writer.bulkString(text.String())
+}
+
+// expiring returns the number of live keys with an expiry
+func (client *client) expiring() int {
+	var count int
+
+	for key := range client.cache.Keys() {
+		if ttl, found := client.cache.TTL(key); found && ttl >= 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+// hello implements HELLO [protover [AUTH username password] [SETNAME clientname]],
+// switching the connection to RESP2 or RESP3
+func (client *client) hello(args [][]byte) {
+	protocol := client.writer.protocol
+
+	if len(args) > 1 {
+		requested, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			client.writer.error("ERR Protocol version is not an integer or out of range")
+
+			return
+		}
+
+		if requested != 2 && requested != 3 {
+			client.writer.error("NOPROTO unsupported protocol version")
+
+			return
+		}
+
+		protocol = requested
+	}
+
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); {
+		case option == "AUTH" && i+2 < len(args):
+			client.writer.error("ERR AUTH called without any password configured for the default user")
+
+			return
+		case option == "SETNAME" && i+1 < len(args):
+			i++
+		default:
+			client.writer.error(errSyntax)
+
+			return
+		}
+	}
+
+	client.writer.protocol = protocol
+
+	client.writer.mapHeader(7)
+	client.writer.bulkString("server")
+	client.writer.bulkString("redis")
+	client.writer.bulkString("version")
+	client.writer.bulkString(version)
+	client.writer.bulkString("proto")
+	client.writer.integer(int64(protocol))
+	client.writer.bulkString("id")
+	client.writer.integer(client.id)
+	client.writer.bulkString("mode")
+	client.writer.bulkString("standalone")
+	client.writer.bulkString("role")
+	client.writer.bulkString("master")
+	client.writer.bulkString("modules")
+	client.writer.array(0)
+}
+
+func (client *client) ping(args [][]byte) {
+	switch len(args) {
+	case 1:
+		client.writer.simple("PONG")
+	case 2:
+		client.writer.bulk(args[1])
+	default:
+		client.writer.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (client *client) echo(args [][]byte) {
+	client.writer.bulk(args[1])
+}
+
+// selectDB only accepts the database 0, the cache
+func (client *client) selectDB(args [][]byte) {
+	index, err := strconv.Atoi(string(args[1]))
+	switch {
+	case err != nil:
+		client.writer.error(errNotInteger)
+	case index != 0:
+		client.writer.error("ERR DB index is out of range")
+	default:
+		client.writer.simple("OK")
+	}
+}
+
+// command replies to COMMAND, and its subcommands, with an empty array:
+// clients then fall back on their own knowledge of the commands
+func (client *client) command([][]byte) {
+	client.writer.array(0)
+}
+
+func (client *client) quitCommand([][]byte) {
+	client.quit = true
+	client.writer.simple("OK")
+}
+
+// parseExpiry parses arg, a number of seconds or milliseconds. Returns false
+// if arg isn't an integer or the duration overflows.
+func parseExpiry(arg []byte, seconds bool) (time.Duration, bool) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	unit := time.Millisecond
+	if seconds {
+		unit = time.Second
+	}
+
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, false
+	}
+
+	return time.Duration(n) * unit, true
+}
+
+// quoteArgs formats the arguments of an unknown command for its error reply
+func quoteArgs(args [][]byte) string {
+	var quoted strings.Builder
+
+	for _, arg := range args {
+		fmt.Fprintf(&quoted, "'%s' ", arg)
+	}
+
+	return quoted.String()
+}
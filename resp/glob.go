@@ -0,0 +1,89 @@
+package resp
+
+// match reports whether key matches the glob-style pattern of KEYS and SCAN:
+// * matches any sequence of bytes, ? any byte, [abc], [a-z] and [^abc] a set
+// of bytes, and \ escapes the byte that follows
+func match(pattern string, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+
+			if len(pattern) == 1 {
+				return true
+			}
+
+			for i := range len(key) + 1 {
+				if match(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+
+			pattern, key = pattern[1:], key[1:]
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+
+			matched, rest := matchSet(pattern[1:], key[0])
+			if !matched {
+				return false
+			}
+
+			pattern, key = rest, key[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+
+			pattern, key = pattern[1:], key[1:]
+		}
+	}
+
+	return len(key) == 0
+}
+
+// matchSet reports whether c belongs to set, the bytes following [ in a
+// pattern, and returns the rest of the pattern after the closing ]. An
+// unterminated set extends to the end of the pattern.
+func matchSet(set string, c byte) (bool, string) {
+	negated := len(set) > 0 && set[0] == '^'
+	if negated {
+		set = set[1:]
+	}
+
+	var matched bool
+
+	for len(set) > 0 && set[0] != ']' {
+		switch {
+		case set[0] == '\\' && len(set) > 1:
+			matched = matched || set[1] == c
+			set = set[2:]
+		case len(set) > 2 && set[1] == '-' && set[2] != ']':
+			low, high := min(set[0], set[2]), max(set[0], set[2])
+			matched = matched || (low <= c && c <= high)
+			set = set[3:]
+		default:
+			matched = matched || set[0] == c
+			set = set[1:]
+		}
+	}
+
+	if len(set) > 0 {
+		set = set[1:]
+	}
+
+	return matched != negated, set
+}
@@ -0,0 +1,187 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxBulkSize is the size of the largest bulk string accepted in a request
+	maxBulkSize = 512 << 20
+	// maxArgs is the largest number of arguments accepted in a request
+	maxArgs = 1 << 20
+	// bufferSize is the size of the read and write buffers of a connection,
+	// and of the longest inline command
+	bufferSize = 64 << 10
+	// preallocatedArgs bounds the arguments allocated before they are
+	// received, whatever the length announced by the client
+	preallocatedArgs = 1 << 10
+)
+
+var (
+	errProtocol = errors.New("Protocol error")
+
+	// lineBreaks replaces the line breaks that would end a reply early
+	lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+)
+
+type (
+	// requestReader parses the commands sent by a client: arrays of bulk
+	// strings, or inline commands whose arguments are separated by spaces
+	requestReader struct {
+		*bufio.Reader
+	}
+
+	// replyWriter encodes replies in the protocol version negotiated by the client
+	replyWriter struct {
+		*bufio.Writer
+		protocol int // 2 or 3
+	}
+)
+
+// readCommand returns the arguments of the next command. An empty command,
+// such as a blank inline line, returns no arguments.
+func (reader requestReader) readCommand() ([][]byte, error) {
+	line, err := reader.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		fields := bytes.Fields(line)
+		for i, field := range fields {
+			fields[i] = bytes.Clone(field)
+		}
+
+		return fields, nil
+	}
+
+	count, err := strconv.Atoi(string(line[1:]))
+	if err != nil || count > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	if count <= 0 {
+		return nil, nil
+	}
+
+	// Arguments and bulk strings grow as they are received, so that announced
+	// lengths alone don't allocate memory.
+	args := make([][]byte, 0, min(count, preallocatedArgs))
+	for range count {
+		if line, err = reader.readLine(); err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, line[:min(len(line), 1)])
+		}
+
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+
+		var arg bytes.Buffer
+		arg.Grow(min(size+2, bufferSize))
+
+		if _, err = io.CopyN(&arg, reader, int64(size+2)); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, err
+		}
+
+		if !bytes.HasSuffix(arg.Bytes(), []byte("\r\n")) {
+			return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+		}
+
+		args = append(args, arg.Bytes()[:size])
+	}
+
+	return args, nil
+}
+
+// readLine returns the next line without its terminator. The line is only
+// valid until the next read.
+func (reader requestReader) readLine() ([]byte, error) {
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: too big request", errProtocol)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(line[:len(line)-1], []byte("\r")), nil
+}
+
+// simple writes a simple string
+func (writer *replyWriter) simple(s string) {
+	writer.line('+', s)
+}
+
+// error writes an error. The message starts with an error code such as ERR,
+// and is kept on a single line.
+func (writer *replyWriter) error(message string) {
+	writer.line('-', lineBreaks.Replace(message))
+}
+
+func (writer *replyWriter) integer(n int64) {
+	writer.line(':', strconv.FormatInt(n, 10))
+}
+
+func (writer *replyWriter) bulk(data []byte) {
+	writer.line('$', strconv.Itoa(len(data)))
+	_, _ = writer.Write(data)
+	_, _ = writer.WriteString("\r\n")
+}
+
+func (writer *replyWriter) bulkString(s string) {
+	writer.line('$', strconv.Itoa(len(s)))
+	_, _ = writer.WriteString(s)
+	_, _ = writer.WriteString("\r\n")
+}
+
+// null writes the null bulk string of RESP2, or the null of RESP3
+func (writer *replyWriter) null() {
+	if writer.protocol == 3 {
+		_, _ = writer.WriteString("_\r\n")
+
+		return
+	}
+
+	_, _ = writer.WriteString("$-1\r\n")
+}
+
+// array writes the header of an array of n elements, to be followed by the elements
+func (writer *replyWriter) array(n int) {
+	writer.line('*', strconv.Itoa(n))
+}
+
+// mapHeader writes the header of a map of n pairs, to be followed by the keys
+// and values. RESP2 has no maps, so it gets a flat array of 2n elements.
+func (writer *replyWriter) mapHeader(n int) {
+	if writer.protocol == 3 {
+		writer.line('%', strconv.Itoa(n))
+
+		return
+	}
+
+	writer.array(2 * n)
+}
+
+// line writes a reply made of kind followed by s on a single line. Write
+// errors are sticky, and reported by Flush.
+func (writer *replyWriter) line(kind byte, s string) {
+	_ = writer.WriteByte(kind)
+	_, _ = writer.WriteString(s)
+	_, _ = writer.WriteString("\r\n")
+}
@@ -0,0 +1,129 @@
+// Package resp serves a cache over the Redis protocol, RESP2 and RESP3, so
+// that Redis clients and tools can use it.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/vijsourabh/caching"
+	"github.com/vijsourabh/caching/internal/netserver"
+)
+
+var (
+	// ErrInvalidParams is returned by New when the provided Params are rejected
+	ErrInvalidParams = errors.New("invalid RESP server params")
+	// ErrClosed is returned by Serve once the server has been closed, and by a second Close
+	ErrClosed = errors.New("RESP server is closed")
+)
+
+type (
+	// Params configures New
+	Params struct {
+		// Cache is the cache served. Keys are strings, and values are stored as
+		// strings. Required.
+		Cache caching.Cacher
+	}
+
+	// Server serves a cache to the clients of the listeners passed to Serve
+	Server struct {
+		cache     caching.Cacher
+		started   time.Time
+		conns     *netserver.Server
+		clientIDs atomic.Int64
+		stats     serverStats
+	}
+
+	// serverStats holds the server counters reported by INFO
+	serverStats struct {
+		connected atomic.Int64  // clients currently connected
+		accepted  atomic.Uint64 // connections accepted since the server started
+		commands  atomic.Uint64 // commands processed since the server started
+	}
+)
+
+// New creates a server for params.Cache. The cache is left open by Close.
+func New(params *Params) (*Server, error) {
+	if params.Cache == nil {
+		return nil, fmt.Errorf("%w: no cache", ErrInvalidParams)
+	}
+
+	server := &Server{
+		cache:   params.Cache,
+		started: time.Now(),
+	}
+	server.conns = netserver.New(server.serve, ErrClosed)
+
+	return server, nil
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve
+func (server *Server) ListenAndServe(addr string) error {
+	return server.conns.ListenAndServe(addr)
+}
+
+// Serve accepts connections on listener and serves each of them on its own
+// goroutine, until the listener fails or the server is closed. The listener
+// is closed when Serve returns.
+// Returns ErrClosed once the server has been closed.
+func (server *Server) Serve(listener net.Listener) error {
+	return server.conns.Serve(listener)
+}
+
+// Close stops the listeners, closes the connections of the clients and waits
+// for their commands to complete. Returns ErrClosed if the server has already
+// been closed.
+func (server *Server) Close() error {
+	return server.conns.Close()
+}
+
+// serve executes the commands of the client connected on conn until it quits,
+// sends a malformed request or disconnects. Replies are flushed once every
+// pipelined command received has been executed.
+func (server *Server) serve(conn net.Conn) {
+	server.stats.accepted.Add(1)
+	server.stats.connected.Add(1)
+
+	defer server.stats.connected.Add(-1)
+
+	client := &client{
+		server: server,
+		cache:  server.cache,
+		id:     server.clientIDs.Add(1),
+		reader: requestReader{bufio.NewReaderSize(conn, bufferSize)},
+		writer: replyWriter{Writer: bufio.NewWriterSize(conn, bufferSize), protocol: 2},
+	}
+
+	for {
+		args, err := client.reader.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				client.writer.error("ERR " + err.Error())
+				_ = client.writer.Flush()
+			}
+
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		server.stats.commands.Add(1)
+		client.execute(args)
+
+		if client.quit || client.reader.Buffered() == 0 {
+			if err = client.writer.Flush(); err != nil {
+				return
+			}
+		}
+
+		if client.quit {
+			return
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThalesGroup/flume/v2/flumetest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vijsourabh/caching"
+	"github.com/vijsourabh/caching/internal/entry"
+)
+
+type (
+	// testClient is a raw TCP client decoding replies into strings, int64,
+	// nil, []any, map[string]any for RESP3 maps and testError
+	testClient struct {
+		test   *testing.T
+		conn   net.Conn
+		reader *bufio.Reader
+	}
+
+	testError string
+)
+
+// newServer serves a new cache on a free loopback port, closed at the end of the test
+func newServer(test *testing.T, params *caching.CreateCacheParams) (*caching.Cache, *Server, string) {
+	cache := caching.NewCache(params)
+
+	server, err := New(&Params{Cache: cache})
+	require.NoError(test, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(test, err)
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	test.Cleanup(func() {
+		_ = server.Close()
+		require.ErrorIs(test, <-served, ErrClosed)
+		_ = cache.Close()
+	})
+
+	return cache, server, listener.Addr().String()
+}
+
+func dial(test *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(test, err)
+
+	test.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return &testClient{test: test, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// do sends the command as an array of bulk strings and returns the reply
+func (client *testClient) do(args ...string) any {
+	client.send(args...)
+
+	return client.read()
+}
+
+func (client *testClient) send(args ...string) {
+	var request strings.Builder
+
+	fmt.Fprintf(&request, "*%d\r\n", len(args))
+
+	for _, arg := range args {
+		fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, err := client.conn.Write([]byte(request.String()))
+	require.NoError(client.test, err)
+}
+
+func (client *testClient) read() any {
+	require.NoError(client.test, client.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	line, err := client.reader.ReadString('\n')
+	require.NoError(client.test, err)
+
+	line = strings.TrimSuffix(line, "\r\n")
+	kind, payload := line[0], line[1:]
+
+	switch kind {
+	case '+':
+		return payload
+	case '-':
+		return testError(payload)
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		require.NoError(client.test, err)
+
+		return n
+	case '_':
+		return nil
+	case '$':
+		size, err := strconv.Atoi(payload)
+		require.NoError(client.test, err)
+
+		if size < 0 {
+			return nil
+		}
+
+		data := make([]byte, size+2)
+		_, err = io.ReadFull(client.reader, data)
+		require.NoError(client.test, err)
+
+		return string(data[:size])
+	case '*', '%':
+		n, err := strconv.Atoi(payload)
+		require.NoError(client.test, err)
+
+		if kind == '%' {
+			pairs := make(map[string]any, n)
+			for range n {
+				key := client.read().(string)
+				pairs[key] = client.read()
+			}
+
+			return pairs
+		}
+
+		if n < 0 {
+			return nil
+		}
+
+		elements := make([]any, n)
+		for i := range elements {
+			elements[i] = client.read()
+		}
+
+		return elements
+	default:
+		require.Failf(client.test, "unexpected reply", "%q", line)
+
+		return nil
+	}
+}
+
+func TestService_Server(test *testing.T) {
+	defer flumetest.Start(test)
+
+	test.Run("strings are set, read and deleted", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		require.Equal(test, "PONG", client.do("PING"))
+		require.Equal(test, "OK", client.do("SET", "key", "value"))
+		require.Equal(test, "value", client.do("GET", "key"))
+		require.Nil(test, client.do("GET", "missing"))
+
+		var value any
+		require.NoError(test, cache.Get("key", &value))
+		require.Equal(test, entry.Value{Data: []byte("value")}, value)
+
+		// Strings added by Go code are returned as-is.
+		require.NoError(test, cache.Add(&caching.AddCacheParams{Key: "string", Value: "text"}))
+		require.Equal(test, "text", client.do("GET", "string"))
+
+		// Values added by Go code are JSON-encoded.
+		require.NoError(test, cache.Add(&caching.AddCacheParams{Key: "struct", Value: map[string]int{"a": 1}}))
+		require.Equal(test, `{"a":1}`, client.do("GET", "struct"))
+
+		require.Equal(test, "OK", client.do("MSET", "a", "1", "b", "2"))
+		require.Equal(test, []any{"1", nil, "2"}, client.do("MGET", "a", "missing", "b"))
+		require.Equal(test, int64(3), client.do("EXISTS", "a", "a", "missing", "b"))
+		require.Equal(test, int64(2), client.do("DEL", "a", "a", "b", "missing"))
+		require.Equal(test, int64(0), client.do("EXISTS", "a", "b"))
+		require.Equal(test, int64(3), client.do("DBSIZE"))
+
+		require.Equal(test, "OK", client.do("FLUSHDB"))
+		require.Equal(test, 0, cache.Len())
+	})
+
+	test.Run("an obfuscated cache is served", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, _, addr := newServer(test, &caching.CreateCacheParams{IsCacheObfuscated: true})
+		client := dial(test, addr)
+
+		// Binary values survive the JSON encoding of obfuscated caches.
+		binary := string([]byte{0xff, 0x00, 0xfe})
+		require.Equal(test, "OK", client.do("SET", "key", binary))
+		require.Equal(test, binary, client.do("GET", "key"))
+		require.Equal(test, int64(42), client.do("INCRBY", "counter", "42"))
+
+		var value entry.Value
+		require.NoError(test, cache.Get("counter", &value))
+		require.Equal(test, "42", string(value.Data))
+
+		require.NoError(test, cache.Add(&caching.AddCacheParams{Key: "string", Value: "text"}))
+		require.Equal(test, "text", client.do("GET", "string"))
+	})
+
+	test.Run("SET honours NX, XX and GET", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		require.Nil(test, client.do("SET", "key", "first", "XX"))
+		require.Nil(test, client.do("GET", "key"))
+		require.Equal(test, "OK", client.do("SET", "key", "first", "NX"))
+		require.Nil(test, client.do("SET", "key", "second", "NX"))
+		require.Equal(test, "first", client.do("SET", "key", "second", "XX", "GET"))
+		require.Equal(test, "second", client.do("GET", "key"))
+
+		require.Equal(test, testError("ERR syntax error"), client.do("SET", "key", "value", "NX", "XX"))
+		require.Equal(test, testError("ERR syntax error"), client.do("SET", "key", "value", "EX"))
+		require.Equal(test, testError("ERR invalid expire time in 'set' command"), client.do("SET", "key", "value", "EX", "0"))
+		require.Equal(test, testError("ERR wrong number of arguments for 'get' command"), client.do("GET"))
+		require.Equal(test, testError("ERR unknown command 'NOPE', with args beginning with: 'a' "), client.do("NOPE", "a"))
+	})
+
+	test.Run("expiry is set, read and removed", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		clock := caching.NewFakeClock(time.Now())
+		_, _, addr := newServer(test, &caching.CreateCacheParams{Clock: clock})
+		client := dial(test, addr)
+
+		require.Equal(test, "OK", client.do("SET", "key", "value", "EX", "10"))
+		require.Equal(test, int64(10), client.do("TTL", "key"))
+		require.Equal(test, int64(10000), client.do("PTTL", "key"))
+
+		require.Equal(test, "OK", client.do("SET", "forever", "value"))
+		require.Equal(test, int64(-1), client.do("TTL", "forever"))
+		require.Equal(test, int64(-2), client.do("TTL", "missing"))
+
+		require.Equal(test, int64(1), client.do("EXPIRE", "forever", "100"))
+		require.Equal(test, int64(0), client.do("EXPIRE", "forever", "50", "GT"))
+		require.Equal(test, int64(1), client.do("EXPIRE", "forever", "50", "LT"))
+		require.Equal(test, int64(50), client.do("TTL", "forever"))
+		require.Equal(test, int64(0), client.do("EXPIRE", "missing", "100"))
+		require.Equal(test, int64(1), client.do("PEXPIRE", "key", "20000"))
+		require.Equal(test, int64(20), client.do("TTL", "key"))
+
+		require.Equal(test, int64(1), client.do("PERSIST", "forever"))
+		require.Equal(test, int64(0), client.do("PERSIST", "forever"))
+		require.Equal(test, int64(-1), client.do("TTL", "forever"))
+
+		clock.Advance(20*time.Second + time.Nanosecond)
+		require.Nil(test, client.do("GET", "key"))
+
+		require.Equal(test, int64(1), client.do("EXPIRE", "forever", "0"))
+		require.Equal(test, int64(0), client.do("EXISTS", "forever"))
+	})
+
+	test.Run("counters are incremented and keep their expiry", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{Clock: caching.NewFakeClock(time.Now())})
+		client := dial(test, addr)
+
+		require.Equal(test, int64(1), client.do("INCR", "counter"))
+		require.Equal(test, int64(11), client.do("INCRBY", "counter", "10"))
+		require.Equal(test, int64(10), client.do("DECR", "counter"))
+		require.Equal(test, int64(-5), client.do("DECRBY", "counter", "15"))
+
+		require.Equal(test, int64(1), client.do("EXPIRE", "counter", "60"))
+		require.Equal(test, int64(-4), client.do("INCR", "counter"))
+		require.Equal(test, int64(60), client.do("TTL", "counter"))
+
+		require.Equal(test, "OK", client.do("SET", "text", "abc"))
+		require.Equal(test, testError("ERR value is not an integer or out of range"), client.do("INCR", "text"))
+		require.Equal(test, "OK", client.do("SET", "max", "9223372036854775807"))
+		require.Equal(test, testError("ERR increment or decrement would overflow"), client.do("INCR", "max"))
+	})
+
+	test.Run("keys are listed and scanned", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		cache, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		var want []any
+
+		for i := range 25 {
+			key := fmt.Sprintf("user:%02d", i)
+			want = append(want, key)
+			require.Equal(test, "OK", client.do("SET", key, "value"))
+		}
+
+		require.Equal(test, "OK", client.do("SET", "other", "value"))
+		require.NoError(test, cache.Add(&caching.AddCacheParams{Key: 1, Value: "not a string key"}))
+
+		require.Equal(test, want, client.do("KEYS", "user:*"))
+		require.Equal(test, []any{"user:10", "user:11"}, client.do("KEYS", "user:1[0-1]"))
+
+		scanned := map[string]bool{}
+		cursor := "0"
+
+		for {
+			reply := client.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "4").([]any)
+			for _, key := range reply[1].([]any) {
+				require.False(test, scanned[key.(string)])
+				scanned[key.(string)] = true
+			}
+
+			if cursor = reply[0].(string); cursor == "0" {
+				break
+			}
+		}
+
+		require.Len(test, scanned, len(want))
+		require.Equal(test, []any{"0", []any{}}, client.do("SCAN", "0", "TYPE", "hash"))
+	})
+
+	test.Run("HELLO switches to RESP3", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		hello := client.do("HELLO", "3").(map[string]any)
+		require.Equal(test, int64(3), hello["proto"])
+		require.Equal(test, version, hello["version"])
+
+		// RESP3 has a dedicated null.
+		_, err := client.conn.Write([]byte("*2\r\n$3\r\nGET\r\n$7\r\nmissing\r\n"))
+		require.NoError(test, err)
+
+		line, err := client.reader.ReadString('\n')
+		require.NoError(test, err)
+		require.Equal(test, "_\r\n", line)
+
+		require.Equal(test, testError("NOPROTO unsupported protocol version"), client.do("HELLO", "4"))
+	})
+
+	test.Run("INFO reports the counters", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		require.Equal(test, "OK", client.do("SET", "key", "value", "EX", "100"))
+		require.Equal(test, "value", client.do("GET", "key"))
+		require.Nil(test, client.do("GET", "missing"))
+
+		info := client.do("INFO").(string)
+		require.Contains(test, info, "# Server\r\nredis_version:"+version)
+		require.Contains(test, info, "connected_clients:1\r\n")
+		require.Contains(test, info, "keyspace_hits:1\r\n")
+		require.Contains(test, info, "keyspace_misses:1\r\n")
+		require.Contains(test, info, "db0:keys=1,expires=1,avg_ttl=0\r\n")
+
+		info = client.do("INFO", "stats").(string)
+		require.True(test, strings.HasPrefix(info, "# Stats\r\n"))
+		require.NotContains(test, info, "# Server")
+	})
+
+	test.Run("pipelined and inline commands are answered in order", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		_, err := client.conn.Write([]byte("SET key value\r\n\r\nGET key\r\nPING\r\n"))
+		require.NoError(test, err)
+
+		require.Equal(test, "OK", client.read())
+		require.Equal(test, "value", client.read())
+		require.Equal(test, "PONG", client.read())
+
+		client.send("SET", "a", "1")
+		client.send("INCR", "a")
+		client.send("GET", "a")
+		require.Equal(test, "OK", client.read())
+		require.Equal(test, int64(2), client.read())
+		require.Equal(test, "2", client.read())
+
+		require.Equal(test, "OK", client.do("QUIT"))
+		_, err = client.reader.ReadByte()
+		require.ErrorIs(test, err, io.EOF)
+	})
+
+	test.Run("malformed requests close the connection", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, _, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+
+		_, err := client.conn.Write([]byte("*1\r\n$x\r\n"))
+		require.NoError(test, err)
+
+		require.Equal(test, testError("ERR Protocol error: invalid bulk length"), client.read())
+		_, err = client.reader.ReadByte()
+		require.ErrorIs(test, err, io.EOF)
+	})
+
+	test.Run("bulk strings are read as they arrive", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		large := strings.Repeat("v", 3*bufferSize)
+		reader := requestReader{bufio.NewReaderSize(strings.NewReader(
+			fmt.Sprintf("*2\r\n$3\r\nSET\r\n$%d\r\n%s\r\n", len(large), large),
+		), bufferSize)}
+
+		args, err := reader.readCommand()
+		require.NoError(test, err)
+		require.Equal(test, [][]byte{[]byte("SET"), []byte(large)}, args)
+
+		// Lengths announced by a client that stops sending are not allocated.
+		reader = requestReader{bufio.NewReader(strings.NewReader(
+			fmt.Sprintf("*%d\r\n$%d\r\nshort", maxArgs, maxBulkSize),
+		))}
+
+		_, err = reader.readCommand()
+		require.ErrorIs(test, err, io.ErrUnexpectedEOF)
+	})
+
+	test.Run("Close disconnects the clients", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, server, addr := newServer(test, &caching.CreateCacheParams{})
+		client := dial(test, addr)
+		require.Equal(test, "PONG", client.do("PING"))
+
+		require.NoError(test, server.Close())
+		require.ErrorIs(test, server.Close(), ErrClosed)
+
+		_, err := client.reader.ReadByte()
+		require.Error(test, err)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(test, err)
+		require.ErrorIs(test, server.Serve(listener), ErrClosed)
+	})
+
+	test.Run("New requires a cache", func(test *testing.T) {
+		defer flumetest.Start(test)
+		test.Parallel()
+
+		_, err := New(&Params{})
+		require.ErrorIs(test, err, ErrInvalidParams)
+	})
+}
+
+func TestService_Match(test *testing.T) {
+	defer flumetest.Start(test)
+
+	for _, tt := range []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXbY", false},
+	} {
+		require.Equal(test, tt.want, match(tt.pattern, tt.key), "%s %s", tt.pattern, tt.key)
+	}
+}
@@ -0,0 +1,50 @@
+package caching
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+type (
+	// Stats is a snapshot of the counters of a cache or namespace
+	Stats struct {
+		Hits      uint64 // lookups by Get, GetBytes and GetMany that found a live entry
+		Misses    uint64 // lookups that found no entry, an expired one or one failing to decrypt
+		Adds      uint64 // entries stored by Add and AddMany
+		Evictions uint64 // expired entries removed by lookups, expiration calls or the cleaner
+		Len       int    // as returned by Len
+	}
+
+	// cacheStats holds the counters reported by Stats
+	cacheStats struct {
+		hits      atomic.Uint64
+		misses    atomic.Uint64
+		adds      atomic.Uint64
+		evictions atomic.Uint64
+	}
+)
+
+// Stats returns a snapshot of the counters of the cache. The counters of a
+// namespace only cover its own entries, and those of the root cache exclude them.
+// Counters are read individually, so a snapshot taken under concurrent use may
+// be slightly inconsistent.
+func (cache *Cache) Stats() Stats {
+	return Stats{
+		Hits:      cache.stats.hits.Load(),
+		Misses:    cache.stats.misses.Load(),
+		Adds:      cache.stats.adds.Load(),
+		Evictions: cache.stats.evictions.Load(),
+		Len:       cache.Len(),
+	}
+}
+
+// countLookup counts a lookup returning err as a hit or a miss. A lookup
+// failing to decode into the destination still found a live entry.
+func (cache *Cache) countLookup(err error) {
+	switch {
+	case err == nil, errors.Is(err, ErrDecode):
+		cache.stats.hits.Add(1)
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrExpired), errors.Is(err, ErrDecrypt):
+		cache.stats.misses.Add(1)
+	}
+}
@@ -0,0 +1,151 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Store is a backing store, such as a database, kept in sync with a cache.
+// A cache created with a Store reads missing keys through it and writes Add,
+// Update and Remove through it. Implementations must be safe for concurrent use.
+type Store interface {
+	// Load returns the value stored for key, or an error wrapping ErrNotFound
+	// if there is none.
+	Load(ctx context.Context, key any) (any, error)
+	// Save stores value for key.
+	Save(ctx context.Context, key any, value any) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key any) error
+}
+
+// MemoryStore is an in-memory Store, as a reference implementation and for tests
+type MemoryStore struct {
+	lock   sync.RWMutex
+	values map[any]any
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		values: make(map[any]any),
+	}
+}
+
+func (memoryStore *MemoryStore) Load(_ context.Context, key any) (any, error) {
+	memoryStore.lock.RLock()
+	defer memoryStore.lock.RUnlock()
+
+	value, found := memoryStore.values[key]
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (memoryStore *MemoryStore) Save(_ context.Context, key any, value any) error {
+	memoryStore.lock.Lock()
+	defer memoryStore.lock.Unlock()
+
+	memoryStore.values[key] = value
+
+	return nil
+}
+
+func (memoryStore *MemoryStore) Delete(_ context.Context, key any) error {
+	memoryStore.lock.Lock()
+	defer memoryStore.lock.Unlock()
+
+	delete(memoryStore.values, key)
+
+	return nil
+}
+
+// Len returns the number of keys in the store
+func (memoryStore *MemoryStore) Len() int {
+	memoryStore.lock.RLock()
+	defer memoryStore.lock.RUnlock()
+
+	return len(memoryStore.values)
+}
+
+// fetch looks key up like lookup and, when it is missing or expired, reads it
+// through the store. The miss is returned if the store doesn't have key either.
+func (cache *Cache) fetch(key any, value any, now time.Time, scratch *[]byte) (*GetCacheResponse, error) {
+	res, err := cache.lookup(key, value, now, scratch)
+	cache.countLookup(err)
+
+	if cache.backend == nil || !(errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired)) {
+		return res, err
+	}
+
+	loaded, loadErr := cache.loadThrough(key)
+	if errors.Is(loadErr, ErrNotFound) {
+		return nil, err
+	}
+
+	if loadErr != nil {
+		return nil, newKeyError(key, ErrStore, loadErr)
+	}
+
+	entry := newEntry(&AddCacheParams{Key: key, Value: loaded}, cache.config.Load().Expiry, now)
+	if err = cache.addInCache(key, entry); err != nil {
+		return nil, err
+	}
+
+	return cache.lookup(key, value, now, scratch)
+}
+
+// loadThrough loads the value of key from the store, or from the write to the
+// store still pending for key
+func (cache *Cache) loadThrough(key any) (any, error) {
+	if cache.writes != nil {
+		if write, found := cache.writes.lookup(key); found {
+			if write.Delete {
+				return nil, ErrNotFound
+			}
+
+			return write.Value, nil
+		}
+	}
+
+	return cache.backend.Load(cache.ctx, key)
+}
+
+// save writes value for key through the store, if any, or queues the write
+func (cache *Cache) save(key any, value any) error {
+	if cache.backend == nil {
+		return nil
+	}
+
+	if cache.writes != nil {
+		return cache.writes.enqueue(Write{Key: key, Value: value})
+	}
+
+	if err := cache.backend.Save(cache.ctx, key, value); err != nil {
+		return newKeyError(key, ErrStore, err)
+	}
+
+	return nil
+}
+
+// delete removes key from the store, if any, or queues the removal
+func (cache *Cache) delete(key any) error {
+	if cache.backend == nil {
+		return nil
+	}
+
+	if cache.writes != nil {
+		return cache.writes.enqueue(Write{Key: key, Delete: true})
+	}
+
+	if err := cache.backend.Delete(cache.ctx, key); err != nil {
+		return newKeyError(key, ErrStore, err)
+	}
+
+	return nil
+}
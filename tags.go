@@ -0,0 +1,45 @@
+package caching
+
+import (
+	"slices"
+)
+
+// InvalidateTag removes every entry added with the provided tag.
+// Returns ErrClosed once the cache has been closed.
+func (cache *Cache) InvalidateTag(tag string) error {
+	return cache.InvalidateTags(tag)
+}
+
+// InvalidateTags removes every entry added with any of the provided tags. The
+// entries are found through a secondary index, without scanning the cache.
+// An entry re-added concurrently without a matching tag is kept.
+// Returns a *BatchError wrapping ErrInvalidation for the removed keys if
+// publishing their invalidation fails, and ErrClosed once the cache has been closed.
+func (cache *Cache) InvalidateTags(tags ...string) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	var removed []any
+
+	for _, tag := range tags {
+		for _, key := range cache.tags.keys(tag) {
+			// The index may still list a key whose entry was just replaced.
+			entry, found := cache.load(key)
+			if found && entry.hasTag(tag) && cache.removeEntry(key, entry) {
+				removed = append(removed, key)
+			}
+		}
+	}
+
+	batchError := BatchError{Errors: cache.publish(removed...)}
+
+	return batchError.err()
+}
+
+// hasTag reports whether the entry was added with the provided tag
+func (entry *cacheEntry) hasTag(tag string) bool {
+	_, found := slices.BinarySearch(entry.tags, tag)
+
+	return found
+}
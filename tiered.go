@@ -0,0 +1,178 @@
+package caching
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type (
+	// TieredCache puts a local Cache, the first tier, in front of a RemoteCache
+	// shared with other processes, the second tier. Values are JSON-encoded
+	// once and written to both tiers; local misses are read from the remote
+	// cache and promoted into the local one.
+	TieredCache struct {
+		local       *Cache
+		remote      RemoteCache
+		expiry      time.Duration
+		localExpiry time.Duration
+	}
+
+	// CreateTieredCacheParams configures NewTieredCache
+	CreateTieredCacheParams struct {
+		// Local is the first tier. It shouldn't have a Store: the remote cache
+		// is the shared copy.
+		Local *Cache
+		// Remote is the second tier.
+		Remote RemoteCache
+		// Expiry is the TTL in Remote of entries added without a per-key Expiry.
+		// Zero or negative means they never expire.
+		Expiry time.Duration
+		// LocalExpiry is the TTL in Local of added and promoted entries, capped
+		// by their remote TTL. Keep it short so that changes made by other
+		// processes are picked up quickly. Defaults to the expiry of Local.
+		LocalExpiry time.Duration
+	}
+)
+
+// NewTieredCache creates a TieredCache. Closing it is left to the owner of the
+// local cache.
+func NewTieredCache(params *CreateTieredCacheParams) *TieredCache {
+	return &TieredCache{
+		local:       params.Local,
+		remote:      params.Remote,
+		expiry:      params.Expiry,
+		localExpiry: params.LocalExpiry,
+	}
+}
+
+// Get populates value, as json.Unmarshal does, with the value cached for key
+// in the local cache or, on a local miss, in the remote cache. A remote hit is
+// promoted into the local cache for LocalExpiry.
+// Failures are reported as a *KeyError wrapping the ErrNotFound or ErrExpired
+// of the local cache when both tiers miss, ErrRemote when the remote cache
+// fails, or ErrDecode.
+func (tiered *TieredCache) Get(ctx context.Context, key any, value any) error {
+	data, err := tiered.local.GetBytes(key, nil)
+	if err == nil {
+		defer clear(data)
+
+		return decodeJSON(key, data, value)
+	}
+
+	if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrExpired) {
+		return err
+	}
+
+	data, remoteErr := tiered.remote.Get(ctx, remoteKey(key))
+	if errors.Is(remoteErr, ErrNotFound) {
+		return err
+	}
+
+	if remoteErr != nil {
+		return newKeyError(key, ErrRemote, remoteErr)
+	}
+
+	// A non-obfuscated local cache stores data as is.
+	if tiered.local.obfuscator != nil {
+		defer clear(data)
+	}
+
+	if err = tiered.promote(key, data); err != nil {
+		return err
+	}
+
+	return decodeJSON(key, data, value)
+}
+
+// Add JSON-encodes params.Value and writes it to the remote cache, then to the
+// local cache. Per-key Expiry overrides Expiry in the remote cache when > 0.
+// Tags and DependsOn only apply to the local cache.
+// Returns a *KeyError wrapping ErrEncode, or ErrRemote if the remote cache
+// fails, in which case the local cache is left unchanged.
+func (tiered *TieredCache) Add(ctx context.Context, params *AddCacheParams) error {
+	data, err := json.Marshal(params.Value)
+	if err != nil {
+		return newKeyError(params.Key, ErrEncode, err)
+	}
+
+	expiry := tiered.expiry
+	if params.Expiry > 0 {
+		expiry = params.Expiry
+	}
+
+	if err = tiered.remote.Set(ctx, remoteKey(params.Key), data, expiry); err != nil {
+		return newKeyError(params.Key, ErrRemote, err)
+	}
+
+	local := *params
+	local.Value = json.RawMessage(data)
+	local.Expiry = tiered.localTTL(expiry)
+
+	return tiered.local.Add(&local)
+}
+
+// Remove deletes key from the remote cache and the local cache. The key is
+// removed from the local cache even if the remote cache fails.
+// Returns a *KeyError wrapping ErrRemote if the remote cache fails.
+func (tiered *TieredCache) Remove(ctx context.Context, key any) error {
+	var err error
+	if remoteErr := tiered.remote.Delete(ctx, remoteKey(key)); remoteErr != nil {
+		err = newKeyError(key, ErrRemote, remoteErr)
+	}
+
+	if localErr := tiered.local.Remove(key); localErr != nil {
+		return localErr
+	}
+
+	return err
+}
+
+// promote caches data, the value of key read from the remote cache, in the
+// local cache. Unlike Add, it neither writes the value through the store of
+// the local cache nor publishes it to its Invalidator: the value hasn't changed.
+func (tiered *TieredCache) promote(key any, data []byte) error {
+	local := tiered.local
+	if local.isClosed() {
+		return ErrClosed
+	}
+
+	params := &AddCacheParams{
+		Key:    key,
+		Value:  json.RawMessage(data),
+		Expiry: tiered.localTTL(0),
+	}
+
+	return local.addInCache(key, newEntry(params, local.config.Load().Expiry, local.clock.Now()))
+}
+
+// localTTL returns the TTL in the local cache of an entry expiring after expiry
+// in the remote cache, zero or negative meaning never
+func (tiered *TieredCache) localTTL(expiry time.Duration) time.Duration {
+	ttl := tiered.localExpiry
+	if ttl <= 0 {
+		ttl = tiered.local.Options().Expiry
+	}
+
+	if expiry > 0 && (ttl <= 0 || expiry < ttl) {
+		ttl = expiry
+	}
+
+	return ttl
+}
+
+// remoteKey returns the key of the remote cache for key: its default format
+func remoteKey(key any) string {
+	return fmt.Sprint(key)
+}
+
+// decodeJSON unmarshals data, the JSON encoding of the value of key, into value
+func decodeJSON(key any, data []byte, value any) error {
+	if err := json.Unmarshal(data, value); err != nil {
+		return newKeyError(key, ErrDecode, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,314 @@
+package caching
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFlushInterval = time.Second
+	defaultBatchSize     = 100
+)
+
+type (
+	// WriteBehindParams configures the write-behind mode of a cache created
+	// with a Store. It has no effect without a Store.
+	WriteBehindParams struct {
+		// Enabled queues the writes to the Store and flushes them in the
+		// background, instead of writing them through.
+		Enabled bool
+		// FlushInterval is the interval between background flushes. Defaults to one second.
+		FlushInterval time.Duration
+		// BatchSize is the number of pending keys triggering a flush before the
+		// interval elapses, and the size of the batches written. Defaults to 100.
+		BatchSize int
+		// MaxPending is the number of pending keys above which writes of other
+		// keys block until a flush makes room. Defaults to 10 × BatchSize.
+		MaxPending int
+		// MaxWait is the time a write waits for room in a full queue before
+		// failing with ErrStore. Defaults to 10 × FlushInterval.
+		MaxWait time.Duration
+	}
+
+	// Write is a write to a Store: a Save of Value for Key, or a Delete of Key
+	Write struct {
+		Key    any
+		Value  any
+		Delete bool
+	}
+
+	// BatchStore is a Store applying several writes at once. Write-behind uses
+	// it, when implemented, to flush each batch in a single call.
+	BatchStore interface {
+		Store
+		// Write applies writes, each for a different key.
+		Write(ctx context.Context, writes []Write) error
+	}
+
+	// writeBehind queues the writes of a cache to its Store, keeping only the
+	// latest write of each key. A write stays pending, and visible to read-through,
+	// until the store has applied it.
+	writeBehind struct {
+		params    WriteBehindParams
+		lock      sync.Mutex
+		room      chan struct{} // closed and replaced when writes leave the queue or it closes
+		pending   map[any]pendingWrite
+		sequence  uint64
+		closed    bool
+		flushLock sync.Mutex    // serialises flushes so the writes of a key reach the store in order
+		flushCh   chan struct{} // signals the flusher that BatchSize keys are pending
+	}
+
+	// pendingWrite is a queued write with its position in the queue
+	pendingWrite struct {
+		Write
+		sequence uint64
+	}
+)
+
+var _ BatchStore = (*MemoryStore)(nil)
+
+// Flush writes every pending write of a write-behind cache to its Store, in
+// batches, and waits for them. Writes the store fails stay pending and are
+// retried by the next flush. Flush is a no-op without write-behind.
+// Returns an error wrapping ErrStore for the failed writes, the error of ctx if
+// it is done before every batch is written, and ErrClosed once the cache has
+// been closed.
+func (cache *Cache) Flush(ctx context.Context) error {
+	if cache.isClosed() {
+		return ErrClosed
+	}
+
+	if cache.writes == nil {
+		return nil
+	}
+
+	return cache.writes.flush(ctx, cache.backend)
+}
+
+// flushBehind flushes the pending writes on every tick of ticker, and whenever
+// BatchSize keys are pending, until the cache is closed
+func (cache *Cache) flushBehind(ticker Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cache.ctx.Done():
+			return
+		case <-ticker.C():
+		case <-cache.writes.flushCh:
+		}
+
+		// Failed writes stay pending and are retried by the next flush.
+		_ = cache.writes.flush(cache.ctx, cache.backend)
+	}
+}
+
+// Write applies writes under a single lock
+func (memoryStore *MemoryStore) Write(_ context.Context, writes []Write) error {
+	memoryStore.lock.Lock()
+	defer memoryStore.lock.Unlock()
+
+	for _, write := range writes {
+		if write.Delete {
+			delete(memoryStore.values, write.Key)
+		} else {
+			memoryStore.values[write.Key] = write.Value
+		}
+	}
+
+	return nil
+}
+
+// newWriteBehind creates the queue of a write-behind cache, applying the defaults of params
+func newWriteBehind(params WriteBehindParams) *writeBehind {
+	if params.FlushInterval <= 0 {
+		params.FlushInterval = defaultFlushInterval
+	}
+
+	if params.BatchSize <= 0 {
+		params.BatchSize = defaultBatchSize
+	}
+
+	if params.MaxPending <= 0 {
+		params.MaxPending = 10 * params.BatchSize
+	}
+
+	if params.MaxWait <= 0 {
+		params.MaxWait = 10 * params.FlushInterval
+	}
+
+	return &writeBehind{
+		params:  params,
+		room:    make(chan struct{}),
+		pending: make(map[any]pendingWrite),
+		flushCh: make(chan struct{}, 1),
+	}
+}
+
+// enqueue queues write, replacing the pending write of its key. It blocks while
+// MaxPending keys are pending, unless the key of write is one of them, for up
+// to MaxWait.
+// Returns a *KeyError wrapping ErrStore if the queue stays full, and ErrClosed
+// once the queue has been closed.
+func (queue *writeBehind) enqueue(write Write) error {
+	var timeout <-chan time.Time
+
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	for {
+		if queue.closed {
+			return ErrClosed
+		}
+
+		if _, found := queue.pending[write.Key]; found || len(queue.pending) < queue.params.MaxPending {
+			break
+		}
+
+		if timeout == nil {
+			timer := time.NewTimer(queue.params.MaxWait)
+			defer timer.Stop()
+
+			timeout = timer.C
+		}
+
+		room := queue.room
+		queue.lock.Unlock()
+
+		select {
+		case <-room:
+			queue.lock.Lock()
+		case <-timeout:
+			queue.lock.Lock()
+
+			return newKeyError(write.Key, ErrStore, fmt.Errorf("write-behind queue still full after %v", queue.params.MaxWait))
+		}
+	}
+
+	queue.sequence++
+	queue.pending[write.Key] = pendingWrite{Write: write, sequence: queue.sequence}
+
+	if len(queue.pending) >= queue.params.BatchSize {
+		select {
+		case queue.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the pending write of key
+func (queue *writeBehind) lookup(key any) (Write, bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	write, found := queue.pending[key]
+
+	return write.Write, found
+}
+
+// flush writes the writes pending when it starts to store, in queue order and
+// in batches of BatchSize
+func (queue *writeBehind) flush(ctx context.Context, store Store) error {
+	queue.flushLock.Lock()
+	defer queue.flushLock.Unlock()
+
+	queue.lock.Lock()
+	writes := make([]pendingWrite, 0, len(queue.pending))
+	for _, write := range queue.pending {
+		writes = append(writes, write)
+	}
+	queue.lock.Unlock()
+
+	slices.SortFunc(writes, func(a, b pendingWrite) int {
+		return cmp.Compare(a.sequence, b.sequence)
+	})
+
+	var errs []error
+
+	for batch := range slices.Chunk(writes, queue.params.BatchSize) {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		errs = append(errs, queue.write(ctx, store, batch)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// write applies batch to store and removes the applied writes from the queue
+func (queue *writeBehind) write(ctx context.Context, store Store, batch []pendingWrite) []error {
+	if batchStore, ok := store.(BatchStore); ok {
+		writes := make([]Write, len(batch))
+		for i, write := range batch {
+			writes[i] = write.Write
+		}
+
+		if err := batchStore.Write(ctx, writes); err != nil {
+			return []error{fmt.Errorf("%w: %w", ErrStore, err)}
+		}
+
+		queue.done(batch...)
+
+		return nil
+	}
+
+	var errs []error
+
+	for _, write := range batch {
+		var err error
+		if write.Delete {
+			err = store.Delete(ctx, write.Key)
+		} else {
+			err = store.Save(ctx, write.Key, write.Value)
+		}
+
+		if err != nil {
+			errs = append(errs, newKeyError(write.Key, ErrStore, err))
+
+			continue
+		}
+
+		queue.done(write)
+	}
+
+	return errs
+}
+
+// done removes applied writes from the queue, unless their key has been written since
+func (queue *writeBehind) done(writes ...pendingWrite) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	for _, write := range writes {
+		if current, found := queue.pending[write.Key]; found && current.sequence == write.sequence {
+			delete(queue.pending, write.Key)
+		}
+	}
+
+	queue.signalRoom()
+}
+
+// signalRoom wakes the writes waiting for room in the queue up
+func (queue *writeBehind) signalRoom() {
+	close(queue.room)
+	queue.room = make(chan struct{})
+}
+
+// close rejects later writes, then flushes the pending ones to store
+func (queue *writeBehind) close(store Store) error {
+	queue.lock.Lock()
+	queue.closed = true
+	queue.signalRoom()
+	queue.lock.Unlock()
+
+	return queue.flush(context.Background(), store)
+}